@@ -1,74 +1,313 @@
 package arch
 
 import (
-	//"regexp"
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
 	"os"
-	//"os/exec"
 	"strings"
-	//"fmt"
-	"encoding/hex"
 )
 
-func SearchBytesInFile( path string, match string, limit int) bool {
-  // Transform to byte array the string
-  toMatch, err := hex.DecodeString(match);
-  if (err != nil) {
-    return false;
-  }
-  
-  // Opening the file and checking if there is an error
-  file, err := os.Open(path)
-  if err != nil {
-    return false;
-  }
-
-  // Close file upon return
-  defer file.Close()
-
-  // Allocate 1 byte array to perform the match
-  bit := make([]byte, 1);
-  j := 0
-  for i := 0; i < limit; i++ {
-    file.Read(bit);
-
-    if bit[0] != toMatch[j] {
-      j = 0;
-    }
-    if bit[0] == toMatch[j] {
-      j++;
-      if (j >= len(toMatch)) {
-        file.Close();
-        return true;
-      }
-    }
-  }
-  file.Close();
-  return false;
+// Architecture identifies the CPU architecture of an executable.
+type Architecture int
+
+const (
+	Unknown Architecture = iota
+	X86
+	X64
+	ARM64
+	ARM64EC
+	ARM
+)
+
+// IMAGE_FILE_MACHINE_ARM64EC is not defined by debug/pe.
+const IMAGE_FILE_MACHINE_ARM64EC = 0xa641
+
+func (a Architecture) String() string {
+	switch a {
+	case X86:
+		return "x86"
+	case X64:
+		return "x64"
+	case ARM64:
+		return "arm64"
+	case ARM64EC:
+		return "arm64ec"
+	case ARM:
+		return "arm"
+	}
+	return "unknown"
+}
+
+// Image describes the headers of a PE (Portable Executable) file.
+type Image struct {
+	Arch Architecture
+	// Machine is the raw machine type from the COFF file header.
+	Machine uint16
+	// Subsystem is the raw subsystem from the optional header.
+	Subsystem uint16
+	// PE32Plus is true for PE32+ (64-bit) images and false for PE32 images.
+	PE32Plus bool
+}
+
+// SubsystemName returns a readable name for the image subsystem.
+func (i *Image) SubsystemName() string {
+	switch i.Subsystem {
+	case pe.IMAGE_SUBSYSTEM_NATIVE:
+		return "native"
+	case pe.IMAGE_SUBSYSTEM_WINDOWS_GUI:
+		return "windows"
+	case pe.IMAGE_SUBSYSTEM_WINDOWS_CUI:
+		return "console"
+	case pe.IMAGE_SUBSYSTEM_EFI_APPLICATION:
+		return "efi"
+	}
+	return fmt.Sprintf("unknown (%d)", i.Subsystem)
+}
+
+func machine(m uint16) Architecture {
+	switch m {
+	case pe.IMAGE_FILE_MACHINE_I386:
+		return X86
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		return X64
+	case pe.IMAGE_FILE_MACHINE_ARM64:
+		return ARM64
+	case IMAGE_FILE_MACHINE_ARM64EC:
+		return ARM64EC
+	case pe.IMAGE_FILE_MACHINE_ARM, pe.IMAGE_FILE_MACHINE_ARMNT, pe.IMAGE_FILE_MACHINE_THUMB:
+		return ARM
+	}
+	return Unknown
+}
+
+// Read parses the PE headers from r. The headers are decoded with the
+// debug/pe types directly, because pe.NewFile rejects machine types it does
+// not recognize (such as ARM64EC).
+func Read(r io.ReaderAt) (*Image, error) {
+	// The DOS header stores the offset of the PE signature at 0x3c
+	dos := make([]byte, 0x40)
+	if _, err := r.ReadAt(dos, 0); err != nil {
+		return nil, fmt.Errorf("failed to read DOS header: %v", err)
+	}
+	if dos[0] != 'M' || dos[1] != 'Z' {
+		return nil, errors.New("missing DOS header")
+	}
+
+	offset := int64(binary.LittleEndian.Uint32(dos[0x3c:]))
+	sig := make([]byte, 4)
+	if _, err := r.ReadAt(sig, offset); err != nil {
+		return nil, fmt.Errorf("failed to read PE signature: %v", err)
+	}
+	if !bytes.Equal(sig, []byte{'P', 'E', 0, 0}) {
+		return nil, errors.New("missing PE signature")
+	}
+
+	sr := io.NewSectionReader(r, offset+4, 1<<20)
+	var header pe.FileHeader
+	if err := binary.Read(sr, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("failed to read file header: %v", err)
+	}
+
+	img := &Image{
+		Arch:    machine(header.Machine),
+		Machine: header.Machine,
+	}
+
+	if header.SizeOfOptionalHeader < 2 {
+		return img, nil
+	}
+
+	var magic uint16
+	if err := binary.Read(sr, binary.LittleEndian, &magic); err != nil {
+		return nil, fmt.Errorf("failed to read optional header: %v", err)
+	}
+	sr.Seek(-2, io.SeekCurrent)
+
+	switch magic {
+	case 0x10b:
+		var oh pe.OptionalHeader32
+		if err := binary.Read(sr, binary.LittleEndian, &oh); err != nil {
+			return nil, fmt.Errorf("failed to read PE32 optional header: %v", err)
+		}
+		img.Subsystem = oh.Subsystem
+	case 0x20b:
+		var oh pe.OptionalHeader64
+		if err := binary.Read(sr, binary.LittleEndian, &oh); err != nil {
+			return nil, fmt.Errorf("failed to read PE32+ optional header: %v", err)
+		}
+		img.Subsystem = oh.Subsystem
+		img.PE32Plus = true
+	default:
+		return nil, fmt.Errorf("unrecognized optional header magic 0x%x", magic)
+	}
+
+	return img, nil
+}
+
+// Detect reads the PE headers of the executable at path.
+func Detect(path string) (*Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, err := Read(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a valid executable: %v", path, err)
+	}
+
+	return img, nil
 }
 
+// Bit returns the architecture of the executable at path in the format
+// used by nvm settings ("32", "64", or "arm64"), or "?" if it cannot be
+// determined.
 func Bit(path string) string {
-  isarm64 := SearchBytesInFile(path, "5045000064AA", 400)
-  is64 := SearchBytesInFile(path, "504500006486", 400);
-  is32 := SearchBytesInFile(path, "504500004C", 400);
-  if isarm64 {
-	return "arm64";
-  } else if is64 {
-    return "64";
-  } else if is32 {
-    return "32";
-  }
-  return "?";
-}
-
-func Validate(str string) (string){
-  if str == "" {
-    str = strings.ToLower(os.Getenv("PROCESSOR_ARCHITECTURE"))
-  }
-  if strings.Contains(str, "arm64") {
-	  return "arm64"
-  }
-  if strings.Contains(str, "64") {
-    return "64"
-  } 
-  return "32"
+	img, err := Detect(path)
+	if err != nil {
+		return "?"
+	}
+
+	switch img.Arch {
+	case ARM64, ARM64EC:
+		return "arm64"
+	case X64:
+		return "64"
+	case X86:
+		return "32"
+	}
+	return "?"
+}
+
+// Parse converts any common spelling of an architecture into an
+// Architecture. nvm settings use "32", "64" and "arm64", while users also
+// type the Node.js (x86, ia32, x64, arm64), Windows (amd64) and Linux
+// (aarch64, x86_64) names.
+func Parse(str string) (Architecture, error) {
+	switch strings.ToLower(strings.TrimSpace(str)) {
+	case "32", "x86", "ia32", "i386", "i686", "386", "win32", "32-bit":
+		return X86, nil
+	case "64", "x64", "amd64", "x86_64", "x86-64", "64-bit":
+		return X64, nil
+	case "arm64", "aarch64", "arm64-bit":
+		return ARM64, nil
+	case "arm64ec":
+		return ARM64EC, nil
+	}
+
+	return Unknown, fmt.Errorf("\"%s\" is not a valid CPU architecture. Must be 32 (x86), 64 (x64), or arm64.", str)
+}
+
+// Bits returns the architecture in the format stored in nvm settings and
+// used to name legacy multi-architecture executables ("32", "64", "arm64").
+func (a Architecture) Bits() string {
+	switch a {
+	case X86:
+		return "32"
+	case X64:
+		return "64"
+	case ARM64, ARM64EC:
+		return "arm64"
+	}
+	return "?"
+}
+
+// Label returns a human readable description, such as "64-bit".
+func (a Architecture) Label() string {
+	switch a {
+	case X86:
+		return "32-bit"
+	case X64:
+		return "64-bit"
+	case ARM64:
+		return "arm64"
+	case ARM64EC:
+		return "arm64ec"
+	}
+	return "unknown architecture"
+}
+
+// Dist returns the architecture name used by the Node.js distribution
+// (i.e. node-v20.11.1-win-x64.zip).
+func (a Architecture) Dist() string {
+	switch a {
+	case X86:
+		return "x86"
+	case X64:
+		return "x64"
+	case ARM64, ARM64EC:
+		return "arm64"
+	}
+	return ""
+}
+
+// DistDir returns the distribution subdirectory containing the standalone
+// node.exe for the major version. Node.js 0.x used a different layout.
+func (a Architecture) DistDir(major int64) string {
+	if major > 0 {
+		return "win-" + a.Dist() + "/"
+	}
+
+	if a == X86 {
+		return ""
+	}
+	return a.Dist() + "/"
+}
+
+// Executable returns the file name used to store an inactive node.exe for
+// the architecture within a multi-architecture installation directory
+// (i.e. node-x64.exe). The active architecture is always node.exe.
+func (a Architecture) Executable() string {
+	return "node-" + a.Dist() + ".exe"
+}
+
+// Host returns the native architecture of the operating system, which may
+// differ from the architecture of the running process (i.e. a 32-bit
+// process on a 64-bit OS, or an x64 process emulated on ARM64).
+func Host() Architecture {
+	if a := nativeMachine(); a != Unknown {
+		return a
+	}
+
+	for _, name := range []string{"PROCESSOR_ARCHITEW6432", "PROCESSOR_ARCHITECTURE"} {
+		if a, err := Parse(os.Getenv(name)); err == nil {
+			return a
+		}
+	}
+
+	return X86
+}
+
+// Runnable returns the architectures the host can execute, native first.
+// ARM64 Windows emulates x64 and x86, and x64 Windows runs x86 via WOW64.
+func (a Architecture) Runnable() []Architecture {
+	switch a {
+	case ARM64, ARM64EC:
+		return []Architecture{ARM64, X64, X86}
+	case X64:
+		return []Architecture{X64, X86}
+	}
+	return []Architecture{X86}
+}
+
+// CanRun reports whether the host architecture can execute binaries built
+// for the target architecture, natively or through emulation.
+func (a Architecture) CanRun(target Architecture) bool {
+	for _, r := range a.Runnable() {
+		if r == target {
+			return true
+		}
+	}
+	return false
+}
+
+// Emulated reports whether the host architecture runs binaries built for
+// the target architecture through emulation.
+func (a Architecture) Emulated(target Architecture) bool {
+	return a.CanRun(target) && a.Runnable()[0] != target && !(a == X64 && target == X86)
 }
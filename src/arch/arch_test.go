@@ -0,0 +1,166 @@
+package arch
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fixture builds a minimal PE image: a DOS header pointing to the PE
+// signature, a COFF file header, and an optional header with no sections.
+func fixture(t *testing.T, machine uint16, subsystem uint16, plus bool) []byte {
+	t.Helper()
+
+	var optional interface{}
+	if plus {
+		optional = pe.OptionalHeader64{Magic: 0x20b, Subsystem: subsystem, NumberOfRvaAndSizes: 16}
+	} else {
+		optional = pe.OptionalHeader32{Magic: 0x10b, Subsystem: subsystem, NumberOfRvaAndSizes: 16}
+	}
+
+	dos := make([]byte, 0x40)
+	dos[0], dos[1] = 'M', 'Z'
+	binary.LittleEndian.PutUint32(dos[0x3c:], 0x40)
+
+	buf := bytes.NewBuffer(dos)
+	buf.Write([]byte{'P', 'E', 0, 0})
+	header := pe.FileHeader{
+		Machine:              machine,
+		SizeOfOptionalHeader: uint16(binary.Size(optional)),
+	}
+	if err := binary.Write(buf, binary.LittleEndian, header); err != nil {
+		t.Fatal(err)
+	}
+	if err := binary.Write(buf, binary.LittleEndian, optional); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name      string
+		machine   uint16
+		subsystem uint16
+		plus      bool
+		arch      Architecture
+		bit       string
+	}{
+		{"x86", pe.IMAGE_FILE_MACHINE_I386, pe.IMAGE_SUBSYSTEM_WINDOWS_CUI, false, X86, "32"},
+		{"x64", pe.IMAGE_FILE_MACHINE_AMD64, pe.IMAGE_SUBSYSTEM_WINDOWS_CUI, true, X64, "64"},
+		{"arm64", pe.IMAGE_FILE_MACHINE_ARM64, pe.IMAGE_SUBSYSTEM_WINDOWS_CUI, true, ARM64, "arm64"},
+		{"arm64ec", IMAGE_FILE_MACHINE_ARM64EC, pe.IMAGE_SUBSYSTEM_WINDOWS_GUI, true, ARM64EC, "arm64"},
+		{"arm", pe.IMAGE_FILE_MACHINE_ARMNT, pe.IMAGE_SUBSYSTEM_WINDOWS_GUI, false, ARM, "?"},
+		{"unknown", pe.IMAGE_FILE_MACHINE_RISCV64, pe.IMAGE_SUBSYSTEM_WINDOWS_CUI, true, Unknown, "?"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := fixture(t, test.machine, test.subsystem, test.plus)
+
+			img, err := Read(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.Arch != test.arch {
+				t.Errorf("expected %v, got %v", test.arch, img.Arch)
+			}
+			if img.Machine != test.machine {
+				t.Errorf("expected machine 0x%x, got 0x%x", test.machine, img.Machine)
+			}
+			if img.Subsystem != test.subsystem {
+				t.Errorf("expected subsystem %d, got %d", test.subsystem, img.Subsystem)
+			}
+			if img.PE32Plus != test.plus {
+				t.Errorf("expected PE32+ to be %v", test.plus)
+			}
+
+			path := filepath.Join(t.TempDir(), "node.exe")
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if bit := Bit(path); bit != test.bit {
+				t.Errorf("expected Bit() to return %q, got %q", test.bit, bit)
+			}
+		})
+	}
+}
+
+func TestSubsystemName(t *testing.T) {
+	img := &Image{Subsystem: pe.IMAGE_SUBSYSTEM_WINDOWS_CUI}
+	if img.SubsystemName() != "console" {
+		t.Errorf("expected console, got %s", img.SubsystemName())
+	}
+}
+
+func TestInvalidImage(t *testing.T) {
+	if _, err := Read(bytes.NewReader([]byte("not an executable"))); err == nil {
+		t.Error("expected an error parsing a non-PE file")
+	}
+
+	path := filepath.Join(t.TempDir(), "missing.exe")
+	if _, err := Detect(path); err == nil {
+		t.Error("expected an error detecting a missing file")
+	}
+	if bit := Bit(path); bit != "?" {
+		t.Errorf("expected ?, got %s", bit)
+	}
+}
+
+func TestParseArchitecture(t *testing.T) {
+	tests := map[string]Architecture{
+		"32":      X86,
+		"x86":     X86,
+		"ia32":    X86,
+		"64":      X64,
+		"x64":     X64,
+		"AMD64":   X64,
+		"arm64":   ARM64,
+		"aarch64": ARM64,
+	}
+
+	for input, expected := range tests {
+		a, err := Parse(input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", input, err)
+		}
+		if a != expected {
+			t.Errorf("%s: expected %v, got %v", input, expected, a)
+		}
+	}
+
+	if _, err := Parse("all"); err == nil {
+		t.Error("expected an error for an invalid architecture")
+	}
+}
+
+func TestNames(t *testing.T) {
+	if X64.Dist() != "x64" || X86.Dist() != "x86" || ARM64.Dist() != "arm64" {
+		t.Error("unexpected distribution name")
+	}
+	if X64.Bits() != "64" || X86.Bits() != "32" || ARM64.Bits() != "arm64" {
+		t.Error("unexpected settings name")
+	}
+	if X64.DistDir(20) != "win-x64/" || X86.DistDir(0) != "" || X64.DistDir(0) != "x64/" {
+		t.Error("unexpected distribution directory")
+	}
+}
+
+func TestRunnable(t *testing.T) {
+	if !ARM64.CanRun(X64) || !ARM64.Emulated(X64) {
+		t.Error("expected arm64 hosts to run x64 under emulation")
+	}
+	if ARM64.Emulated(ARM64) {
+		t.Error("expected arm64 hosts to run arm64 natively")
+	}
+	if !X64.CanRun(X86) || X64.Emulated(X86) {
+		t.Error("expected x64 hosts to run x86 natively (WOW64)")
+	}
+	if X64.CanRun(ARM64) || X86.CanRun(X64) {
+		t.Error("unexpected architecture support")
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !windows
+
+package arch
+
+func nativeMachine() Architecture {
+	return Unknown
+}
@@ -0,0 +1,14 @@
+package arch
+
+import "golang.org/x/sys/windows"
+
+// nativeMachine asks Windows for the native machine type, which remains
+// accurate when the process itself runs under emulation.
+func nativeMachine() Architecture {
+	var process, native uint16
+	if err := windows.IsWow64Process2(windows.CurrentProcess(), &process, &native); err != nil {
+		return Unknown
+	}
+
+	return machine(native)
+}
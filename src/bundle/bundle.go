@@ -0,0 +1,327 @@
+package bundle
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"nvm/exit"
+	"nvm/file"
+	"nvm/journal"
+	"nvm/node"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blang/semver"
+)
+
+// A bundle is a zip archive of installed versions that can be moved to a
+// computer without network access:
+//
+//	nvm-bundle.json              metadata index
+//	checksums/v20.11.1.sha256    SHA-256 checksum of every file of a version
+//	v20.11.1/...                 the installation directory
+const Index = "nvm-bundle.json"
+
+// Format is incremented when the layout changes incompatibly.
+const Format = 1
+
+type Version struct {
+	Version       string      `json:"version"`
+	Architectures []string    `json:"architectures"`
+	Source        node.Source `json:"source"`
+	Files         int         `json:"files"`
+	Size          int64       `json:"size"`
+	Checksums     string      `json:"checksums"`
+}
+
+type Metadata struct {
+	Format   int       `json:"format"`
+	Created  time.Time `json:"created"`
+	Versions []Version `json:"versions"`
+}
+
+// Result describes what Unpack did with a version of the bundle.
+type Result struct {
+	Version string
+	// Exists is true when the version was already installed and skipped.
+	Exists bool
+	Err    error
+}
+
+// Pack writes the installed versions (without a "v" prefix) to a bundle.
+func Pack(root string, versions []string, out string) (*Metadata, error) {
+	meta := &Metadata{Format: Format, Created: time.Now().UTC(), Versions: make([]Version, 0)}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	fail := func(err error) (*Metadata, error) {
+		w.Close()
+		f.Close()
+		os.Remove(out)
+		return nil, err
+	}
+
+	for _, version := range versions {
+		dir := filepath.Join(root, "v"+version)
+		if !file.Exists(filepath.Join(dir, "node.exe")) {
+			return fail(exit.Errorf(exit.ErrNotFound, "node v%s is not installed", version))
+		}
+
+		sums, count, size, err := checksums(dir)
+		if err != nil {
+			return fail(err)
+		}
+
+		entry := Version{
+			Version:       version,
+			Architectures: make([]string, 0),
+			Source:        node.GetSource(dir),
+			Files:         count,
+			Size:          size,
+			Checksums:     checksumPath(version),
+		}
+		for _, a := range node.Architectures(dir) {
+			entry.Architectures = append(entry.Architectures, a.String())
+		}
+
+		if err := write(w, entry.Checksums, []byte(sums)); err != nil {
+			return fail(err)
+		}
+		if err := file.AddDirectory(w, dir, "v"+version+"/"); err != nil {
+			return fail(err)
+		}
+
+		meta.Versions = append(meta.Versions, entry)
+	}
+
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fail(err)
+	}
+	if err := write(w, Index, data); err != nil {
+		return fail(err)
+	}
+
+	if err := w.Close(); err != nil {
+		return fail(err)
+	}
+
+	return meta, nil
+}
+
+// Read returns the metadata index of a bundle without extracting it.
+func Read(path string) (*Metadata, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if f.Name != Index {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+
+		meta := &Metadata{}
+		if err := json.NewDecoder(rc).Decode(meta); err != nil {
+			return nil, exit.Errorf(exit.ErrIntegrity, "invalid bundle index: %v", err)
+		}
+		if meta.Format > Format {
+			return nil, fmt.Errorf("%s was created by a newer release of nvm (bundle format %d)", path, meta.Format)
+		}
+
+		// The index is untrusted, and its versions become paths in the nvm root
+		for _, entry := range meta.Versions {
+			if _, err := semver.Make(entry.Version); err != nil {
+				return nil, exit.Errorf(exit.ErrIntegrity, "invalid bundle index: \"%s\" is not a version", entry.Version)
+			}
+			if entry.Checksums != checksumPath(entry.Version) {
+				return nil, exit.Errorf(exit.ErrIntegrity, "invalid bundle index: the checksums of node v%s must be %s", entry.Version, checksumPath(entry.Version))
+			}
+		}
+
+		return meta, nil
+	}
+
+	return nil, exit.Errorf(exit.ErrIntegrity, "%s is not an nvm bundle (missing %s)", path, Index)
+}
+
+// Unpack verifies every version of a bundle and installs the ones that are
+// not installed yet. Each version is committed through the install journal,
+// so it only appears in root once it has been verified.
+func Unpack(path string, root string) ([]Result, error) {
+	meta, err := Read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Extract into the staging area, so versions can be renamed into a
+	// transaction and a crash leaves nothing in the root
+	tmp, err := journal.Scratch(root)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		os.RemoveAll(tmp)
+		os.Remove(filepath.Dir(tmp))
+	}()
+
+	if err := file.Unzip(path, tmp); err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, 0)
+	for _, entry := range meta.Versions {
+		result := Result{Version: entry.Version}
+		if file.Exists(filepath.Join(root, "v"+entry.Version)) {
+			result.Exists = true
+		} else {
+			result.Err = install(tmp, root, entry)
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func install(tmp string, root string, entry Version) error {
+	dir := filepath.Join(tmp, "v"+entry.Version)
+	if err := verify(dir, filepath.Join(tmp, filepath.FromSlash(entry.Checksums))); err != nil {
+		return err
+	}
+
+	for _, name := range entry.Architectures {
+		found := false
+		for _, a := range node.Architectures(dir) {
+			found = found || a.String() == name
+		}
+		if !found {
+			return exit.Errorf(exit.ErrIntegrity, "the %s executable of node v%s is missing from the bundle", name, entry.Version)
+		}
+	}
+
+	tx, err := journal.Begin(root, entry.Version)
+	if err != nil {
+		return err
+	}
+
+	os.Remove(tx.Staging())
+	if err := os.Rename(dir, tx.Staging()); err != nil {
+		tx.Abort()
+		return err
+	}
+	tx.Record(journal.Node)
+	tx.Record(journal.Npm)
+
+	if err := tx.Commit(); err != nil {
+		tx.Abort()
+		return err
+	}
+
+	return nil
+}
+
+// checksumPath is the path of the checksum list of a version in a bundle.
+func checksumPath(version string) string {
+	return "checksums/v" + version + ".sha256"
+}
+
+// checksums lists the SHA-256 checksum of every file within dir, in the
+// SHASUMS256.txt format with paths relative to dir.
+func checksums(dir string) (string, int, int64, error) {
+	lines := make([]string, 0)
+	var size int64
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+
+		sum, err := file.SHA256(path)
+		if err != nil {
+			return err
+		}
+
+		rel, _ := filepath.Rel(dir, path)
+		lines = append(lines, sum+"  "+filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	sort.Strings(lines)
+	return strings.Join(lines, "\n") + "\n", len(lines), size, nil
+}
+
+// verify compares the files of an extracted version with its checksum
+// list. Missing, modified and unexpected files are all errors.
+func verify(dir string, sums string) error {
+	data, err := os.ReadFile(sums)
+	if err != nil {
+		return exit.Errorf(exit.ErrIntegrity, "missing checksums for %s: %v", filepath.Base(dir), err)
+	}
+
+	expected := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.SplitN(line, "  ", 2)
+		if len(fields) == 2 {
+			expected[fields[1]] = fields[0]
+		}
+	}
+
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, _ := filepath.Rel(dir, path)
+		rel = filepath.ToSlash(rel)
+		sum, listed := expected[rel]
+		if !listed {
+			return exit.Errorf(exit.ErrIntegrity, "%s/%s is not listed in the bundle checksums", filepath.Base(dir), rel)
+		}
+		delete(expected, rel)
+
+		return file.VerifyChecksum(path, sum)
+	})
+	if err != nil {
+		return err
+	}
+
+	for rel := range expected {
+		return exit.Errorf(exit.ErrIntegrity, "%s/%s is missing from the bundle", filepath.Base(dir), rel)
+	}
+
+	return nil
+}
+
+func write(w *zip.Writer, name string, data []byte) error {
+	out, err := w.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
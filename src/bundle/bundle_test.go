@@ -0,0 +1,208 @@
+package bundle
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"io"
+	"nvm/exit"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeInstall creates a fake installation of version under root.
+func fakeInstall(t *testing.T, root string, version string) {
+	t.Helper()
+
+	for name, content := range map[string]string{
+		"node.exe":                        "node",
+		"node-x64.exe":                    "node",
+		"npm.cmd":                         "@echo off",
+		"node_modules/npm/package.json":   `{"name":"npm"}`,
+		"node_modules/npm/bin/npm-cli.js": "// npm",
+	} {
+		path := filepath.Join(root, "v"+version, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// pack writes a bundle of a fake installation of version.
+func pack(t *testing.T, version string) string {
+	t.Helper()
+
+	root := t.TempDir()
+	fakeInstall(t, root, version)
+	out := filepath.Join(t.TempDir(), "nvm-bundle.zip")
+	if _, err := Pack(root, []string{version}, out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// rewrite copies a bundle, passing every file through edit and adding the
+// extra files. Files for which edit returns false are left out.
+func rewrite(t *testing.T, src string, edit func(name string, data []byte) ([]byte, bool), extra map[string]string) string {
+	t.Helper()
+
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	dst := filepath.Join(t.TempDir(), "nvm-bundle.zip")
+	f, err := os.Create(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for _, entry := range r.File {
+		rc, err := entry.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+
+		if data, keep := edit(entry.Name, data); keep {
+			if err := write(w, entry.Name, data); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for name, content := range extra {
+		if err := write(w, name, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return dst
+}
+
+func TestRoundTrip(t *testing.T) {
+	path := pack(t, "20.11.1")
+
+	meta, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(meta.Versions) != 1 || meta.Versions[0].Files != 5 || len(meta.Versions[0].Architectures) != 1 {
+		t.Fatalf("unexpected index %+v", meta.Versions)
+	}
+
+	root := t.TempDir()
+	results, err := Unpack(path, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Err != nil || results[0].Exists {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	if content, err := os.ReadFile(filepath.Join(root, "v20.11.1", "node_modules", "npm", "bin", "npm-cli.js")); err != nil || string(content) != "// npm" {
+		t.Errorf("npm was not unpacked: %q (%v)", content, err)
+	}
+
+	// Unpacking again skips the installed version
+	results, err = Unpack(path, root)
+	if err != nil || len(results) != 1 || !results[0].Exists {
+		t.Errorf("unexpected results %+v (%v)", results, err)
+	}
+
+	// Nothing is left in the root but the version
+	if entries, _ := os.ReadDir(root); len(entries) != 1 {
+		t.Errorf("unexpected files in the root: %v", entries)
+	}
+}
+
+func TestUnpackRejectsDamagedVersions(t *testing.T) {
+	path := pack(t, "20.11.1")
+	keep := func(name string, data []byte) ([]byte, bool) {
+		return data, true
+	}
+
+	tests := []struct {
+		name  string
+		edit  func(name string, data []byte) ([]byte, bool)
+		extra map[string]string
+	}{
+		{"tampered file", func(name string, data []byte) ([]byte, bool) {
+			if name == "v20.11.1/npm.cmd" {
+				return []byte("@echo on"), true
+			}
+			return data, true
+		}, nil},
+		{"missing file", func(name string, data []byte) ([]byte, bool) {
+			return data, name != "v20.11.1/node_modules/npm/package.json"
+		}, nil},
+		{"unexpected file", keep, map[string]string{"v20.11.1/extra.js": "// extra"}},
+	}
+
+	for _, test := range tests {
+		root := t.TempDir()
+		results, err := Unpack(rewrite(t, path, test.edit, test.extra), root)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if len(results) != 1 || !errors.Is(results[0].Err, exit.ErrIntegrity) {
+			t.Errorf("%s: expected an integrity error, got %+v", test.name, results)
+		}
+		if _, err := os.Stat(filepath.Join(root, "v20.11.1")); !os.IsNotExist(err) {
+			t.Errorf("%s: the damaged version was installed", test.name)
+		}
+	}
+}
+
+func TestUnpackRejectsMaliciousIndex(t *testing.T) {
+	path := pack(t, "20.11.1")
+
+	tests := []struct {
+		version   string
+		checksums string
+	}{
+		{"1/../../../x", "checksums/v1/../../../x.sha256"},
+		{"..", "checksums/v...sha256"},
+		{"20.11.1", "../../checksums.sha256"},
+		{"20.11.1", "checksums/v18.0.0.sha256"},
+	}
+
+	for _, test := range tests {
+		bundle := rewrite(t, path, func(name string, data []byte) ([]byte, bool) {
+			if name != Index {
+				return data, true
+			}
+			meta := &Metadata{}
+			json.Unmarshal(data, meta)
+			meta.Versions[0].Version = test.version
+			meta.Versions[0].Checksums = test.checksums
+			data, _ = json.Marshal(meta)
+			return data, true
+		}, nil)
+
+		parent := t.TempDir()
+		root := filepath.Join(parent, "a", "b", "root")
+		os.MkdirAll(root, os.ModePerm)
+
+		if _, err := Unpack(bundle, root); !errors.Is(err, exit.ErrIntegrity) {
+			t.Errorf("%q (%s): expected an integrity error, got %v", test.version, test.checksums, err)
+		}
+		filepath.Walk(parent, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !strings.HasPrefix(root, path) && !strings.HasPrefix(path, root) {
+				t.Errorf("%q: %s was written outside of the root", test.version, path)
+			}
+			return nil
+		})
+	}
+}
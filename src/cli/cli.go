@@ -0,0 +1,315 @@
+// Package cli parses the nvm command line: a command, followed by its
+// positional arguments and flags in any order. It also produces the help
+// text of the commands and the candidates for shell completion.
+package cli
+
+import (
+	"fmt"
+	"nvm/exit"
+	"sort"
+	"strings"
+)
+
+// Flag is an option of a command, or a global option of every command.
+type Flag struct {
+	// Name is the long name, without dashes (i.e. "insecure").
+	Name string
+	// Short is an optional single letter alias (i.e. "y" for -y).
+	Short string
+	// Value names the value of the flag in help text (i.e. "file"). Flags
+	// without one are switches.
+	Value string
+	// Optional allows the flag to be used as a switch. A value must then be
+	// attached with = (i.e. --wait or --wait=10).
+	Optional bool
+	Usage    string
+	// Complete returns the candidates for the value, for shell completion.
+	Complete func() []string
+}
+
+// Command describes a command and its arguments.
+type Command struct {
+	Name    string
+	Aliases []string
+	// Args describes the positional arguments in usage lines (i.e.
+	// "<version> [arch]").
+	Args string
+	// Summary describes the command, one entry per line.
+	Summary []string
+	Flags   []Flag
+	// MinArgs and MaxArgs limit the number of positional arguments. A
+	// negative MaxArgs allows any number.
+	MinArgs int
+	MaxArgs int
+	// Literal passes the arguments following the first LiteralAfter
+	// positional arguments to the command unchanged, flags included (i.e.
+	// the command run by nvm exec).
+	Literal      bool
+	LiteralAfter int
+	// JSON is true when the command supports the global --json flag.
+	JSON bool
+	// Hidden commands are not listed in help text or completions.
+	Hidden bool
+	// Complete returns the candidates for the next positional argument,
+	// given the arguments before it, for shell completion.
+	Complete func(args []string) []string
+}
+
+// Usage returns the usage line of the command (i.e. "install <version> [arch]").
+func (c *Command) Usage() string {
+	if c.Args == "" {
+		return c.Name
+	}
+	return c.Name + " " + c.Args
+}
+
+// Flag returns the flag of the command with the given long or short name.
+func (c *Command) Flag(name string) *Flag {
+	return lookupFlag(c.Flags, name)
+}
+
+// App is the set of commands of a program.
+type App struct {
+	Name     string
+	Commands []*Command
+	// Flags are accepted by every command.
+	Flags []Flag
+}
+
+// Lookup returns the command with the given name or alias, or nil.
+func (a *App) Lookup(name string) *Command {
+	for _, c := range a.Commands {
+		if c.Name == name {
+			return c
+		}
+		for _, alias := range c.Aliases {
+			if alias == name {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// UsageError is returned for command lines that cannot be parsed. Command
+// is nil when the command itself is unknown.
+type UsageError struct {
+	Command *Command
+	Message string
+}
+
+func (e *UsageError) Error() string {
+	return e.Message
+}
+
+func (e *UsageError) Is(target error) bool {
+	return target == exit.ErrUsage
+}
+
+// Invocation is a parsed command line.
+type Invocation struct {
+	// Command is nil when no command was given.
+	Command *Command
+	// Args are the positional arguments.
+	Args  []string
+	flags map[string]string
+}
+
+// Has returns true when the flag was given.
+func (i *Invocation) Has(name string) bool {
+	_, ok := i.flags[name]
+	return ok
+}
+
+// Value returns the value of a flag, or an empty string.
+func (i *Invocation) Value(name string) string {
+	return i.flags[name]
+}
+
+// Arg returns a positional argument, or an empty string when there are
+// fewer arguments.
+func (i *Invocation) Arg(n int) string {
+	if n < len(i.Args) {
+		return i.Args[n]
+	}
+	return ""
+}
+
+// Parse parses the arguments following the program name. Flags may appear
+// anywhere, as --name value, --name=value or -s. Everything after -- is
+// positional. Global flags may precede the command.
+func (a *App) Parse(args []string) (*Invocation, error) {
+	inv := &Invocation{Args: make([]string, 0), flags: make(map[string]string)}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if inv.Command == nil {
+			// Commands may be spelled like flags (i.e. --version)
+			if c := a.Lookup(arg); c != nil {
+				inv.Command = c
+				continue
+			}
+			if !strings.HasPrefix(arg, "-") {
+				return nil, &UsageError{Message: fmt.Sprintf("\"%s\" is not a valid command.", arg)}
+			}
+		} else if inv.Command.Literal && len(inv.Args) >= inv.Command.LiteralAfter {
+			inv.Args = append(inv.Args, args[i:]...)
+			break
+		}
+
+		if arg == "--" {
+			if inv.Command == nil {
+				return nil, &UsageError{Message: "Provide a command before --."}
+			}
+			inv.Args = append(inv.Args, args[i+1:]...)
+			break
+		}
+
+		if len(arg) < 2 || arg[0] != '-' {
+			inv.Args = append(inv.Args, arg)
+			continue
+		}
+
+		name, value, attached := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		name = strings.ToLower(name)
+		flag := a.flag(inv.Command, name)
+		long := strings.HasPrefix(arg, "--")
+		if flag == nil || (long && name != flag.Name) || (!long && name != flag.Short) {
+			return nil, a.usageError(inv.Command, "unknown flag %s", arg)
+		}
+
+		switch {
+		case flag.Value == "" && attached:
+			return nil, a.usageError(inv.Command, "--%s does not take a value", flag.Name)
+		case flag.Value != "" && !attached && !flag.Optional:
+			if i+1 >= len(args) {
+				return nil, a.usageError(inv.Command, "--%s requires a value (%s)", flag.Name, flag.Value)
+			}
+			i++
+			value = args[i]
+		}
+
+		inv.flags[flag.Name] = value
+	}
+
+	c := inv.Command
+	if c == nil {
+		return inv, nil
+	}
+	if inv.Has("help") {
+		return inv, nil
+	}
+
+	if inv.Has("json") && !c.JSON {
+		return nil, a.usageError(c, "%s %s does not support --json", a.Name, c.Name)
+	}
+
+	if len(inv.Args) < c.MinArgs {
+		return nil, a.usageError(c, "Missing arguments. Usage: %s %s", a.Name, c.Usage())
+	}
+	if c.MaxArgs >= 0 && len(inv.Args) > c.MaxArgs {
+		return nil, a.usageError(c, "Too many arguments (%s). Usage: %s %s", strings.Join(inv.Args[c.MaxArgs:], " "), a.Name, c.Usage())
+	}
+
+	return inv, nil
+}
+
+// Returns the flag of a command or a global flag, by long or short name.
+func (a *App) flag(c *Command, name string) *Flag {
+	if c != nil {
+		if f := c.Flag(name); f != nil {
+			return f
+		}
+	}
+	return lookupFlag(a.Flags, name)
+}
+
+func (a *App) usageError(c *Command, format string, args ...interface{}) error {
+	return &UsageError{Command: c, Message: fmt.Sprintf(format, args...)}
+}
+
+func lookupFlag(flags []Flag, name string) *Flag {
+	for i := range flags {
+		if flags[i].Name == name || (flags[i].Short != "" && flags[i].Short == name) {
+			return &flags[i]
+		}
+	}
+	return nil
+}
+
+// Help returns the list of commands, with the first line of each summary.
+func (a *App) Help() string {
+	var b strings.Builder
+	b.WriteString("Usage:\n\n")
+	for _, c := range a.visible() {
+		fmt.Fprintf(&b, "  %-30s : %s\n", a.Name+" "+c.Usage(), summary(c))
+	}
+	b.WriteString("\nGlobal options:\n\n")
+	writeFlags(&b, a.Flags)
+	fmt.Fprintf(&b, "\nType \"%s <command> --help\" to see the options of a command.\n", a.Name)
+	return b.String()
+}
+
+// CommandHelp returns the description and the flags of a command.
+func (a *App) CommandHelp(c *Command) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Usage: %s %s\n\n", a.Name, c.Usage())
+	for _, line := range c.Summary {
+		b.WriteString("  " + line + "\n")
+	}
+	if len(c.Aliases) > 0 {
+		aliases := make([]string, 0, len(c.Aliases))
+		for _, alias := range c.Aliases {
+			if !strings.HasPrefix(alias, "-") {
+				aliases = append(aliases, alias)
+			}
+		}
+		if len(aliases) > 0 {
+			fmt.Fprintf(&b, "\n  Aliased as %s.\n", strings.Join(aliases, ", "))
+		}
+	}
+	if len(c.Flags) > 0 {
+		b.WriteString("\nOptions:\n\n")
+		writeFlags(&b, c.Flags)
+	}
+	b.WriteString("\nGlobal options:\n\n")
+	writeFlags(&b, a.Flags)
+	return b.String()
+}
+
+// Returns the commands listed in help text, sorted by name.
+func (a *App) visible() []*Command {
+	commands := make([]*Command, 0, len(a.Commands))
+	for _, c := range a.Commands {
+		if !c.Hidden {
+			commands = append(commands, c)
+		}
+	}
+	sort.Slice(commands, func(i, j int) bool {
+		return commands[i].Name < commands[j].Name
+	})
+	return commands
+}
+
+func summary(c *Command) string {
+	if len(c.Summary) == 0 {
+		return ""
+	}
+	return c.Summary[0]
+}
+
+func writeFlags(b *strings.Builder, flags []Flag) {
+	for _, f := range flags {
+		name := "--" + f.Name
+		if f.Short != "" {
+			name = "-" + f.Short + ", " + name
+		}
+		if f.Value != "" && f.Optional {
+			name += "[=<" + f.Value + ">]"
+		} else if f.Value != "" {
+			name += " <" + f.Value + ">"
+		}
+		fmt.Fprintf(b, "  %-30s %s\n", name, f.Usage)
+	}
+}
@@ -0,0 +1,198 @@
+package cli
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testApp() *App {
+	return &App{
+		Name: "nvm",
+		Flags: []Flag{
+			{Name: "help", Short: "h"},
+			{Name: "yes", Short: "y"},
+			{Name: "json"},
+			{Name: "wait", Value: "seconds", Optional: true},
+		},
+		Commands: []*Command{
+			{
+				Name:    "install",
+				Aliases: []string{"i"},
+				Args:    "<version> [arch]",
+				MaxArgs: 2,
+				Flags: []Flag{
+					{Name: "insecure"},
+					{Name: "source", Value: "name", Complete: Words("nightly", "rc")},
+				},
+				Complete: func(args []string) []string {
+					if len(args) == 1 {
+						return []string{"32", "64", "arm64"}
+					}
+					return []string{"latest", "lts"}
+				},
+			},
+			{
+				Name:    "uninstall",
+				Args:    "<version...>",
+				MinArgs: 1,
+				MaxArgs: -1,
+			},
+			{
+				Name:         "exec",
+				MinArgs:      2,
+				MaxArgs:      -1,
+				Literal:      true,
+				LiteralAfter: 1,
+			},
+			{
+				Name:    "version",
+				Aliases: []string{"--version", "-v"},
+				JSON:    true,
+			},
+		},
+	}
+}
+
+func TestParseFlagsAnywhere(t *testing.T) {
+	for _, args := range [][]string{
+		{"install", "--insecure", "18", "64"},
+		{"install", "18", "--insecure", "64"},
+		{"install", "18", "64", "--insecure"},
+		{"i", "18", "64", "--INSECURE"},
+	} {
+		inv, err := testApp().Parse(args)
+		if err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+		if inv.Command.Name != "install" || !inv.Has("insecure") || !reflect.DeepEqual(inv.Args, []string{"18", "64"}) {
+			t.Errorf("%v: got %s %v insecure=%v", args, inv.Command.Name, inv.Args, inv.Has("insecure"))
+		}
+	}
+}
+
+func TestParseValues(t *testing.T) {
+	for _, args := range [][]string{
+		{"install", "--source", "nightly", "20"},
+		{"install", "--source=nightly", "20"},
+	} {
+		inv, err := testApp().Parse(args)
+		if err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+		if inv.Value("source") != "nightly" || inv.Arg(0) != "20" || inv.Arg(1) != "" {
+			t.Errorf("%v: got source=%q args=%v", args, inv.Value("source"), inv.Args)
+		}
+	}
+
+	inv, err := testApp().Parse([]string{"uninstall", "18", "--wait", "-y"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !inv.Has("wait") || inv.Value("wait") != "" || !inv.Has("yes") || !reflect.DeepEqual(inv.Args, []string{"18"}) {
+		t.Errorf("optional value: got wait=%v(%q) yes=%v args=%v", inv.Has("wait"), inv.Value("wait"), inv.Has("yes"), inv.Args)
+	}
+
+	inv, err = testApp().Parse([]string{"uninstall", "--wait=10", "18"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.Value("wait") != "10" {
+		t.Errorf("--wait=10: got %q", inv.Value("wait"))
+	}
+}
+
+func TestParseDoubleDash(t *testing.T) {
+	inv, err := testApp().Parse([]string{"uninstall", "--", "--weird", "-y"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.Has("yes") || !reflect.DeepEqual(inv.Args, []string{"--weird", "-y"}) {
+		t.Errorf("got args %v yes=%v", inv.Args, inv.Has("yes"))
+	}
+}
+
+func TestParseLiteral(t *testing.T) {
+	inv, err := testApp().Parse([]string{"exec", "-y", "18", "npm", "--version", "--", "-h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !inv.Has("yes") || inv.Has("help") || !reflect.DeepEqual(inv.Args, []string{"18", "npm", "--version", "--", "-h"}) {
+		t.Errorf("got args %v", inv.Args)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		args    []string
+		message string
+	}{
+		{[]string{"instal"}, `"instal" is not a valid command.`},
+		{[]string{"install", "--insecur"}, "unknown flag --insecur"},
+		{[]string{"install", "-insecure"}, "unknown flag -insecure"},
+		{[]string{"install", "--yes=1"}, "--yes does not take a value"},
+		{[]string{"install", "20", "--source"}, "--source requires a value (name)"},
+		{[]string{"install", "20", "64", "extra"}, "Too many arguments (extra)"},
+		{[]string{"install", "--json"}, "nvm install does not support --json"},
+		{[]string{"uninstall"}, "Missing arguments"},
+		{[]string{"exec", "18"}, "Missing arguments"},
+	} {
+		_, err := testApp().Parse(tc.args)
+		var usage *UsageError
+		if !errors.As(err, &usage) {
+			t.Errorf("%v: expected a usage error, got %v", tc.args, err)
+			continue
+		}
+		if !strings.HasPrefix(usage.Message, tc.message) {
+			t.Errorf("%v: got %q, expected %q", tc.args, usage.Message, tc.message)
+		}
+	}
+}
+
+func TestParseHelpAndAliases(t *testing.T) {
+	// --help skips argument validation
+	inv, err := testApp().Parse([]string{"uninstall", "--help"})
+	if err != nil || !inv.Has("help") || inv.Command.Name != "uninstall" {
+		t.Errorf("uninstall --help: %v", err)
+	}
+
+	inv, err = testApp().Parse([]string{"--version"})
+	if err != nil || inv.Command.Name != "version" {
+		t.Errorf("--version: %v", err)
+	}
+
+	inv, err = testApp().Parse([]string{"-y", "uninstall", "18"})
+	if err != nil || inv.Command.Name != "uninstall" || !inv.Has("yes") {
+		t.Errorf("global flag before the command: %v", err)
+	}
+
+	inv, err = testApp().Parse([]string{"-h"})
+	if err != nil || inv.Command != nil || !inv.Has("help") {
+		t.Errorf("-h: %v", err)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	app := testApp()
+	for _, tc := range []struct {
+		words    []string
+		current  string
+		expected []string
+	}{
+		{nil, "", []string{"exec", "install", "uninstall", "version"}},
+		{nil, "un", []string{"uninstall"}},
+		{[]string{"install"}, "", []string{"latest", "lts"}},
+		{[]string{"install", "20"}, "", []string{"32", "64", "arm64"}},
+		{[]string{"install", "20"}, "--s", []string{"--source"}},
+		{[]string{"install", "--source"}, "n", []string{"nightly"}},
+		{[]string{"install", "--source", "rc"}, "l", []string{"latest", "lts"}},
+		{[]string{"i"}, "--", []string{"--insecure", "--source", "--help", "--yes", "--json", "--wait"}},
+		{[]string{"exec", "18"}, "", []string{}},
+	} {
+		got := app.Complete(tc.words, tc.current)
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%v %q: got %v, expected %v", tc.words, tc.current, got, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"strings"
+)
+
+// Complete returns the completion candidates for the word being typed,
+// given the words before it (the program name excluded). Candidates are
+// filtered by the typed prefix.
+func (a *App) Complete(words []string, current string) []string {
+	var c *Command
+	args := make([]string, 0)
+	var pending *Flag
+
+	for _, word := range words {
+		if c == nil {
+			c = a.Lookup(word)
+			continue
+		}
+		switch {
+		case pending != nil:
+			pending = nil
+		case strings.HasPrefix(word, "-"):
+			name, _, attached := strings.Cut(strings.TrimLeft(word, "-"), "=")
+			if f := a.flag(c, strings.ToLower(name)); f != nil && f.Value != "" && !f.Optional && !attached {
+				pending = f
+			}
+		default:
+			args = append(args, word)
+		}
+	}
+
+	// Arguments of the command nvm runs (i.e. nvm exec) are not completed
+	if c != nil && c.Literal && len(args) >= c.LiteralAfter {
+		return []string{}
+	}
+
+	candidates := make([]string, 0)
+	switch {
+	case pending != nil:
+		if pending.Complete != nil {
+			candidates = pending.Complete()
+		}
+	case strings.HasPrefix(current, "-"):
+		if c != nil {
+			candidates = append(candidates, flagNames(c.Flags)...)
+		}
+		candidates = append(candidates, flagNames(a.Flags)...)
+	case c == nil:
+		for _, cmd := range a.visible() {
+			candidates = append(candidates, cmd.Name)
+		}
+	case c.Complete != nil && (c.MaxArgs < 0 || len(args) < c.MaxArgs):
+		candidates = c.Complete(args)
+	}
+
+	return filter(candidates, current)
+}
+
+// Words returns a completion function for a fixed list of candidates.
+func Words(words ...string) func() []string {
+	return func() []string {
+		return words
+	}
+}
+
+func flagNames(flags []Flag) []string {
+	names := make([]string, 0, len(flags))
+	for _, f := range flags {
+		names = append(names, "--"+f.Name)
+	}
+	return names
+}
+
+// Returns the distinct candidates starting with the prefix (ignoring case).
+func filter(candidates []string, prefix string) []string {
+	result := make([]string, 0, len(candidates))
+	seen := make(map[string]bool)
+	for _, candidate := range candidates {
+		if seen[candidate] || !strings.HasPrefix(strings.ToLower(candidate), strings.ToLower(prefix)) {
+			continue
+		}
+		seen[candidate] = true
+		result = append(result, candidate)
+	}
+	return result
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"nvm/file"
+	"nvm/shim"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+)
+
+// nvm-shim is copied to the NVM_SYMLINK directory as node.exe, and called
+// by npm.cmd, npx.cmd and the launchers of global package executables, when
+// nvm uses shim activation. It runs the version selected for the session,
+// the project or globally (see shim), passing through the arguments, stdio
+// and exit code.
+func main() {
+	exe, _ := os.Executable()
+	name := strings.TrimSuffix(strings.ToLower(filepath.Base(exe)), ".exe")
+	args := os.Args[1:]
+
+	if name == strings.TrimSuffix(shim.Executable, ".exe") {
+		if len(args) == 0 {
+			fail(errors.New("usage: nvm-shim <node|npm|npx|executable> [args]"))
+		}
+		name, args = args[0], args[1:]
+	}
+
+	settings, err := file.ReadSettings(filepath.Join(os.Getenv("NVM_HOME"), "settings.txt"))
+	if err != nil {
+		fail(fmt.Errorf("cannot read the nvm settings (is NVM_HOME set?): %v", err))
+	}
+
+	cwd, _ := os.Getwd()
+	r, err := shim.Resolve(filepath.Clean(settings["root"]), cwd, settings["default_version"])
+	if err != nil {
+		fail(err)
+	}
+
+	cmd, err := r.Command(name, args...)
+	if err != nil {
+		fail(err)
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// The child shares the console and handles Ctrl+C itself
+	signal.Ignore(os.Interrupt)
+
+	err = cmd.Run()
+
+	// Installing or removing global packages changes their executables
+	if name == "npm" && shim.IsGlobal(args) {
+		shim.Refresh(filepath.Dir(exe), filepath.Clean(settings["root"]))
+	}
+
+	if err != nil {
+		var exiterr *exec.ExitError
+		if errors.As(err, &exiterr) {
+			os.Exit(exiterr.ExitCode())
+		}
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "nvm: %v\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,186 @@
+package du
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/blang/semver"
+)
+
+// Installation describes the disk footprint of a single node installation.
+type Installation struct {
+	Version  string `json:"version"`
+	Path     string `json:"path"`
+	Npm      int64  `json:"npm"`
+	Globals  int64  `json:"globals"`
+	Corepack int64  `json:"corepack"`
+	Other    int64  `json:"other"`
+	Total    int64  `json:"total"`
+}
+
+// Entry describes the disk footprint of a directory (or set of directories)
+// that is not an installation, such as caches and temporary files.
+type Entry struct {
+	Name  string   `json:"name"`
+	Paths []string `json:"paths"`
+	Size  int64    `json:"size"`
+}
+
+type Report struct {
+	Installations []Installation `json:"installations"`
+	Other         []Entry        `json:"other"`
+	Total         int64          `json:"total"`
+}
+
+// Size returns the cumulative size of all files within the path. Symlinks
+// and junctions are not followed, so linked content is never counted twice.
+// A path that does not exist has a size of 0.
+func Size(path string) (int64, error) {
+	var total int64
+
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if d.Type()&fs.ModeSymlink != 0 && p != path {
+			return nil
+		}
+
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+		}
+
+		return nil
+	})
+
+	return total, err
+}
+
+// Scan measures every installation within the root directory.
+func Scan(root string) ([]Installation, error) {
+	installations := make([]Installation, 0)
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return installations, err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), "v") {
+			continue
+		}
+
+		if _, err := semver.Make(strings.TrimPrefix(entry.Name(), "v")); err != nil {
+			continue
+		}
+
+		installation, err := Measure(filepath.Join(root, entry.Name()))
+		if err != nil {
+			return installations, err
+		}
+
+		installations = append(installations, installation)
+	}
+
+	sort.Slice(installations, func(i, j int) bool {
+		a, _ := semver.Make(strings.TrimPrefix(installations[i].Version, "v"))
+		b, _ := semver.Make(strings.TrimPrefix(installations[j].Version, "v"))
+		return a.GT(b)
+	})
+
+	return installations, nil
+}
+
+// Measure calculates the size of an installation directory, breaking out
+// npm, corepack, and globally installed modules.
+func Measure(dir string) (Installation, error) {
+	installation := Installation{
+		Version: filepath.Base(dir),
+		Path:    dir,
+	}
+
+	total, err := Size(dir)
+	if err != nil {
+		return installation, err
+	}
+	installation.Total = total
+
+	modules := filepath.Join(dir, "node_modules")
+	entries, err := os.ReadDir(modules)
+	if err != nil && !os.IsNotExist(err) {
+		return installation, err
+	}
+
+	for _, entry := range entries {
+		size, err := Size(filepath.Join(modules, entry.Name()))
+		if err != nil {
+			return installation, err
+		}
+
+		switch strings.ToLower(entry.Name()) {
+		case "npm":
+			installation.Npm += size
+		case "corepack":
+			installation.Corepack += size
+		default:
+			installation.Globals += size
+		}
+	}
+
+	installation.Other = installation.Total - installation.Npm - installation.Corepack - installation.Globals
+
+	return installation, nil
+}
+
+// Glob measures every path matching the patterns as a single entry.
+func Glob(name string, patterns ...string) (Entry, error) {
+	entry := Entry{Name: name, Paths: []string{}}
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return entry, err
+		}
+
+		for _, match := range matches {
+			size, err := Size(match)
+			if err != nil {
+				return entry, err
+			}
+
+			entry.Paths = append(entry.Paths, match)
+			entry.Size += size
+		}
+	}
+
+	return entry, nil
+}
+
+// NewReport summarizes the installations and other entries.
+func NewReport(installations []Installation, other ...Entry) *Report {
+	report := &Report{
+		Installations: installations,
+		Other:         other,
+	}
+
+	for _, installation := range installations {
+		report.Total += installation.Total
+	}
+
+	for _, entry := range other {
+		report.Total += entry.Size
+	}
+
+	return report
+}
@@ -0,0 +1,104 @@
+package du
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeTree creates files of the given sizes under root.
+func fakeTree(t *testing.T, root string, files map[string]int) {
+	t.Helper()
+
+	for name, size := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(strings.Repeat("x", size)), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]int
+		want  Installation
+	}{
+		{"npm only", map[string]int{
+			"node.exe":                        100,
+			"node_modules/npm/package.json":   10,
+			"node_modules/npm/bin/npm-cli.js": 20,
+		}, Installation{Npm: 30, Other: 100, Total: 130}},
+		{"globals and corepack", map[string]int{
+			"node.exe":                             100,
+			"npm.cmd":                              5,
+			"node_modules/npm/package.json":        10,
+			"node_modules/corepack/package.json":   7,
+			"node_modules/Corepack/dist/a.js":      3,
+			"node_modules/typescript/lib/tsc.js":   50,
+			"node_modules/@scope/pkg/package.json": 8,
+		}, Installation{Npm: 10, Globals: 58, Corepack: 10, Other: 105, Total: 183}},
+		{"no node_modules", map[string]int{
+			"node.exe": 100,
+		}, Installation{Other: 100, Total: 100}},
+	}
+
+	for _, test := range tests {
+		dir := filepath.Join(t.TempDir(), "v20.11.1")
+		fakeTree(t, dir, test.files)
+
+		got, err := Measure(dir)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		test.want.Version = "v20.11.1"
+		test.want.Path = dir
+		if got != test.want {
+			t.Errorf("%s: Measure() = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	root := t.TempDir()
+	fakeTree(t, root, map[string]int{
+		"v18.19.1/node.exe":  10,
+		"v20.11.1/node.exe":  20,
+		"v9.11.2/node.exe":   30,
+		"vnext/node.exe":     40,
+		".staging/node.exe":  50,
+		"temp/npm-v10.2.zip": 60,
+	})
+
+	installations, err := Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions := make([]string, 0)
+	for _, installation := range installations {
+		versions = append(versions, installation.Version)
+	}
+	if strings.Join(versions, " ") != "v20.11.1 v18.19.1 v9.11.2" {
+		t.Errorf("Scan() = %v", versions)
+	}
+
+	entry, err := Glob("cache", filepath.Join(root, "temp"), filepath.Join(root, ".lts.json"), filepath.Join(root, "*", "node.exe"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entry.Paths) != 6 || entry.Size != 210 {
+		t.Errorf("Glob() = %+v", entry)
+	}
+
+	report := NewReport(installations, entry)
+	if report.Total != 270 {
+		t.Errorf("NewReport().Total = %d, want 270", report.Total)
+	}
+}
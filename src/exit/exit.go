@@ -0,0 +1,111 @@
+// Package exit defines the exit codes of nvm, and the kinds of errors that
+// map onto them. Errors are classified with errors.Is, so the core packages
+// mark an error by wrapping a kind (see Errorf) or by implementing an Is
+// method that reports its kind.
+package exit
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// Exit codes. Scripts can rely on these values.
+const (
+	// OK means the command succeeded.
+	OK = 0
+	// Failure is any error that is not one of the kinds below.
+	Failure = 1
+	// Usage means the command line is invalid (unknown command or flag,
+	// missing or extra arguments).
+	Usage = 2
+	// Network means a download or a remote lookup failed, or network
+	// access was disabled with --offline.
+	Network = 3
+	// NotFound means a version, alias or file does not exist (remotely or
+	// locally).
+	NotFound = 4
+	// Permission means access was denied, or elevation was refused.
+	Permission = 5
+	// Integrity means a checksum did not match, or an archive or bundle is
+	// incomplete.
+	Integrity = 6
+	// Partial means the command succeeded in part (i.e. node was installed
+	// but a global package was not, or some of several versions could not
+	// be uninstalled).
+	Partial = 7
+)
+
+// The kinds of errors. Use errors.Is to test for them.
+var (
+	ErrUsage      = errors.New("usage error")
+	ErrNetwork    = errors.New("network failure")
+	ErrNotFound   = errors.New("not found")
+	ErrPermission = errors.New("permission denied")
+	ErrIntegrity  = errors.New("integrity failure")
+	ErrPartial    = errors.New("partial success")
+)
+
+// Code returns the exit code for an error. A nil error is OK.
+func Code(err error) int {
+	if err == nil {
+		return OK
+	}
+
+	for _, kind := range []struct {
+		err  error
+		code int
+	}{
+		{ErrUsage, Usage},
+		{ErrPartial, Partial},
+		{ErrIntegrity, Integrity},
+		{ErrPermission, Permission},
+		{fs.ErrPermission, Permission},
+		{ErrNotFound, NotFound},
+		{fs.ErrNotExist, NotFound},
+		{ErrNetwork, Network},
+	} {
+		if errors.Is(err, kind.err) {
+			return kind.code
+		}
+	}
+
+	return Failure
+}
+
+// Error is an error of a kind. Its message is the message of Err.
+type Error struct {
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// New returns an error of a kind with the given message.
+func New(kind error, text string) error {
+	return &Error{Kind: kind, Err: errors.New(text)}
+}
+
+// Errorf formats an error of a kind, like fmt.Errorf.
+func Errorf(kind error, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// Mark returns err as an error of a kind, keeping its message. A nil error
+// stays nil.
+func Mark(kind error, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
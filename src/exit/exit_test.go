@@ -0,0 +1,46 @@
+package exit
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+)
+
+type typed struct{}
+
+func (typed) Error() string { return "typed" }
+
+func (typed) Is(target error) bool { return target == ErrNotFound }
+
+func TestCode(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		code int
+	}{
+		{nil, OK},
+		{errors.New("plain"), Failure},
+		{New(ErrNetwork, "offline"), Network},
+		{fmt.Errorf("wrapped: %w", Errorf(ErrIntegrity, "checksum mismatch for %s", "node.zip")), Integrity},
+		{Mark(ErrUsage, errors.New("unknown flag")), Usage},
+		{typed{}, NotFound},
+		{fmt.Errorf("removing: %w", fs.ErrPermission), Permission},
+		{&fs.PathError{Op: "open", Path: "nvm-bundle.zip", Err: fs.ErrNotExist}, NotFound},
+		// Partial success takes precedence over the cause of the failure
+		{Mark(ErrPartial, New(ErrNetwork, "npm download failed")), Partial},
+	} {
+		if code := Code(tc.err); code != tc.code {
+			t.Errorf("%v: got %d, expected %d", tc.err, code, tc.code)
+		}
+	}
+}
+
+func TestMessage(t *testing.T) {
+	err := Errorf(ErrNotFound, "node v%s is not installed.", "18.0.0")
+	if err.Error() != "node v18.0.0 is not installed." {
+		t.Errorf("got %q", err.Error())
+	}
+	if Mark(ErrNotFound, nil) != nil {
+		t.Error("Mark(nil) should be nil")
+	}
+}
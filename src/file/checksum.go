@@ -0,0 +1,70 @@
+package file
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"nvm/exit"
+	"os"
+	"strings"
+)
+
+// ChecksumError is returned when a file does not match its checksum.
+type ChecksumError struct {
+	Path     string
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch for %s (expected %s, received %s)", e.Path, e.Expected, e.Actual)
+}
+
+func (e *ChecksumError) Is(target error) bool {
+	return target == exit.ErrIntegrity
+}
+
+// SHA256 returns the hex encoded SHA-256 checksum of a file.
+func SHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// LookupChecksum returns the checksum of name in a SHASUMS256.txt style
+// list ("<checksum>  <name>" per line), or an empty string.
+func LookupChecksum(list string, name string) string {
+	for _, line := range strings.Split(list, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0])
+		}
+	}
+
+	return ""
+}
+
+// VerifyChecksum compares the SHA-256 checksum of a file with the expected
+// value.
+func VerifyChecksum(path string, expected string) error {
+	actual, err := SHA256(path)
+	if err != nil {
+		return err
+	}
+
+	if actual != strings.ToLower(expected) {
+		return &ChecksumError{Path: path, Expected: expected, Actual: actual}
+	}
+
+	return nil
+}
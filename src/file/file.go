@@ -78,3 +78,25 @@ func Exists(filename string) bool {
 	_, err := os.Stat(filename)
 	return err == nil
 }
+
+// ReadSettings parses a settings file of "key: value" lines. Environment
+// variables within lines are expanded.
+func ReadSettings(path string) (map[string]string, error) {
+	lines, err := ReadLines(path)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := make(map[string]string)
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		line = os.ExpandEnv(line)
+		res := strings.Split(line, ":")
+		if len(res) < 2 {
+			continue
+		}
+		settings[res[0]] = strings.TrimSpace(strings.Join(res[1:], ":"))
+	}
+
+	return settings, nil
+}
@@ -0,0 +1,42 @@
+package file
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Removed files are first moved into a trash directory on the same volume
+// (a single rename), so a failed operation can put them back untouched.
+const TrashDirectory = ".trash"
+
+// Trash moves path into the trash directory under root and returns its new
+// location.
+func Trash(root string, path string) (string, error) {
+	dir := filepath.Join(root, TrashDirectory)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+
+	trashed := filepath.Join(dir, fmt.Sprintf("%s-%d", filepath.Base(path), time.Now().UnixNano()))
+	if err := os.Rename(path, trashed); err != nil {
+		return "", err
+	}
+
+	return trashed, nil
+}
+
+// Restore moves a trashed path back to its original location.
+func Restore(trashed string, path string) error {
+	if Exists(path) {
+		return fmt.Errorf("cannot restore %s: the path already exists", path)
+	}
+
+	return os.Rename(trashed, path)
+}
+
+// EmptyTrash permanently removes everything in the trash directory under root.
+func EmptyTrash(root string) error {
+	return os.RemoveAll(filepath.Join(root, TrashDirectory))
+}
@@ -0,0 +1,86 @@
+package file
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Zip zips the contents of a directory.
+func Zip(sourceDir, outputZip string) error {
+	// Create the zip file.
+	zipFile, err := os.Create(outputZip)
+	if err != nil {
+		return err
+	}
+	defer zipFile.Close()
+
+	// Create a new zip writer.
+	zipWriter := zip.NewWriter(zipFile)
+	if err := AddDirectory(zipWriter, sourceDir, ""); err != nil {
+		zipWriter.Close()
+		return err
+	}
+
+	return zipWriter.Close()
+}
+
+// AddDirectory adds the contents of a directory to a zip archive. Entries
+// are stored below prefix (i.e. "v20.11.1/"), or at the root when it is empty.
+func AddDirectory(zipWriter *zip.Writer, sourceDir, prefix string) error {
+	// Walk through the directory.
+	return filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Get the relative path.
+		relPath, err := filepath.Rel(sourceDir, path)
+		if err != nil {
+			return err
+		}
+
+		// Skip the directory itself but include subdirectories.
+		if info.IsDir() {
+			if relPath == "." {
+				return nil
+			}
+			// Add a trailing slash for directories in the zip archive.
+			relPath += "/"
+		}
+
+		// Create a zip header. Zip entries always use forward slashes.
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = prefix + filepath.ToSlash(relPath)
+		if info.IsDir() {
+			header.Method = zip.Store
+		} else {
+			header.Method = zip.Deflate
+		}
+
+		// Create a writer for the file in the zip archive.
+		writer, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		// If the file is not a directory, copy its contents into the archive.
+		if !info.IsDir() {
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(writer, file)
+			file.Close()
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,317 @@
+package journal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nvm/process"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Installations are staged in a transaction directory under the nvm root
+// (so the final move is a same-volume rename):
+//
+//	<root>\.staging\v<version>\journal.json
+//	<root>\.staging\v<version>\v<version>\...
+//
+// The version directory only appears in the root once the staged copy is
+// complete and committed with a single rename. Files added to an existing
+// version (i.e. the node.exe of another architecture) are staged the same
+// way and moved into the version directory one by one (see CommitFiles).
+const Directory = ".staging"
+
+const file = "journal.json"
+
+// Scratch directories in the staging area start with this prefix.
+const scratch = "scratch-"
+
+// Step names recorded in the journal, in order.
+const (
+	Begun     = "begun"
+	Node      = "node"
+	Npm       = "npm"
+	Ready     = "ready"
+	Committed = "committed"
+)
+
+var ErrInProgress = errors.New("another installation of this version is in progress")
+
+type Step struct {
+	Name string    `json:"name"`
+	Time time.Time `json:"time"`
+}
+
+type Journal struct {
+	Version string `json:"version"`
+	PID     int    `json:"pid"`
+	// Started is the start time of the process (see process.StartTime), so
+	// a reused PID is not taken for the owner.
+	Started int64  `json:"started,omitempty"`
+	Steps   []Step `json:"steps"`
+	// Files are the staged files added to an existing version, relative to
+	// the staging directory. It is empty for new versions.
+	Files []string `json:"files,omitempty"`
+
+	// Dir is the transaction directory and Target the final version directory.
+	Dir    string `json:"-"`
+	Target string `json:"-"`
+}
+
+// Result describes what Recover did with an interrupted installation.
+type Result struct {
+	Version string
+	Resumed bool
+	Err     error
+}
+
+// Begin starts a transaction for version under root. Leftovers of an
+// earlier, abandoned transaction for the same version are discarded.
+func Begin(root string, version string) (*Journal, error) {
+	j := &Journal{Version: version, PID: os.Getpid(), Started: process.StartTime(os.Getpid())}
+	j.paths(root)
+
+	if existing, err := Open(root, version); err == nil {
+		if existing.PID != j.PID && process.Alive(existing.PID, existing.Started) {
+			return nil, ErrInProgress
+		}
+		if err := existing.Abort(); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		os.RemoveAll(j.Dir)
+	}
+
+	if err := os.MkdirAll(j.Staging(), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	if err := j.Record(Begun); err != nil {
+		os.RemoveAll(j.Dir)
+		return nil, err
+	}
+
+	return j, nil
+}
+
+// Open reads the journal of an existing transaction.
+func Open(root string, version string) (*Journal, error) {
+	j := &Journal{}
+	dir := filepath.Join(root, Directory, "v"+version)
+
+	data, err := os.ReadFile(filepath.Join(dir, file))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, j); err != nil {
+		return nil, fmt.Errorf("invalid install journal %s: %v", filepath.Join(dir, file), err)
+	}
+
+	j.Version = version
+	j.paths(root)
+	return j, nil
+}
+
+// Pending returns the journals of all transactions found under root.
+// Transaction directories without a readable journal are removed.
+func Pending(root string) []*Journal {
+	entries, err := os.ReadDir(filepath.Join(root, Directory))
+	if err != nil {
+		return []*Journal{}
+	}
+
+	list := make([]*Journal, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), "v") {
+			continue
+		}
+
+		j, err := Open(root, strings.TrimPrefix(entry.Name(), "v"))
+		if err != nil {
+			os.RemoveAll(filepath.Join(root, Directory, entry.Name()))
+			continue
+		}
+
+		list = append(list, j)
+	}
+
+	return list
+}
+
+// Scratch creates a temporary directory in the staging area for files that
+// do not belong to a transaction yet (i.e. an archive being extracted
+// before its version is known). The caller removes it; Recover removes
+// those left behind by a crash.
+func Scratch(root string) (string, error) {
+	dir := filepath.Join(root, Directory)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+
+	return os.MkdirTemp(dir, scratch+"*")
+}
+
+// Recover finishes or discards interrupted transactions. Staged copies that
+// were complete are committed; everything else is removed. Transactions
+// owned by a running process are left alone. Scratch directories carry no
+// owner, so callers must hold the nvm lock (see lock), which every
+// installation holds too.
+func Recover(root string) []Result {
+	results := make([]Result, 0)
+
+	if entries, err := os.ReadDir(filepath.Join(root, Directory)); err == nil {
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), scratch) {
+				os.RemoveAll(filepath.Join(root, Directory, entry.Name()))
+			}
+		}
+	}
+
+	for _, j := range Pending(root) {
+		if j.PID != os.Getpid() && process.Alive(j.PID, j.Started) {
+			continue
+		}
+
+		result := Result{Version: j.Version}
+		if len(j.Files) > 0 && j.Has(Ready) && !j.Has(Committed) && exists(j.Target) {
+			result.Resumed = true
+			result.Err = j.moveFiles()
+		} else if j.Has(Ready) && !j.Has(Committed) && !exists(j.Target) {
+			result.Resumed = true
+			result.Err = j.Commit()
+		} else {
+			result.Err = j.Abort()
+		}
+
+		results = append(results, result)
+	}
+
+	os.Remove(filepath.Join(root, Directory))
+
+	return results
+}
+
+// Staging is the directory the version is assembled in.
+func (j *Journal) Staging() string {
+	return filepath.Join(j.Dir, "v"+j.Version)
+}
+
+// Has reports whether the step was recorded.
+func (j *Journal) Has(name string) bool {
+	for _, step := range j.Steps {
+		if step.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Record appends a step and persists the journal.
+func (j *Journal) Record(name string) error {
+	j.Steps = append(j.Steps, Step{Name: name, Time: time.Now()})
+
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write a copy first so a crash never leaves a truncated journal
+	path := filepath.Join(j.Dir, file)
+	if err := os.WriteFile(path+".tmp", data, os.ModePerm); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// Commit moves the staged version into place with a single rename and
+// removes the transaction.
+func (j *Journal) Commit() error {
+	if exists(j.Target) {
+		return fmt.Errorf("%s already exists", j.Target)
+	}
+
+	if !j.Has(Ready) {
+		if err := j.Record(Ready); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Rename(j.Staging(), j.Target); err != nil {
+		return fmt.Errorf("failed to move %s to %s: %w", j.Staging(), j.Target, err)
+	}
+
+	// The version is installed at this point. A failure to clean up is
+	// handled by Recover, which discards committed transactions.
+	j.Record(Committed)
+	os.RemoveAll(j.Dir)
+	os.Remove(filepath.Dir(j.Dir))
+
+	return nil
+}
+
+// CommitFiles moves staged files into the existing version directory and
+// removes the transaction. The files are recorded first, so Recover finishes
+// moving them when the commit is interrupted.
+func (j *Journal) CommitFiles(files ...string) error {
+	if !exists(j.Target) {
+		return fmt.Errorf("%s does not exist", j.Target)
+	}
+	for _, name := range files {
+		if exists(filepath.Join(j.Target, name)) {
+			return fmt.Errorf("%s already exists", filepath.Join(j.Target, name))
+		}
+	}
+
+	j.Files = files
+	if err := j.Record(Ready); err != nil {
+		return err
+	}
+
+	return j.moveFiles()
+}
+
+// moveFiles moves the recorded files that are still staged into place.
+func (j *Journal) moveFiles() error {
+	for _, name := range j.Files {
+		staged := filepath.Join(j.Staging(), name)
+		if !exists(staged) {
+			continue
+		}
+
+		if err := os.Rename(staged, filepath.Join(j.Target, name)); err != nil {
+			return fmt.Errorf("failed to move %s to %s: %w", staged, j.Target, err)
+		}
+	}
+
+	j.Record(Committed)
+	os.RemoveAll(j.Dir)
+	os.Remove(filepath.Dir(j.Dir))
+
+	return nil
+}
+
+// Abort removes the transaction and everything staged in it.
+func (j *Journal) Abort() error {
+	if err := os.RemoveAll(j.Dir); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", j.Dir, err)
+	}
+
+	os.Remove(filepath.Dir(j.Dir))
+
+	return nil
+}
+
+func (j *Journal) paths(root string) {
+	j.Dir = filepath.Join(root, Directory, "v"+j.Version)
+	j.Target = filepath.Join(root, "v"+j.Version)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,101 @@
+package journal
+
+import (
+	"nvm/process"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCommitFiles(t *testing.T) {
+	root := t.TempDir()
+	target := filepath.Join(root, "v20.11.1")
+	os.MkdirAll(target, os.ModePerm)
+	os.WriteFile(filepath.Join(target, "node.exe"), []byte("x64"), os.ModePerm)
+
+	tx, err := Begin(root, "20.11.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(tx.Staging(), "node-x86.exe"), []byte("x86"), os.ModePerm)
+	os.WriteFile(filepath.Join(tx.Staging(), "node-arm64.exe"), []byte("arm64"), os.ModePerm)
+
+	if err := tx.CommitFiles("node-x86.exe", "node-arm64.exe"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"node.exe", "node-x86.exe", "node-arm64.exe"} {
+		if _, err := os.Stat(filepath.Join(target, name)); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, Directory)); !os.IsNotExist(err) {
+		t.Error("the transaction was not removed")
+	}
+
+	// Existing files are not replaced
+	tx, _ = Begin(root, "20.11.1")
+	os.WriteFile(filepath.Join(tx.Staging(), "node-x86.exe"), []byte("other"), os.ModePerm)
+	if err := tx.CommitFiles("node-x86.exe"); err == nil {
+		t.Error("an existing file was replaced")
+	}
+	tx.Abort()
+}
+
+func TestRecoverCommitFiles(t *testing.T) {
+	root := t.TempDir()
+	target := filepath.Join(root, "v20.11.1")
+	os.MkdirAll(target, os.ModePerm)
+
+	// Interrupted after the first of two files was moved
+	tx, _ := Begin(root, "20.11.1")
+	os.WriteFile(filepath.Join(target, "node-x86.exe"), []byte("x86"), os.ModePerm)
+	os.WriteFile(filepath.Join(tx.Staging(), "node-arm64.exe"), []byte("arm64"), os.ModePerm)
+	tx.Files = []string{"node-x86.exe", "node-arm64.exe"}
+	tx.PID = -1
+	tx.Record(Ready)
+
+	results := Recover(root)
+	if len(results) != 1 || !results[0].Resumed || results[0].Err != nil {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	if content, _ := os.ReadFile(filepath.Join(target, "node-arm64.exe")); string(content) != "arm64" {
+		t.Error("the staged file was not moved into place")
+	}
+	if _, err := os.Stat(filepath.Join(root, Directory)); !os.IsNotExist(err) {
+		t.Error("the transaction was not removed")
+	}
+}
+
+func TestRecoverReusedPID(t *testing.T) {
+	root := t.TempDir()
+	parent := os.Getppid()
+
+	tests := []struct {
+		started int64
+		owned   bool
+	}{
+		{process.StartTime(parent), true},
+		// The PID was reused by the parent process
+		{process.StartTime(parent) - 1, false},
+	}
+
+	for _, test := range tests {
+		tx, err := Begin(root, "20.11.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.PID = parent
+		tx.Started = test.started
+		tx.Record(Node)
+
+		Recover(root)
+		_, err = os.Stat(tx.Dir)
+		if test.owned && err != nil {
+			t.Error("the transaction of a running process was discarded")
+		}
+		if !test.owned && !os.IsNotExist(err) {
+			t.Error("the transaction of a reused PID was kept")
+		}
+		tx.Abort()
+	}
+}
@@ -0,0 +1,273 @@
+package link
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"nvm/exit"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Kind is the type of filesystem link used to point NVM_SYMLINK (or a named
+// version) to a node directory.
+type Kind int
+
+const (
+	// Auto creates a symlink, or a junction when symlinks are not allowed.
+	Auto Kind = iota
+	Symlink
+	Junction
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Symlink:
+		return "symlink"
+	case Junction:
+		return "junction"
+	}
+
+	return "auto"
+}
+
+// Parse reads a link_type setting (symlink, junction or auto).
+func Parse(value string) (Kind, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "auto":
+		return Auto, nil
+	case "symlink":
+		return Symlink, nil
+	case "junction":
+		return Junction, nil
+	}
+
+	return Auto, fmt.Errorf("\"%s\" is not a valid link type (use symlink, junction or auto)", value)
+}
+
+// Errors are classified into the following kinds, independent of the
+// language Windows reports them in. Use errors.Is to test for them.
+var (
+	// ErrPrivilege means the user may not create symlinks (the
+	// SeCreateSymbolicLinkPrivilege is missing and developer mode is off).
+	ErrPrivilege = exit.New(exit.ErrPermission, "the user does not have the privilege to create symlinks")
+	// ErrPermission means the location cannot be modified by the user.
+	ErrPermission = exit.New(exit.ErrPermission, "access is denied")
+	ErrExists     = errors.New("a file or directory already exists")
+	ErrNotExist   = errors.New("the file or directory does not exist")
+	// ErrNotLink means the path is a physical file or directory.
+	ErrNotLink     = errors.New("not a symlink or junction")
+	ErrUnsupported = errors.New("not supported on this platform")
+)
+
+// Error records a failed link operation.
+type Error struct {
+	Op   string
+	Path string
+	// Err is one of the Err* values, or the system error when it could not
+	// be classified.
+	Err error
+	// Sys is the underlying system error, if any.
+	Sys error
+}
+
+func (e *Error) Error() string {
+	if e.Sys != nil && e.Sys != e.Err {
+		return fmt.Sprintf("%s %s: %v (%v)", e.Op, e.Path, e.Err, e.Sys)
+	}
+	return fmt.Sprintf("%s %s: %v", e.Op, e.Path, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// FS is the filesystem a Manager operates on. Implementations return system
+// errors, which the Manager classifies.
+type FS interface {
+	Symlink(target string, path string) error
+	Junction(target string, path string) error
+	Readlink(path string) (string, error)
+	// Type returns the kind of the link at path.
+	Type(path string) (Kind, error)
+	Lstat(path string) (fs.FileInfo, error)
+	Remove(path string) error
+}
+
+// Manager creates, inspects and removes links.
+type Manager struct {
+	fs FS
+}
+
+func New(fsys FS) *Manager {
+	return &Manager{fs: fsys}
+}
+
+// Default operates on the local filesystem.
+var Default = New(OS)
+
+// Create links path to the target directory. With Auto, a symlink is
+// created, falling back to a junction when the user lacks the privilege.
+// It returns the kind of link that was created.
+func (m *Manager) Create(path string, target string, kind Kind) (Kind, error) {
+	path = filepath.Clean(path)
+
+	if _, err := m.fs.Lstat(path); err == nil {
+		return kind, m.fail("create", path, ErrExists)
+	}
+
+	if kind == Junction {
+		return Junction, m.junction(path, target)
+	}
+
+	err := m.fs.Symlink(target, path)
+	if err == nil {
+		return Symlink, nil
+	}
+
+	err = classify(err)
+	if kind == Auto && errors.Is(err, ErrPrivilege) {
+		return Junction, m.junction(path, target)
+	}
+
+	return Symlink, m.fail("create", path, err)
+}
+
+// Replace removes the link at path, if any, and creates a new one.
+func (m *Manager) Replace(path string, target string, kind Kind) (Kind, error) {
+	if err := m.Remove(path); err != nil {
+		return kind, err
+	}
+
+	return m.Create(path, target, kind)
+}
+
+// Remove deletes the link at path without touching its target. A missing
+// path is not an error, but a physical file or directory is (ErrNotLink).
+func (m *Manager) Remove(path string) error {
+	path = filepath.Clean(path)
+
+	if _, err := m.fs.Lstat(path); err != nil {
+		if errors.Is(classify(err), ErrNotExist) {
+			return nil
+		}
+		return m.fail("remove", path, err)
+	}
+
+	if _, err := m.fs.Readlink(path); err != nil {
+		return m.fail("remove", path, ErrNotLink)
+	}
+
+	if err := m.fs.Remove(path); err != nil {
+		return m.fail("remove", path, err)
+	}
+
+	return nil
+}
+
+// Target returns the directory a link points to.
+func (m *Manager) Target(path string) (string, error) {
+	path = filepath.Clean(path)
+
+	if _, err := m.fs.Lstat(path); err != nil {
+		return "", m.fail("read", path, err)
+	}
+
+	target, err := m.fs.Readlink(path)
+	if err != nil {
+		return "", m.fail("read", path, ErrNotLink)
+	}
+
+	return target, nil
+}
+
+// Type returns whether path is a symlink or a junction.
+func (m *Manager) Type(path string) (Kind, error) {
+	path = filepath.Clean(path)
+
+	if _, err := m.Target(path); err != nil {
+		return Auto, err
+	}
+
+	kind, err := m.fs.Type(path)
+	if err != nil {
+		return Auto, m.fail("read", path, err)
+	}
+
+	return kind, nil
+}
+
+// IsLink reports whether path is a symlink or a junction.
+func (m *Manager) IsLink(path string) bool {
+	_, err := m.Target(path)
+	return err == nil
+}
+
+func (m *Manager) junction(path string, target string) error {
+	if err := m.fs.Junction(target, path); err != nil {
+		return m.fail("create", path, err)
+	}
+
+	return nil
+}
+
+func (m *Manager) fail(op string, path string, err error) error {
+	return &Error{Op: op, Path: path, Err: classify(err), Sys: err}
+}
+
+// classify maps a system error to one of the Err* values. Errors that are
+// already classified, or cannot be, are returned as is.
+func classify(err error) error {
+	for _, known := range []error{ErrPrivilege, ErrPermission, ErrExists, ErrNotExist, ErrNotLink, ErrUnsupported} {
+		if errors.Is(err, known) {
+			return known
+		}
+	}
+
+	if sys := classifySystem(err); sys != nil {
+		return sys
+	}
+
+	switch {
+	case errors.Is(err, fs.ErrExist):
+		return ErrExists
+	case errors.Is(err, fs.ErrNotExist):
+		return ErrNotExist
+	case errors.Is(err, fs.ErrPermission):
+		return ErrPermission
+	}
+
+	return err
+}
+
+type osFS struct{}
+
+// OS is the local filesystem.
+var OS FS = osFS{}
+
+// Symlink uses os.Symlink, which sets the unprivileged-create flag so
+// symlinks work without elevation when developer mode is enabled.
+func (osFS) Symlink(target string, path string) error {
+	return os.Symlink(target, path)
+}
+
+func (osFS) Junction(target string, path string) error {
+	return createJunction(target, path)
+}
+
+func (osFS) Readlink(path string) (string, error) {
+	return os.Readlink(path)
+}
+
+func (osFS) Type(path string) (Kind, error) {
+	return linkType(path)
+}
+
+func (osFS) Lstat(path string) (fs.FileInfo, error) {
+	return os.Lstat(path)
+}
+
+func (osFS) Remove(path string) error {
+	return os.Remove(path)
+}
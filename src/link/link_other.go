@@ -0,0 +1,28 @@
+//go:build !windows
+
+package link
+
+import "os"
+
+// classifySystem has nothing to add to the io/fs classification outside
+// of Windows.
+func classifySystem(err error) error {
+	return nil
+}
+
+// Junctions only exist on Windows, so every link is a symlink.
+func linkType(path string) (Kind, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return Auto, err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return Auto, ErrNotLink
+	}
+
+	return Symlink, nil
+}
+
+func createJunction(target string, path string) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,273 @@
+package link
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type entry struct {
+	target string
+	kind   Kind
+}
+
+// fakeFS keeps links and physical directories in memory. Physical entries
+// have an empty target.
+type fakeFS struct {
+	entries map[string]entry
+	// symlinkErr is returned by Symlink, i.e. to simulate a missing privilege.
+	symlinkErr error
+	removeErr  error
+}
+
+func newFakeFS() *fakeFS {
+	return &fakeFS{entries: make(map[string]entry)}
+}
+
+func (f *fakeFS) Symlink(target string, path string) error {
+	if f.symlinkErr != nil {
+		return &os.LinkError{Op: "symlink", Old: target, New: path, Err: f.symlinkErr}
+	}
+	return f.create(target, path, Symlink)
+}
+
+func (f *fakeFS) Junction(target string, path string) error {
+	return f.create(target, path, Junction)
+}
+
+func (f *fakeFS) create(target string, path string, kind Kind) error {
+	if _, exists := f.entries[path]; exists {
+		return &fs.PathError{Op: "create", Path: path, Err: fs.ErrExist}
+	}
+	f.entries[path] = entry{target: target, kind: kind}
+	return nil
+}
+
+func (f *fakeFS) Readlink(path string) (string, error) {
+	e, exists := f.entries[path]
+	if !exists {
+		return "", &fs.PathError{Op: "readlink", Path: path, Err: fs.ErrNotExist}
+	}
+	if e.target == "" {
+		return "", &fs.PathError{Op: "readlink", Path: path, Err: fs.ErrInvalid}
+	}
+	return e.target, nil
+}
+
+func (f *fakeFS) Type(path string) (Kind, error) {
+	if _, err := f.Readlink(path); err != nil {
+		return Auto, err
+	}
+	return f.entries[path].kind, nil
+}
+
+func (f *fakeFS) Lstat(path string) (fs.FileInfo, error) {
+	if _, exists := f.entries[path]; !exists {
+		return nil, &fs.PathError{Op: "lstat", Path: path, Err: fs.ErrNotExist}
+	}
+	return fakeInfo(filepath.Base(path)), nil
+}
+
+func (f *fakeFS) Remove(path string) error {
+	if f.removeErr != nil {
+		return &fs.PathError{Op: "remove", Path: path, Err: f.removeErr}
+	}
+	delete(f.entries, path)
+	return nil
+}
+
+type fakeInfo string
+
+func (i fakeInfo) Name() string       { return string(i) }
+func (i fakeInfo) Size() int64        { return 0 }
+func (i fakeInfo) Mode() fs.FileMode  { return fs.ModeDir }
+func (i fakeInfo) ModTime() time.Time { return time.Time{} }
+func (i fakeInfo) IsDir() bool        { return true }
+func (i fakeInfo) Sys() interface{}   { return nil }
+
+var (
+	current = "nodejs"
+	target  = filepath.Join("nvm", "v20.11.1")
+)
+
+func TestCreateSymlink(t *testing.T) {
+	fsys := newFakeFS()
+	kind, err := New(fsys).Create(current, target, Auto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kind != Symlink || fsys.entries[current].kind != Symlink {
+		t.Errorf("created a %v, expected a symlink", kind)
+	}
+	if fsys.entries[current].target != target {
+		t.Errorf("link points to %q, expected %q", fsys.entries[current].target, target)
+	}
+}
+
+func TestCreateFallsBackToJunction(t *testing.T) {
+	fsys := newFakeFS()
+	fsys.symlinkErr = ErrPrivilege
+
+	kind, err := New(fsys).Create(current, target, Auto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kind != Junction || fsys.entries[current].kind != Junction {
+		t.Errorf("created a %v, expected a junction", kind)
+	}
+}
+
+func TestCreateSymlinkWithoutPrivilege(t *testing.T) {
+	fsys := newFakeFS()
+	fsys.symlinkErr = ErrPrivilege
+
+	_, err := New(fsys).Create(current, target, Symlink)
+	if !errors.Is(err, ErrPrivilege) {
+		t.Fatalf("expected ErrPrivilege, got %v", err)
+	}
+
+	var linkErr *Error
+	if !errors.As(err, &linkErr) || linkErr.Op != "create" || linkErr.Path != current {
+		t.Errorf("expected a create error for %s, got %#v", current, err)
+	}
+	if _, exists := fsys.entries[current]; exists {
+		t.Error("a junction was created although a symlink was requested")
+	}
+}
+
+func TestCreateJunction(t *testing.T) {
+	fsys := newFakeFS()
+	kind, err := New(fsys).Create(current, target, Junction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kind != Junction || fsys.entries[current].kind != Junction {
+		t.Errorf("created a %v, expected a junction", kind)
+	}
+}
+
+func TestCreateExisting(t *testing.T) {
+	fsys := newFakeFS()
+	fsys.entries[current] = entry{}
+
+	if _, err := New(fsys).Create(current, target, Auto); !errors.Is(err, ErrExists) {
+		t.Fatalf("expected ErrExists, got %v", err)
+	}
+}
+
+func TestPermissionIsClassified(t *testing.T) {
+	fsys := newFakeFS()
+	fsys.symlinkErr = fs.ErrPermission
+
+	_, err := New(fsys).Create(current, target, Auto)
+	if !errors.Is(err, ErrPermission) {
+		t.Fatalf("expected ErrPermission, got %v", err)
+	}
+	if _, exists := fsys.entries[current]; exists {
+		t.Error("access denied must not fall back to a junction")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	fsys := newFakeFS()
+	fsys.entries[current] = entry{target: target, kind: Symlink}
+
+	m := New(fsys)
+	if err := m.Remove(current); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := fsys.entries[current]; exists {
+		t.Error("the link was not removed")
+	}
+
+	if err := m.Remove(current); err != nil {
+		t.Errorf("removing a missing link should succeed, got %v", err)
+	}
+}
+
+func TestRemovePhysicalDirectory(t *testing.T) {
+	fsys := newFakeFS()
+	fsys.entries[current] = entry{}
+
+	if err := New(fsys).Remove(current); !errors.Is(err, ErrNotLink) {
+		t.Fatalf("expected ErrNotLink, got %v", err)
+	}
+	if _, exists := fsys.entries[current]; !exists {
+		t.Error("a physical directory was removed")
+	}
+}
+
+func TestRemoveAccessDenied(t *testing.T) {
+	fsys := newFakeFS()
+	fsys.entries[current] = entry{target: target, kind: Symlink}
+	fsys.removeErr = fs.ErrPermission
+
+	if err := New(fsys).Remove(current); !errors.Is(err, ErrPermission) {
+		t.Fatalf("expected ErrPermission, got %v", err)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	fsys := newFakeFS()
+	fsys.entries[current] = entry{target: filepath.Join("nvm", "v18.19.0"), kind: Junction}
+
+	m := New(fsys)
+	kind, err := m.Replace(current, target, Auto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kind != Symlink {
+		t.Errorf("created a %v, expected a symlink", kind)
+	}
+
+	got, err := m.Target(current)
+	if err != nil || got != target {
+		t.Errorf("link points to %q (%v), expected %q", got, err, target)
+	}
+}
+
+func TestTarget(t *testing.T) {
+	fsys := newFakeFS()
+	fsys.entries[current] = entry{}
+
+	m := New(fsys)
+	if _, err := m.Target(current); !errors.Is(err, ErrNotLink) {
+		t.Errorf("expected ErrNotLink, got %v", err)
+	}
+	if _, err := m.Target("missing"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("expected ErrNotExist, got %v", err)
+	}
+	if m.IsLink(current) || m.IsLink("missing") {
+		t.Error("only links should be reported as links")
+	}
+}
+
+func TestType(t *testing.T) {
+	fsys := newFakeFS()
+	fsys.entries[current] = entry{target: target, kind: Junction}
+	fsys.entries["physical"] = entry{}
+
+	m := New(fsys)
+	if kind, err := m.Type(current); err != nil || kind != Junction {
+		t.Errorf("expected a junction, got %v (%v)", kind, err)
+	}
+	if _, err := m.Type("physical"); !errors.Is(err, ErrNotLink) {
+		t.Errorf("expected ErrNotLink, got %v", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	for value, expected := range map[string]Kind{"": Auto, "auto": Auto, "Symlink": Symlink, " junction ": Junction} {
+		kind, err := Parse(value)
+		if err != nil || kind != expected {
+			t.Errorf("Parse(%q) = %v, %v; expected %v", value, kind, err, expected)
+		}
+	}
+
+	if _, err := Parse("hardlink"); err == nil {
+		t.Error("expected an error for an unknown link type")
+	}
+}
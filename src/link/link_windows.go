@@ -0,0 +1,127 @@
+package link
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"unicode/utf16"
+
+	"golang.org/x/sys/windows"
+)
+
+// classifySystem maps Windows error codes, which are the same in every
+// language, to the Err* values.
+func classifySystem(err error) error {
+	var errno windows.Errno
+	if !errors.As(err, &errno) {
+		return nil
+	}
+
+	switch errno {
+	case windows.ERROR_PRIVILEGE_NOT_HELD:
+		return ErrPrivilege
+	case windows.ERROR_ACCESS_DENIED:
+		return ErrPermission
+	case windows.ERROR_ALREADY_EXISTS, windows.ERROR_FILE_EXISTS:
+		return ErrExists
+	case windows.ERROR_FILE_NOT_FOUND, windows.ERROR_PATH_NOT_FOUND:
+		return ErrNotExist
+	case windows.ERROR_NOT_A_REPARSE_POINT:
+		return ErrNotLink
+	}
+
+	return nil
+}
+
+// linkType reads the reparse tag of path, which tells symlinks and
+// junctions apart (os.Lstat reports both as symlinks or neither, depending
+// on the Go release).
+func linkType(path string) (Kind, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return Auto, err
+	}
+
+	var data windows.Win32finddata
+	handle, err := windows.FindFirstFile(p, &data)
+	if err != nil {
+		return Auto, &os.PathError{Op: "find", Path: path, Err: err}
+	}
+	windows.FindClose(handle)
+
+	if data.FileAttributes&windows.FILE_ATTRIBUTE_REPARSE_POINT != 0 {
+		switch data.Reserved0 {
+		case windows.IO_REPARSE_TAG_SYMLINK:
+			return Symlink, nil
+		case windows.IO_REPARSE_TAG_MOUNT_POINT:
+			return Junction, nil
+		}
+	}
+
+	return Auto, ErrNotLink
+}
+
+// createJunction creates a directory junction (a mount point reparse
+// point) at path. Unlike symlinks, junctions to local directories do not
+// require any privilege.
+func createJunction(target string, path string) error {
+	target, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Mkdir(path, 0755); err != nil {
+		return err
+	}
+
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	handle, err := windows.CreateFile(p, windows.GENERIC_WRITE, 0, nil, windows.OPEN_EXISTING, windows.FILE_FLAG_OPEN_REPARSE_POINT|windows.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		os.Remove(path)
+		return &os.PathError{Op: "open", Path: path, Err: err}
+	}
+
+	buffer := mountPoint(target)
+	var returned uint32
+	err = windows.DeviceIoControl(handle, windows.FSCTL_SET_REPARSE_POINT, &buffer[0], uint32(len(buffer)), nil, 0, &returned, nil)
+	windows.CloseHandle(handle)
+	if err != nil {
+		os.Remove(path)
+		return &os.PathError{Op: "junction", Path: path, Err: err}
+	}
+
+	return nil
+}
+
+// mountPoint builds a REPARSE_DATA_BUFFER for a mount point to target. The
+// substitute name is the NT path (\??\C:\...) and the print name the DOS
+// path, each followed by a NUL that is not included in its length.
+func mountPoint(target string) []byte {
+	substitute := utf16.Encode([]rune(`\??\` + target))
+	print := utf16.Encode([]rune(target))
+
+	names := make([]uint16, 0, len(substitute)+len(print)+2)
+	names = append(names, substitute...)
+	names = append(names, 0)
+	names = append(names, print...)
+	names = append(names, 0)
+
+	buffer := make([]byte, 16+len(names)*2)
+	binary.LittleEndian.PutUint32(buffer[0:], windows.IO_REPARSE_TAG_MOUNT_POINT)
+	binary.LittleEndian.PutUint16(buffer[4:], uint16(8+len(names)*2))
+	binary.LittleEndian.PutUint16(buffer[8:], 0)
+	binary.LittleEndian.PutUint16(buffer[10:], uint16(len(substitute)*2))
+	binary.LittleEndian.PutUint16(buffer[12:], uint16((len(substitute)+1)*2))
+	binary.LittleEndian.PutUint16(buffer[14:], uint16(len(print)*2))
+	for i, c := range names {
+		binary.LittleEndian.PutUint16(buffer[16+i*2:], c)
+	}
+
+	return buffer
+}
@@ -0,0 +1,189 @@
+package lock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nvm/process"
+	"os"
+	"time"
+)
+
+// Operations that modify installations, the symlink or the settings hold a
+// lock file in NVM_HOME, so concurrent nvm processes cannot clobber each
+// other. The file records who holds the lock. A lock whose process has
+// exited (i.e. was killed) is stale and taken over. A live holder keeps the
+// lock however long it takes (i.e. an install from a slow mirror).
+const File = "nvm.lock"
+
+// Forever waits without a timeout.
+const Forever time.Duration = -1
+
+var pollInterval = 250 * time.Millisecond
+
+var ErrBusy = errors.New("another nvm operation is in progress")
+
+// Info describes the holder of a lock.
+type Info struct {
+	PID       int       `json:"pid"`
+	Operation string    `json:"operation"`
+	Time      time.Time `json:"time"`
+}
+
+// BusyError is returned when the lock is held by another process.
+type BusyError struct {
+	Holder Info
+}
+
+func (e *BusyError) Error() string {
+	return fmt.Sprintf("another nvm operation (%s, PID %d) is in progress since %s", e.Holder.Operation, e.Holder.PID, e.Holder.Time.Local().Format("15:04:05"))
+}
+
+func (e *BusyError) Is(target error) bool {
+	return target == ErrBusy
+}
+
+type Lock struct {
+	path string
+	// owner is false when the lock was already held by this process, in
+	// which case Release leaves it to the outer holder.
+	owner bool
+}
+
+// Acquire takes the lock at path for an operation. When another process
+// holds it, Acquire waits up to timeout (0 does not wait, Forever waits
+// indefinitely) and then returns a *BusyError. The lock is reentrant
+// within a process.
+func Acquire(path string, operation string, timeout time.Duration) (*Lock, error) {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		l, err := tryAcquire(path, operation)
+		if err == nil || !errors.Is(err, ErrBusy) {
+			return l, err
+		}
+
+		if timeout >= 0 && !time.Now().Before(deadline) {
+			return nil, err
+		}
+
+		time.Sleep(pollInterval)
+	}
+}
+
+func tryAcquire(path string, operation string) (*Lock, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err == nil {
+		data, _ := json.Marshal(Info{PID: os.Getpid(), Operation: operation, Time: time.Now().UTC()})
+		_, err = f.Write(data)
+		f.Close()
+		if err != nil {
+			os.Remove(path)
+			return nil, err
+		}
+
+		return &Lock{path: path, owner: true}, nil
+	}
+
+	if !os.IsExist(err) {
+		return nil, err
+	}
+
+	holder, err := Read(path)
+	if err != nil {
+		// The holder may not have written the file yet
+		if age, aerr := modified(path); aerr == nil && age < time.Second {
+			return nil, &BusyError{Holder: Info{Operation: "unknown", Time: time.Now()}}
+		}
+		return takeOver(path, operation, nil)
+	}
+
+	if holder.PID == os.Getpid() {
+		return &Lock{path: path}, nil
+	}
+
+	if !process.Running(holder.PID) {
+		return takeOver(path, operation, holder)
+	}
+
+	return nil, &BusyError{Holder: *holder}
+}
+
+// Read returns the holder of the lock at path.
+func Read(path string) (*Info, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{}
+	if err := json.Unmarshal(data, info); err != nil {
+		return nil, fmt.Errorf("invalid lock file %s: %v", path, err)
+	}
+
+	return info, nil
+}
+
+// Release removes the lock, unless it was inherited from an outer Acquire
+// in the same process.
+func (l *Lock) Release() error {
+	if l == nil || !l.owner {
+		return nil
+	}
+
+	holder, err := Read(l.path)
+	if err != nil || holder.PID != os.Getpid() {
+		// Taken over as stale; it belongs to someone else now
+		return nil
+	}
+
+	l.owner = false
+	return os.Remove(l.path)
+}
+
+// Exit releases the lock and exits the process with code. os.Exit skips
+// deferred calls, so a command that exits while holding the lock must use
+// Exit to avoid leaving the lock file behind. l may be nil.
+func (l *Lock) Exit(code int) {
+	l.Release()
+	os.Exit(code)
+}
+
+// takeOver removes a stale lock of holder (nil when it was unreadable) and
+// acquires it. Several processes may judge the same lock stale, so it is
+// first renamed to a name of its own. When the renamed file turns out to be
+// another process's fresh lock (the stale one was already taken over), it
+// is put back and the lock is busy.
+func takeOver(path string, operation string, holder *Info) (*Lock, error) {
+	moved := fmt.Sprintf("%s.%d-%d", path, os.Getpid(), time.Now().UnixNano())
+	if err := os.Rename(path, moved); err != nil {
+		if os.IsNotExist(err) {
+			return tryAcquire(path, operation)
+		}
+		return nil, fmt.Errorf("failed to remove the stale lock %s: %v", path, err)
+	}
+
+	found, err := Read(moved)
+	if err == nil && (holder == nil || !found.same(holder)) {
+		// Restored unless yet another process acquired the lock, in which
+		// case the displaced holder finds out when it releases it
+		os.Link(moved, path)
+		os.Remove(moved)
+		return nil, &BusyError{Holder: *found}
+	}
+
+	os.Remove(moved)
+	return tryAcquire(path, operation)
+}
+
+func (i *Info) same(other *Info) bool {
+	return i.PID == other.PID && i.Operation == other.Operation && i.Time.Equal(other.Time)
+}
+
+func modified(path string) (time.Duration, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return time.Since(info.ModTime()), nil
+}
@@ -0,0 +1,150 @@
+package lock
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func hold(t *testing.T, path string, holder Info) {
+	t.Helper()
+	data, _ := json.Marshal(holder)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcquireAndRelease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), File)
+
+	l, err := Acquire(path, "install 20", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	holder, err := Read(path)
+	if err != nil || holder.PID != os.Getpid() || holder.Operation != "install 20" {
+		t.Fatalf("unexpected holder %+v (%v)", holder, err)
+	}
+
+	// Reentrant within the process
+	inner, err := Acquire(path, "use 20", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner.Release()
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal("releasing an inner lock removed the lock file")
+	}
+
+	if err := l.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("the lock file was not removed")
+	}
+}
+
+func TestBusy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), File)
+	hold(t, path, Info{PID: os.Getppid(), Operation: "install 20.11.0", Time: time.Now()})
+
+	start := time.Now()
+	_, err := Acquire(path, "use 18", 300*time.Millisecond)
+	if !errors.Is(err, ErrBusy) {
+		t.Fatalf("expected ErrBusy, got %v", err)
+	}
+	if time.Since(start) < 300*time.Millisecond {
+		t.Error("Acquire did not wait for the timeout")
+	}
+
+	var busy *BusyError
+	if !errors.As(err, &busy) || busy.Holder.PID != os.Getppid() || busy.Holder.Operation != "install 20.11.0" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestWaitForRelease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), File)
+	hold(t, path, Info{PID: os.Getppid(), Operation: "install 20", Time: time.Now()})
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		os.Remove(path)
+	}()
+
+	l, err := Acquire(path, "use 18", Forever)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Release()
+}
+
+// A command that fails while holding the lock exits through Exit. Run in a
+// child process, as Exit does not return.
+func TestExitReleases(t *testing.T) {
+	if path := os.Getenv("NVM_LOCK_EXIT"); path != "" {
+		l, err := Acquire(path, "install 20", 0)
+		if err != nil {
+			os.Exit(2)
+		}
+		// The installation fails
+		l.Exit(1)
+	}
+
+	path := filepath.Join(t.TempDir(), File)
+	cmd := exec.Command(os.Args[0], "-test.run=^TestExitReleases$")
+	cmd.Env = append(os.Environ(), "NVM_LOCK_EXIT="+path)
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Fatalf("expected exit code 1, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("the lock file was left behind after a failed install")
+	}
+}
+
+func TestStale(t *testing.T) {
+	dir := t.TempDir()
+
+	// A process that has exited
+	path := filepath.Join(dir, "exited.lock")
+	hold(t, path, Info{PID: 1 << 30, Operation: "install 20", Time: time.Now()})
+	if _, err := Acquire(path, "use 18", 0); err != nil {
+		t.Errorf("a lock of an exited process was not taken over: %v", err)
+	}
+
+	// A long operation of a live process keeps its lock
+	path = filepath.Join(dir, "old.lock")
+	hold(t, path, Info{PID: os.Getppid(), Operation: "install 20", Time: time.Now().Add(-24 * time.Hour)})
+	if _, err := Acquire(path, "use 18", 0); !errors.Is(err, ErrBusy) {
+		t.Errorf("the lock of a live process was taken over: %v", err)
+	}
+}
+
+// Two processes judged the same lock stale, and the other one already took
+// it over. Its fresh lock must not be removed.
+func TestTakeOverRace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), File)
+	inspected := Info{PID: 1 << 30, Operation: "install 20", Time: time.Now().Add(-time.Minute)}
+	fresh := Info{PID: os.Getppid(), Operation: "install 18", Time: time.Now()}
+	hold(t, path, fresh)
+
+	if _, err := takeOver(path, "use 18", &inspected); !errors.Is(err, ErrBusy) {
+		t.Fatalf("the fresh lock was taken over: %v", err)
+	}
+
+	holder, err := Read(path)
+	if err != nil || !holder.same(&fresh) {
+		t.Errorf("the fresh lock was not restored: %+v (%v)", holder, err)
+	}
+	if matches, _ := filepath.Glob(path + ".*"); len(matches) > 0 {
+		t.Errorf("left behind %v", matches)
+	}
+}
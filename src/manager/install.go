@@ -0,0 +1,412 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"nvm/arch"
+	"nvm/exit"
+	"nvm/file"
+	"nvm/journal"
+	"nvm/node"
+	"nvm/utility"
+	"nvm/web"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// InstallOptions configure Install, InstallFile and InstallDir.
+type InstallOptions struct {
+	// Archs are the architectures to install. Defaults to the architecture
+	// of the settings.
+	Archs []arch.Architecture
+	// Insecure skips the validation of the download server's certificate.
+	Insecure bool
+	// Source selects the distribution to download from (see SetSource).
+	// Architectures added to an installed version are downloaded from the
+	// source it was installed from, unless a source is given.
+	Source string
+	// Checksums is the checksum list local archives are verified against.
+	// Defaults to a SHASUMS256.txt file next to the archive.
+	Checksums string
+	// SkipDefaultPackages skips the packages listed in
+	// NVM_HOME\default-packages.
+	SkipDefaultPackages bool
+	// ReinstallPackagesFrom is an installed version whose global packages
+	// are reinstalled into the new version.
+	ReinstallPackagesFrom string
+}
+
+// InstallResult describes an installation. It is returned with errors that
+// occur after the version was resolved.
+type InstallResult struct {
+	Version string
+	Archs   []arch.Architecture
+	// Existing is true when the version was already installed.
+	Existing bool
+	// Added lists the architectures added to a version that was already
+	// installed.
+	Added []arch.Architecture
+	// NpmMissing is true when npm is not included in a local distribution
+	// and could not be downloaded.
+	NpmMissing      bool
+	DefaultPackages *PackageResult
+	Migrated        *PackageResult
+}
+
+// Fresh reports whether the version was newly installed.
+func (r *InstallResult) Fresh() bool {
+	return !r.Existing && len(r.Added) == 0
+}
+
+// NpmError is returned when npm could not be downloaded. Node itself is
+// installed.
+type NpmError struct {
+	Version string
+	URL     string
+	Dir     string
+}
+
+func (e *NpmError) Error() string {
+	return fmt.Sprintf("Could not download npm for node v%s.\nPlease visit %s to download npm.\nIt should be extracted to %s", e.Version, e.URL, e.Dir)
+}
+
+// Is reports NpmError as a partial success.
+func (e *NpmError) Is(target error) bool {
+	return target == exit.ErrPartial
+}
+
+// Install downloads and installs a version (see Resolve for the accepted
+// arguments). Installations are staged (see journal), so an error or a
+// canceled context never leaves a partial version behind.
+func (m *Manager) Install(ctx context.Context, spec string, opts InstallOptions) (*InstallResult, error) {
+	result, err := m.install(ctx, spec, opts)
+	if err != nil {
+		return result, err
+	}
+
+	return result, m.installPackages(result, opts)
+}
+
+func (m *Manager) install(ctx context.Context, spec string, opts InstallOptions) (*InstallResult, error) {
+	s := m.Settings
+	archs := append([]arch.Architecture{}, opts.Archs...)
+	if len(archs) == 0 {
+		archs = append(archs, s.Arch)
+	}
+
+	// The source and the certificate validation of an installation are
+	// not kept by the Manager
+	copied := *m
+	m = &copied
+	if opts.Source != "" {
+		if err := m.SetSource(opts.Source); err != nil {
+			return nil, err
+		}
+	}
+
+	verifySSL := s.VerifySSL
+	if opts.Insecure {
+		m.Web = m.Web.Insecure()
+		verifySSL = false
+	}
+
+	version, a, err := m.Resolve(spec, archs[0], false)
+	if err != nil {
+		return nil, err
+	}
+	if len(archs) == 1 {
+		archs[0] = a
+	}
+	result := &InstallResult{Version: version, Archs: archs}
+
+	// Other sources (i.e. nightly) are only checked against their index
+	official := m.Web.Source().Official()
+	if official {
+		exceeds, err := m.exceedsLatest(version)
+		if err != nil {
+			return result, err
+		}
+		if exceeds {
+			return result, exit.Errorf(exit.ErrNotFound, "Node.js v%s is not yet released or is not available for download yet.", version)
+		}
+
+		for _, a := range archs {
+			if a == arch.X64 && !web.IsNode64bitAvailable(version) {
+				return result, exit.Errorf(exit.ErrNotFound, "Node.js v%s is only available in 32-bit.", version)
+			}
+
+			if a == arch.ARM64 && !web.IsNodeArm64bitAvailable(version) {
+				return result, exit.Errorf(exit.ErrNotFound, "Node.js v%s is only available in 32-bit and 64-bit.", version)
+			}
+		}
+	}
+
+	if m.InstalledAll(version, archs) {
+		result.Existing = true
+		return result, nil
+	}
+
+	available, err := node.IsVersionAvailable(m.Web, s.Root, version)
+	if err != nil {
+		return result, err
+	}
+	if !available {
+		url := m.Web.Source().IndexURL()
+		return result, exit.Errorf(exit.ErrNotFound, "Version %s is not available.\n\nThe complete list of available versions can be found at %s", version, url)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	// Stage the installation under the nvm root. The version directory
+	// only appears in the root once it is complete (see journal).
+	tx, err := journal.Begin(s.Root, version)
+	if err != nil {
+		return result, err
+	}
+	root := tx.Dir
+	fail := func(err error) (*InstallResult, error) {
+		tx.Abort()
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return result, err
+	}
+	os.MkdirAll(filepath.Join(root, "v"+version, "node_modules"), os.ModeDir)
+
+	// Warn the user if they're attempting to install without verifying the remote SSL cert
+	if !verifySSL {
+		m.warn(version, "The remote SSL certificate will not be validated during the download process.")
+	}
+
+	// The first architecture is installed from the full distribution.
+	// Additional architectures only append their node.exe, from the
+	// same source unless another one is requested.
+	m.progress(version, "Downloading & extracting...")
+	target := filepath.Join(s.Root, "v"+version)
+	existing := file.Exists(filepath.Join(target, "node.exe"))
+	if existing && opts.Source == "" {
+		recorded := node.GetSource(target)
+		if src, err := m.Web.FindSource(recorded.Name); err == nil {
+			m.Web = m.Web.WithSource(src)
+		} else if src, err := m.Web.FindSource(recorded.URL); err == nil {
+			m.Web = m.Web.WithSource(src)
+		}
+	}
+	appending := existing
+	for _, a := range archs {
+		if node.IsVersionInstalled(s.Root, version, a) || node.IsVersionInstalled(root, version, a) {
+			continue
+		}
+
+		if err := m.Web.GetNodeJS(root, version, a, appending); err != nil {
+			return fail(fmt.Errorf("failed to download v%v %s executable: %w", version, a.Label(), err))
+		}
+		if appending {
+			result.Added = append(result.Added, a)
+		}
+		appending = true
+
+		if err := ctx.Err(); err != nil {
+			return fail(err)
+		}
+	}
+	tx.Record(journal.Node)
+
+	// Architectures added to an existing installation only need
+	// their executables moved alongside the active node.exe.
+	if existing {
+		if err := node.MigrateLayout(target); err != nil {
+			return fail(err)
+		}
+
+		executables := make([]string, 0)
+		for _, a := range result.Added {
+			executables = append(executables, a.Executable())
+		}
+		if err := tx.CommitFiles(executables...); err != nil {
+			return fail(err)
+		}
+
+		return result, nil
+	}
+
+	// Recorded before npm is added, as an installation without npm is
+	// committed as well
+	if err := node.RecordSource(tx.Staging(), m.Web.Source().Name, m.Web.Source().URL); err != nil {
+		return fail(err)
+	}
+
+	// Add npm when the distribution does not include it
+	if !file.Exists(filepath.Join(root, "v"+version, "node_modules", "npm")) {
+		m.progress(version, "Downloading npm...")
+		npmv, err := m.npmVersion(version)
+		if err != nil {
+			return fail(err)
+		}
+
+		if err := m.Web.GetNpm(root, npmv); err != nil {
+			utility.DebugLogf("npm download failed: %v", err)
+			if ctx.Err() != nil {
+				return fail(ctx.Err())
+			}
+
+			// Node itself is usable, so it is still installed
+			if err := tx.Commit(); err != nil {
+				return fail(err)
+			}
+
+			return result, &NpmError{Version: version, URL: m.Web.GetFullNpmUrl(version), Dir: target}
+		}
+
+		m.progress(version, "Installing npm v%s...", npmv)
+		if err := extractNpm(root, version, npmv); err != nil {
+			return fail(err)
+		}
+	}
+	tx.Record(journal.Npm)
+
+	if err := ctx.Err(); err != nil {
+		return fail(err)
+	}
+
+	// Move the complete installation into place
+	utility.DebugLogf("commit %v to %v", tx.Staging(), tx.Target)
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+	utility.DebugFn(func() {
+		utility.DebugLogf("env root: %v", s.Root)
+		cmd := exec.Command("cmd", "/C", "dir", target)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			utility.DebugLog(err.Error())
+		} else {
+			utility.DebugLog(string(out))
+		}
+	})
+
+	return result, nil
+}
+
+// Installs the default packages into a new version and migrates the global
+// packages requested by the options. Default packages never fail the
+// installation.
+func (m *Manager) installPackages(result *InstallResult, opts InstallOptions) error {
+	// Global packages add executables the shims launch
+	defer m.refreshShims()
+
+	if result.Fresh() && !opts.SkipDefaultPackages {
+		r, err := m.InstallDefaultPackages(result.Version)
+		if err != nil {
+			m.warn(result.Version, "could not read the default packages: %v", err)
+		}
+		result.DefaultPackages = r
+	}
+
+	if opts.ReinstallPackagesFrom != "" {
+		r, err := m.MigrateGlobals(opts.ReinstallPackagesFrom, result.Version, false)
+		result.Migrated = r
+		return err
+	}
+
+	return nil
+}
+
+// Reinstall removes a version, if it is installed, and installs it again.
+func (m *Manager) Reinstall(ctx context.Context, spec string, opts InstallOptions) (*InstallResult, error) {
+	version := spec
+	var err error
+	switch strings.ToLower(spec) {
+	case "latest", "node":
+		version, err = m.Latest()
+	case "lts":
+		version, err = m.LTS()
+	case "newest":
+		installed := node.GetInstalled(m.Settings.Root)
+		if len(installed) == 0 {
+			return nil, errors.New("No versions of node.js found. Try installing the latest by typing nvm install latest.")
+		}
+		version = installed[0]
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	version = CleanVersion(version)
+
+	if m.InstalledAny(version) {
+		active, _ := m.Active()
+		m.progress(version, "Removing v%v...", version)
+		if err := m.Remove(version, active == version); err != nil {
+			return nil, fmt.Errorf("failed to remove v%v: %w", version, err)
+		}
+	} else {
+		m.warn(version, "node v%v is not installed.", version)
+	}
+
+	return m.Install(ctx, version, opts)
+}
+
+// Extracts the npm archive downloaded by web.Client.GetNpm into a staged
+// installation.
+func extractNpm(root string, version string, npmv string) error {
+	// Extract npm within the transaction (GetNpm downloads to <root>\temp)
+	tempDir := filepath.Join(root, "temp")
+	err := file.Unzip(filepath.Join(tempDir, "npm-v"+npmv+".zip"), filepath.Join(tempDir, "nvm-npm"))
+	if err != nil {
+		return fmt.Errorf("Failed to extract npm: %v", err)
+	}
+
+	// Copy the npm and npm.cmd files to the installation directory
+	tempNpmBin := filepath.Join(tempDir, "nvm-npm", "cli-"+npmv, "bin")
+
+	// Support npm < 6.2.0
+	if file.Exists(tempNpmBin) == false {
+		tempNpmBin = filepath.Join(tempDir, "nvm-npm", "npm-"+npmv, "bin")
+	}
+
+	if file.Exists(tempNpmBin) == false {
+		return fmt.Errorf("Failed to extract npm. Could not find %s", tempNpmBin)
+	}
+
+	// Standard npm support
+	utility.Rename(filepath.Join(tempNpmBin, "npm"), filepath.Join(root, "v"+version, "npm"))
+	utility.Rename(filepath.Join(tempNpmBin, "npm.cmd"), filepath.Join(root, "v"+version, "npm.cmd"))
+
+	// npx support
+	if _, err := os.Stat(filepath.Join(tempNpmBin, "npx")); err == nil {
+		utility.Rename(filepath.Join(tempNpmBin, "npx"), filepath.Join(root, "v"+version, "npx"))
+		utility.Rename(filepath.Join(tempNpmBin, "npx.cmd"), filepath.Join(root, "v"+version, "npx.cmd"))
+	}
+
+	npmSourcePath := filepath.Join(tempDir, "nvm-npm", "npm-"+npmv)
+
+	if file.Exists(npmSourcePath) == false {
+		npmSourcePath = filepath.Join(tempDir, "nvm-npm", "cli-"+npmv)
+	}
+
+	moveNpmErr := utility.Rename(npmSourcePath, filepath.Join(root, "v"+version, "node_modules", "npm"))
+	if moveNpmErr != nil {
+		// sometimes Windows can take some time to enable access to large amounts of files after unzip, use exponential backoff to wait until it is ready
+		for _, i := range [5]int{1, 2, 4, 8, 16} {
+			time.Sleep(time.Duration(i) * time.Second)
+			moveNpmErr = utility.Rename(npmSourcePath, filepath.Join(root, "v"+version, "node_modules", "npm"))
+			if moveNpmErr == nil {
+				break
+			}
+		}
+	}
+
+	if moveNpmErr != nil {
+		return fmt.Errorf("Unable to move directory %s to node_modules: %v", npmSourcePath, moveNpmErr)
+	}
+
+	os.RemoveAll(tempDir)
+	return nil
+}
@@ -0,0 +1,213 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"nvm/arch"
+	"nvm/file"
+	"nvm/journal"
+	"nvm/node"
+	"nvm/utility"
+	"os"
+	"path/filepath"
+)
+
+// InstallFile installs node from a distribution archive (i.e.
+// node-v20.11.1-win-x64.zip) without downloading node. The archive is
+// verified against the checksum list of the options, if any. The version
+// and architecture are detected from the name of the archive, the PE header
+// of node.exe and node -v.
+func (m *Manager) InstallFile(ctx context.Context, path string, opts InstallOptions) (*InstallResult, error) {
+	return m.installLocal(ctx, path, false, opts)
+}
+
+// InstallDir installs node from an extracted distribution directory, like
+// InstallFile.
+func (m *Manager) InstallDir(ctx context.Context, path string, opts InstallOptions) (*InstallResult, error) {
+	return m.installLocal(ctx, path, true, opts)
+}
+
+func (m *Manager) installLocal(ctx context.Context, path string, isDir bool, opts InstallOptions) (*InstallResult, error) {
+	result, err := m.extractLocal(ctx, path, isDir, opts.Checksums)
+	if err != nil {
+		return result, err
+	}
+
+	return result, m.installPackages(result, opts)
+}
+
+func (m *Manager) extractLocal(ctx context.Context, path string, isDir bool, checksums string) (*InstallResult, error) {
+	s := m.Settings
+	path, _ = filepath.Abs(path)
+	if !file.Exists(path) {
+		return nil, fmt.Errorf("%s does not exist.", path)
+	}
+
+	nameVersion, nameArch, named := node.ParseArtifact(path)
+
+	// Validate the archive before extracting anything
+	if !isDir {
+		if err := m.verifyArtifact(path, checksums); err != nil {
+			return nil, err
+		}
+	}
+
+	// Archives are extracted into the staging area, so the result can be
+	// renamed into a transaction and a crash leaves nothing in the root
+	dir := path
+	if !isDir {
+		tmp, err := journal.Scratch(s.Root)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			os.RemoveAll(tmp)
+			os.Remove(filepath.Dir(tmp))
+		}()
+
+		m.progress("", "Extracting %s...", filepath.Base(path))
+		if err := file.Unzip(path, tmp); err != nil {
+			return nil, fmt.Errorf("Error extracting %s: %w", path, err)
+		}
+
+		// Distribution archives contain a single node-v<version>-win-<arch> directory
+		dir = tmp
+		if entries, err := os.ReadDir(tmp); err == nil && len(entries) == 1 && entries[0].IsDir() {
+			dir = filepath.Join(tmp, entries[0].Name())
+		}
+	}
+
+	version, cpuarch, err := node.Inspect(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if named && nameArch != cpuarch {
+		return nil, fmt.Errorf("%s is named as a %s distribution, but contains a %s node.exe.", filepath.Base(path), nameArch.Label(), cpuarch.Label())
+	}
+	if version == "" {
+		if !named {
+			return nil, fmt.Errorf("Cannot determine the version of %s because this computer cannot run %s executables.\nName the archive or directory node-v<version>-win-<arch> to specify the version.", filepath.Join(dir, "node.exe"), cpuarch.Label())
+		}
+		version = nameVersion
+	} else if named && version != nameVersion {
+		return nil, fmt.Errorf("%s is named as node v%s, but contains node v%s.", filepath.Base(path), nameVersion, version)
+	}
+
+	result := &InstallResult{Version: version, Archs: []arch.Architecture{cpuarch}}
+	target := filepath.Join(s.Root, "v"+version)
+	if file.Exists(filepath.Join(target, "node.exe")) && node.HasArchitecture(target, cpuarch) {
+		result.Existing = true
+		return result, nil
+	}
+
+	tx, err := journal.Begin(s.Root, version)
+	if err != nil {
+		return result, err
+	}
+	fail := func(err error) (*InstallResult, error) {
+		tx.Abort()
+		return result, err
+	}
+
+	os.Remove(tx.Staging())
+	if isDir {
+		m.progress(version, "Copying %s...", path)
+		err = utility.Copy(dir, tx.Staging())
+	} else {
+		err = os.Rename(dir, tx.Staging())
+	}
+	if err != nil {
+		return fail(err)
+	}
+	tx.Record(journal.Node)
+
+	// Add the architecture to an existing installation
+	if file.Exists(filepath.Join(target, "node.exe")) {
+		if err := node.MigrateLayout(target); err != nil {
+			return fail(err)
+		}
+		if err := os.Rename(filepath.Join(tx.Staging(), "node.exe"), filepath.Join(tx.Staging(), cpuarch.Executable())); err != nil {
+			return fail(err)
+		}
+		if err := tx.CommitFiles(cpuarch.Executable()); err != nil {
+			return fail(err)
+		}
+
+		result.Added = result.Archs
+		return result, nil
+	}
+
+	// npm is downloaded the way Install does when the distribution does not
+	// include it and the network is available.
+	result.NpmMissing = !file.Exists(filepath.Join(tx.Staging(), "node_modules", "npm"))
+	if result.NpmMissing && m.Web.Ping(m.Web.Source().IndexURL()) {
+		m.progress(version, "Downloading npm...")
+		npmv, err := m.npmVersion(version)
+		if err == nil {
+			err = m.Web.GetNpm(tx.Dir, npmv)
+		}
+		if err == nil {
+			m.progress(version, "Installing npm v%s...", npmv)
+			if err := extractNpm(tx.Dir, version, npmv); err != nil {
+				return fail(err)
+			}
+			result.NpmMissing = false
+		}
+	}
+	tx.Record(journal.Npm)
+
+	origin := "file"
+	if isDir {
+		origin = "directory"
+	}
+	if err := node.RecordSource(tx.Staging(), origin, path); err != nil {
+		return fail(err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return fail(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+
+	if result.NpmMissing {
+		m.warn(version, "npm is not included in %s and could not be downloaded.\nIt should be extracted to %s\\node_modules\\npm", path, target)
+	}
+
+	return result, nil
+}
+
+// Verifies a local distribution archive against a checksum list, either
+// the given one or a SHASUMS256.txt file next to it.
+func (m *Manager) verifyArtifact(path string, sums string) error {
+	explicit := sums != ""
+	if !explicit {
+		sums = filepath.Join(filepath.Dir(path), "SHASUMS256.txt")
+		if !file.Exists(sums) {
+			return nil
+		}
+	}
+
+	list, err := os.ReadFile(sums)
+	if err != nil {
+		return err
+	}
+
+	expected := file.LookupChecksum(string(list), filepath.Base(path))
+	if expected == "" {
+		if explicit {
+			return fmt.Errorf("%s does not list a checksum for %s", sums, filepath.Base(path))
+		}
+		return nil
+	}
+
+	if err := file.VerifyChecksum(path, expected); err != nil {
+		return err
+	}
+
+	m.progress("", "Verified %s against %s", filepath.Base(path), sums)
+	return nil
+}
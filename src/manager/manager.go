@@ -0,0 +1,137 @@
+// Package manager implements the nvm operations (install, use, uninstall,
+// etc.) independent of the command line. Operations return their result and
+// an error instead of printing or exiting, and report progress through an
+// event handler, so they can be embedded in other tools.
+package manager
+
+import (
+	"fmt"
+	"nvm/arch"
+	"nvm/file"
+	"nvm/journal"
+	"nvm/node"
+	"nvm/shim"
+	"nvm/web"
+	"path/filepath"
+)
+
+// EventKind distinguishes progress messages from warnings.
+type EventKind int
+
+const (
+	Progress EventKind = iota
+	Warning
+)
+
+// Event reports the progress of an operation.
+type Event struct {
+	Kind EventKind
+	// Version is the node version the event applies to, if any.
+	Version string
+	Text    string
+}
+
+// Manager performs nvm operations on the installations and the NVM_SYMLINK
+// described by its settings.
+type Manager struct {
+	Settings *Settings
+	// Bin is the directory containing nvm-shim.exe and elevate.cmd. It
+	// defaults to the directory of the settings file (NVM_HOME).
+	Bin string
+	// Web downloads versions with the proxy, mirrors and source of the
+	// Manager.
+	Web *web.Client
+
+	events func(Event)
+}
+
+// New returns a Manager for the settings. The proxy, mirrors and custom
+// distribution sources (sources.json) are applied to the downloads of the
+// Manager. events receives progress and may be nil.
+func New(s *Settings, events func(Event)) *Manager {
+	m := &Manager{Settings: s, Bin: s.Home(), Web: web.NewClient(s.Proxy, s.VerifySSL), events: events}
+	m.Web.SetMirrors(s.NodeMirror, s.NpmMirror)
+
+	if err := m.Web.LoadSources(filepath.Join(s.Home(), "sources.json")); err != nil {
+		m.warn("", err.Error())
+	}
+
+	return m
+}
+
+// SetSource selects the distribution (official, unofficial, nightly, rc, a
+// source from sources.json, or a URL) versions are downloaded from.
+func (m *Manager) SetSource(name string) error {
+	src, err := m.Web.FindSource(name)
+	if err != nil {
+		return err
+	}
+
+	m.Web = m.Web.WithSource(src)
+	return nil
+}
+
+// available retrieves the versions of the current source (see
+// node.GetAvailable) and caches the LTS versions in the nvm root.
+func (m *Manager) available() ([]string, []string, []string, []string, []string, map[string]string, error) {
+	return node.GetAvailable(m.Web, m.Settings.Root)
+}
+
+func (m *Manager) emit(kind EventKind, version string, format string, a ...interface{}) {
+	if m.events != nil {
+		m.events(Event{Kind: kind, Version: version, Text: fmt.Sprintf(format, a...)})
+	}
+}
+
+func (m *Manager) progress(version string, format string, a ...interface{}) {
+	m.emit(Progress, version, format, a...)
+}
+
+func (m *Manager) warn(version string, format string, a ...interface{}) {
+	m.emit(Warning, version, format, a...)
+}
+
+// Recover completes or cleans up installations interrupted by a crash or
+// by closing the console, and empties the trash. Staged versions that were
+// fully assembled are moved into place; partial ones are discarded. Callers
+// must hold the nvm lock (see lock).
+func (m *Manager) Recover() []journal.Result {
+	results := journal.Recover(m.Settings.Root)
+	file.EmptyTrash(m.Settings.Root)
+	return results
+}
+
+// Active returns the globally active version. In shim mode, this is the
+// default version the shims fall back to, rather than the target of
+// NVM_SYMLINK. It returns "Unknown" when no version is active.
+func (m *Manager) Active() (string, arch.Architecture) {
+	s := m.Settings
+	if s.Activation == shim.Mode {
+		if s.DefaultVersion == "" {
+			return "Unknown", arch.Unknown
+		}
+		return s.DefaultVersion, node.ActiveArchitecture(node.Dir(s.Root, s.DefaultVersion))
+	}
+
+	return node.GetCurrentVersion(s.Root, s.Symlink)
+}
+
+// InstalledAll reports whether every architecture of the version is installed.
+func (m *Manager) InstalledAll(version string, archs []arch.Architecture) bool {
+	for _, a := range archs {
+		if !node.IsVersionInstalled(m.Settings.Root, version, a) {
+			return false
+		}
+	}
+	return true
+}
+
+// InstalledAny reports whether any architecture of the version is installed.
+func (m *Manager) InstalledAny(version string) bool {
+	for _, a := range []arch.Architecture{arch.X86, arch.X64, arch.ARM64} {
+		if node.IsVersionInstalled(m.Settings.Root, version, a) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package manager
+
+import (
+	"fmt"
+	"nvm/exit"
+	"nvm/file"
+	"nvm/node"
+	"nvm/npm"
+	"path/filepath"
+)
+
+// PackageResult describes the global packages installed into a version.
+type PackageResult struct {
+	// Version is the version the packages were installed into.
+	Version string
+	// From is the version the packages were migrated from, if any.
+	From     string
+	Packages []string
+	Failures []PackageFailure
+	// DryRun is true when the packages were only listed.
+	DryRun bool
+}
+
+// PackageFailure is a package that could not be installed.
+type PackageFailure struct {
+	Spec string
+	Err  error
+}
+
+func (f PackageFailure) String() string {
+	return fmt.Sprintf("%s: %v", f.Spec, f.Err)
+}
+
+// PackageError is returned when some packages could not be installed.
+type PackageError struct {
+	Version  string
+	Failures []PackageFailure
+}
+
+func (e *PackageError) Error() string {
+	return fmt.Sprintf("%d global package(s) could not be installed into node v%s", len(e.Failures), e.Version)
+}
+
+// Is reports PackageError as a partial success.
+func (e *PackageError) Is(target error) bool {
+	return target == exit.ErrPartial
+}
+
+// InstallDefaultPackages installs the packages listed in
+// NVM_HOME\default-packages globally. Failures are listed in the result.
+func (m *Manager) InstallDefaultPackages(version string) (*PackageResult, error) {
+	path := filepath.Join(m.Settings.Home(), "default-packages")
+	specs, err := npm.DefaultPackages(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %v", path, err)
+	}
+
+	result := &PackageResult{Version: version, Packages: specs}
+	if len(specs) == 0 {
+		return result, nil
+	}
+
+	m.progress(version, "Installing default packages into node v%s...", version)
+	for _, spec := range specs {
+		if err := npm.InstallGlobal(filepath.Join(m.Settings.Root, "v"+version), spec); err != nil {
+			result.Failures = append(result.Failures, PackageFailure{Spec: spec, Err: err})
+		}
+	}
+
+	return result, nil
+}
+
+// MigrateGlobals reinstalls the global npm packages of one installed
+// version into another, at the versions installed in the source. With
+// dryrun, the packages are only listed. A *PackageError is returned with
+// the result when some packages fail.
+func (m *Manager) MigrateGlobals(from string, to string, dryrun bool) (*PackageResult, error) {
+	source, _, err := m.Resolve(from, m.Settings.Arch, true)
+	if err != nil {
+		return nil, err
+	}
+
+	target, _, err := m.Resolve(to, m.Settings.Arch, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if source == target {
+		return nil, fmt.Errorf("Cannot migrate global packages from v%s to itself.", source)
+	}
+
+	for _, v := range []string{source, target} {
+		if !file.Exists(node.Dir(m.Settings.Root, v)) {
+			return nil, exit.Errorf(exit.ErrNotFound, "node v%s is not installed. Type \"nvm list\" to see what is installed.", v)
+		}
+	}
+
+	packages, err := npm.Globals(node.Dir(m.Settings.Root, source))
+	if err != nil {
+		return nil, fmt.Errorf("error reading global packages of v%s: %v", source, err)
+	}
+
+	result := &PackageResult{Version: target, From: source, DryRun: dryrun}
+	if len(packages) == 0 {
+		return result, nil
+	}
+
+	list := ""
+	for _, pkg := range packages {
+		result.Packages = append(result.Packages, pkg.Spec())
+		list += "\n  - " + pkg.Spec()
+	}
+	m.progress(source, "Global packages in node v%s:%s", source, list)
+
+	if dryrun {
+		return result, nil
+	}
+
+	// The same versions are installed, so the migration does not upgrade
+	// the packages
+	for _, pkg := range packages {
+		m.progress(target, "Installing %s into node v%s...", pkg.Spec(), target)
+		if err := npm.InstallGlobal(node.Dir(m.Settings.Root, target), pkg.Spec()); err != nil {
+			result.Failures = append(result.Failures, PackageFailure{Spec: pkg.Spec(), Err: err})
+		}
+	}
+
+	if len(result.Failures) > 0 {
+		return result, &PackageError{Version: target, Failures: result.Failures}
+	}
+
+	return result, nil
+}
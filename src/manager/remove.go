@@ -0,0 +1,82 @@
+package manager
+
+import (
+	"fmt"
+	"nvm/arch"
+	"nvm/file"
+	"nvm/node"
+	"nvm/utility"
+	"path/filepath"
+)
+
+// Remove uninstalls a version. The version is moved to the trash first and
+// restored (together with NVM_SYMLINK) when anything fails. An active
+// version is deactivated.
+func (m *Manager) Remove(version string, active bool) error {
+	root := m.Settings.Root
+	dir := filepath.Join(root, "v"+version)
+	if active {
+		if err := m.validSymlink(); err != nil {
+			return err
+		}
+	}
+
+	// Move the version out of the way first. This fails without changing
+	// anything when files are in use (e.g. a running node.exe).
+	trashed, err := file.Trash(root, dir)
+	if err != nil {
+		return fmt.Errorf("error removing node v%s: %w", version, err)
+	}
+
+	if active {
+		if err := m.deactivate(); err != nil {
+			// The symlink still points to the version, so restoring the
+			// directory makes it valid again.
+			if rerr := file.Restore(trashed, dir); rerr != nil {
+				return fmt.Errorf("%v\nError restoring node v%s: %v\nManually move %s to %s.", err, version, rerr, trashed, dir)
+			}
+			return err
+		}
+	}
+
+	// The version is uninstalled at this point. Anything left behind
+	// is removed with the trash by the next command that changes installations.
+	if err := file.EmptyTrash(root); err != nil {
+		utility.DebugLogf("failed to empty the trash: %v", err)
+	}
+	m.refreshShims()
+
+	return nil
+}
+
+// RemoveArchitecture removes a single architecture of a version that has
+// several installed.
+func (m *Manager) RemoveArchitecture(version string, a arch.Architecture) error {
+	return node.RemoveArchitecture(filepath.Join(m.Settings.Root, "v"+version), a)
+}
+
+// Link registers an external node directory (i.e. a custom build) as a
+// named version, which can be used like any installed version. It returns
+// the architecture the build provides.
+func (m *Manager) Link(name string, path string) (arch.Architecture, error) {
+	if err := node.CreateLink(m.Settings.Root, name, path); err != nil {
+		return arch.Unknown, err
+	}
+
+	return node.ActiveArchitecture(filepath.Join(m.Settings.Root, name)), nil
+}
+
+// Unlink removes a named version without touching its target. An active
+// named version is deactivated first.
+func (m *Manager) Unlink(name string, active bool) error {
+	if active {
+		if err := m.validSymlink(); err != nil {
+			return err
+		}
+		if err := m.deactivate(); err != nil {
+			return err
+		}
+	}
+
+	return node.RemoveLink(m.Settings.Root, name)
+}
@@ -0,0 +1,138 @@
+package manager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"nvm/arch"
+	"nvm/encoding"
+	"nvm/file"
+	"nvm/link"
+	"nvm/shim"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Settings are the contents of NVM_HOME\settings.txt, together with the
+// NVM_SYMLINK location.
+type Settings struct {
+	// File is the path of settings.txt.
+	File            string
+	Root            string
+	Symlink         string
+	Arch            arch.Architecture
+	NodeMirror      string
+	NpmMirror       string
+	Proxy           string
+	OriginalPath    string
+	OriginalVersion string
+	VerifySSL       bool
+	LinkType        link.Kind
+	// Activation is "symlink" or shim.Mode.
+	Activation string
+	// DefaultVersion is the version the shims run (shim activation only).
+	DefaultVersion string
+
+	// Warnings lists settings that could not be read and were reset to
+	// their defaults by Load.
+	Warnings []error
+}
+
+// NewSettings returns the default settings for a settings file.
+func NewSettings(path string, symlink string) *Settings {
+	return &Settings{
+		File:       path,
+		Symlink:    symlink,
+		Arch:       arch.Host(),
+		Proxy:      "none",
+		VerifySSL:  true,
+		LinkType:   link.Auto,
+		Activation: "symlink",
+	}
+}
+
+// Home is the directory containing settings.txt (NVM_HOME).
+func (s *Settings) Home() string {
+	return filepath.Dir(s.File)
+}
+
+// Load reads the settings file. Settings missing from it keep their values.
+func (s *Settings) Load() error {
+	m, err := file.ReadSettings(s.File)
+	if err != nil {
+		return err
+	}
+
+	if val, ok := m["root"]; ok {
+		s.Root = filepath.Clean(val)
+	}
+	if val, ok := m["originalpath"]; ok {
+		s.OriginalPath = filepath.Clean(val)
+	}
+	if val, ok := m["originalversion"]; ok {
+		s.OriginalVersion = val
+	}
+	if val, ok := m["arch"]; ok {
+		if a, err := arch.Parse(val); err == nil {
+			s.Arch = a
+		}
+	}
+	if val, ok := m["node_mirror"]; ok {
+		s.NodeMirror = val
+	}
+	if val, ok := m["npm_mirror"]; ok {
+		s.NpmMirror = val
+	}
+	if val, ok := m["activation"]; ok && val == shim.Mode {
+		s.Activation = val
+	}
+	if val, ok := m["default_version"]; ok {
+		s.DefaultVersion = val
+	}
+	if val, ok := m["link_type"]; ok {
+		if kind, err := link.Parse(val); err == nil {
+			s.LinkType = kind
+		} else {
+			s.Warnings = append(s.Warnings, fmt.Errorf("%v in %s. Using auto.", err, s.File))
+		}
+	}
+
+	if val, ok := m["proxy"]; ok {
+		if val != "none" && val != "" {
+			if strings.ToLower(val[0:4]) != "http" {
+				val = "http://" + val
+			}
+			res, err := url.Parse(val)
+			if err == nil {
+				s.Proxy = res.String()
+			}
+		}
+	}
+
+	return nil
+}
+
+// Save writes the settings file. A copy is written first, so a failure
+// never leaves truncated settings.
+func (s *Settings) Save() error {
+	content := "root: " + strings.Trim(encode(s.Root), " \n\r") + "\r\narch: " + strings.Trim(encode(s.Arch.Bits()), " \n\r") + "\r\nproxy: " + strings.Trim(encode(s.Proxy), " \n\r") + "\r\noriginalpath: " + strings.Trim(encode(s.OriginalPath), " \n\r") + "\r\noriginalversion: " + strings.Trim(encode(s.OriginalVersion), " \n\r")
+	content = content + "\r\nnode_mirror: " + strings.Trim(encode(s.NodeMirror), " \n\r") + "\r\nnpm_mirror: " + strings.Trim(encode(s.NpmMirror), " \n\r")
+	content = content + "\r\nlink_type: " + s.LinkType.String()
+	content = content + "\r\nactivation: " + s.Activation + "\r\ndefault_version: " + s.DefaultVersion
+
+	err := ioutil.WriteFile(s.File+".tmp", []byte(content), 0644)
+	if err == nil {
+		err = os.Rename(s.File+".tmp", s.File)
+	}
+	if err != nil {
+		os.Remove(s.File + ".tmp")
+		return err
+	}
+
+	return nil
+}
+
+func encode(val string) string {
+	return string(encoding.ToUTF8(val))
+}
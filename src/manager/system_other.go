@@ -0,0 +1,20 @@
+//go:build !windows
+
+package manager
+
+import "nvm/link"
+
+// Permissions reports whether the user is an administrator and whether the
+// process runs elevated.
+func Permissions() (admin bool, elevated bool, err error) {
+	return false, false, link.ErrUnsupported
+}
+
+// DeveloperMode reports whether Windows developer mode is enabled.
+func DeveloperMode() (bool, error) {
+	return false, link.ErrUnsupported
+}
+
+func (m *Manager) elevatedRun(name string, arg ...string) error {
+	return link.ErrUnsupported
+}
@@ -0,0 +1,78 @@
+package manager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// Permissions reports whether the user is an administrator and whether the
+// process runs elevated.
+func Permissions() (admin bool, elevated bool, err error) {
+	admin = false
+	elevated = false
+	var sid *windows.SID
+	err = windows.AllocateAndInitializeSid(
+		&windows.SECURITY_NT_AUTHORITY,
+		2,
+		windows.SECURITY_BUILTIN_DOMAIN_RID,
+		windows.DOMAIN_ALIAS_RID_ADMINS,
+		0, 0, 0, 0, 0, 0,
+		&sid)
+	if err != nil {
+		return
+	}
+	defer windows.FreeSid(sid)
+
+	token := windows.Token(0)
+	elevated = token.IsElevated()
+	admin, err = token.IsMember(sid)
+
+	return
+}
+
+// DeveloperMode reports whether Windows developer mode, which allows
+// unprivileged users to create symlinks, is enabled.
+func DeveloperMode() (bool, error) {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows\CurrentVersion\AppModelUnlock`, registry.QUERY_VALUE)
+	if err != nil {
+		return false, err
+	}
+	defer k.Close()
+
+	value, _, err := k.GetIntegerValue("AllowDevelopmentWithoutDevLicense")
+	if err != nil {
+		return false, err
+	}
+
+	return value > 0, nil
+}
+
+// Runs a cmd built-in, retrying with elevate.cmd when it fails.
+func (m *Manager) elevatedRun(name string, arg ...string) error {
+	err := run("cmd", "", append([]string{"/C", name}, arg...)...)
+	if err != nil {
+		cmd := filepath.Join(m.Bin, "elevate.cmd")
+		err = run(cmd, m.Settings.Root, append([]string{"cmd", "/C", name}, arg...)...)
+	}
+
+	return err
+}
+
+func run(name string, dir string, arg ...string) error {
+	c := exec.Command(name, arg...)
+	c.Dir = dir
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	err := c.Run()
+	if err != nil {
+		return errors.New(fmt.Sprint(err) + ": " + stderr.String())
+	}
+
+	return nil
+}
@@ -0,0 +1,267 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"nvm/arch"
+	"nvm/exit"
+	"nvm/link"
+	"nvm/node"
+	"nvm/shim"
+	"path/filepath"
+	"strings"
+)
+
+// UseResult describes the version activated by Use.
+type UseResult struct {
+	Version string
+	Arch    arch.Architecture
+	// Unchanged is true when the version was already active.
+	Unchanged bool
+}
+
+// NotInstalledError is returned when the version to use is not installed
+// for the requested architecture.
+type NotInstalledError struct {
+	Version string
+	Arch    arch.Architecture
+	// Installed lists the architectures of the version that are installed
+	// and can run on this computer.
+	Installed []arch.Architecture
+}
+
+func (e *NotInstalledError) Error() string {
+	return fmt.Sprintf("node v%s (%v) is not installed.", e.Version, e.Arch.Label())
+}
+
+func (e *NotInstalledError) Is(target error) bool {
+	return target == exit.ErrNotFound
+}
+
+// Use activates an installed version (see Resolve for the accepted
+// arguments). In symlink mode, NVM_SYMLINK is pointed to the version; in
+// shim mode, it becomes the default version the shims run.
+func (m *Manager) Use(spec string, a arch.Architecture) (*UseResult, error) {
+	s := m.Settings
+
+	version, a, err := m.Resolve(spec, a, true)
+	if err != nil {
+		return nil, err
+	}
+	result := &UseResult{Version: version, Arch: a}
+
+	// Check if a change is needed
+	current, currentArch := m.Active()
+	if version == current && a == currentArch {
+		result.Unchanged = true
+		return result, nil
+	}
+
+	if host := arch.Host(); !host.CanRun(a) {
+		return result, fmt.Errorf("this computer (%s) cannot run %s executables.", host.Label(), a.Label())
+	}
+
+	if !node.IsVersionInstalled(s.Root, version, a) {
+		missing := &NotInstalledError{Version: version, Arch: a}
+		for _, other := range arch.Host().Runnable() {
+			if other != a && node.IsVersionInstalled(s.Root, version, other) {
+				missing.Installed = append(missing.Installed, other)
+			}
+		}
+		return result, missing
+	}
+
+	dir := node.Dir(s.Root, version)
+	if s.Activation == shim.Mode {
+		// The shims run the default version unless a session or
+		// project selects another one
+		if err := m.installShims(); err != nil {
+			return result, err
+		}
+		s.DefaultVersion = version
+		if err := s.Save(); err != nil {
+			return result, err
+		}
+	} else {
+		// Replace the symlink (never a physical directory)
+		if err := m.validSymlink(); err != nil {
+			return result, err
+		}
+
+		if err := m.activate(dir); err != nil {
+			if errors.Is(err, link.ErrPermission) {
+				err = fmt.Errorf("failed to elevate permissions to create symlink: %w\nSee https://bit.ly/nvm4w-help", err)
+			}
+			return result, err
+		}
+	}
+
+	// Use the assigned CPU architecture (i.e. node-x64.exe -> node.exe)
+	if err := node.Activate(dir, a); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// Disable deactivates node. In shim mode, the shims are removed.
+func (m *Manager) Disable() error {
+	if m.Settings.Activation == shim.Mode {
+		return shim.Remove(m.Settings.Symlink)
+	}
+
+	if err := m.validSymlink(); err != nil {
+		return err
+	}
+
+	return m.deactivate()
+}
+
+// SetActivation switches between symlink and shim activation, keeping the
+// active version. Switching to symlink activation uses that version again,
+// and returns the result.
+func (m *Manager) SetActivation(mode string) (*UseResult, error) {
+	s := m.Settings
+	mode = strings.ToLower(mode)
+	if mode != "symlink" && mode != shim.Mode {
+		return nil, fmt.Errorf("\"%s\" is not a valid activation mode. Use symlink or shim.", mode)
+	}
+
+	if mode == s.Activation {
+		return nil, nil
+	}
+
+	version, _ := m.Active()
+	if version == "Unknown" {
+		version = ""
+	}
+
+	if mode == shim.Mode {
+		if err := m.validSymlink(); err != nil {
+			return nil, err
+		}
+		if err := m.deactivate(); err != nil {
+			return nil, err
+		}
+		if err := m.installShims(); err != nil {
+			return nil, err
+		}
+
+		s.Activation = shim.Mode
+		s.DefaultVersion = version
+		return nil, s.Save()
+	}
+
+	if err := shim.Remove(s.Symlink); err != nil {
+		return nil, err
+	}
+
+	s.Activation = "symlink"
+	s.DefaultVersion = ""
+	if err := s.Save(); err != nil {
+		return nil, err
+	}
+
+	if version == "" {
+		return nil, nil
+	}
+
+	return m.Use(version, arch.Unknown)
+}
+
+// LinkKind returns the kind of link to create for NVM_SYMLINK. With auto,
+// symlinks are used when the user may create them (elevated or developer
+// mode), and junctions otherwise, so Use does not prompt for elevation.
+func (m *Manager) LinkKind() link.Kind {
+	if m.Settings.LinkType != link.Auto {
+		return m.Settings.LinkType
+	}
+
+	if admin, elevated, err := Permissions(); err == nil && (admin || elevated) {
+		return link.Auto
+	}
+	if enabled, err := DeveloperMode(); err == nil && enabled {
+		return link.Auto
+	}
+
+	return link.Junction
+}
+
+// Prevents the deletion of a physical file or directory at NVM_SYMLINK.
+// This isn't supposed to ever happen, but users have manually changed the
+// settings.txt, removing the physical file/directory unintentionally.
+func (m *Manager) validSymlink() error {
+	path := filepath.Clean(m.Settings.Symlink)
+	if m.Settings.Activation == shim.Mode && shim.IsInstalled(path) {
+		return nil
+	}
+
+	if _, err := link.OS.Lstat(path); err == nil && !link.Default.IsLink(path) {
+		return fmt.Errorf("NVM_SYMLINK is set to a physical file/directory at %s\nPlease remove the location and try again, or select a different location for NVM_SYMLINK.", m.Settings.Symlink)
+	}
+
+	return nil
+}
+
+// Writes the shims to NVM_SYMLINK unless they are already there, in which
+// case the launchers of global package executables are refreshed.
+func (m *Manager) installShims() error {
+	if shim.IsInstalled(m.Settings.Symlink) {
+		return shim.Refresh(m.Settings.Symlink, m.Settings.Root)
+	}
+
+	return shim.Install(m.Settings.Symlink, filepath.Join(m.Bin, shim.Executable), m.Settings.Root)
+}
+
+// Refreshes the launchers of global package executables after versions or
+// global packages were installed or removed (shim mode only).
+func (m *Manager) refreshShims() {
+	if m.Settings.Activation != shim.Mode || !shim.IsInstalled(m.Settings.Symlink) {
+		return
+	}
+
+	if err := shim.Refresh(m.Settings.Symlink, m.Settings.Root); err != nil {
+		m.warn("", "failed to update the shims of global package executables: %v", err)
+	}
+}
+
+// Points NVM_SYMLINK to a version directory. Elevation is only requested
+// when the user cannot modify the NVM_SYMLINK location itself (i.e. within
+// Program Files).
+func (m *Manager) activate(dir string) error {
+	symlink := filepath.Clean(m.Settings.Symlink)
+	kind := m.LinkKind()
+	_, err := link.Default.Replace(symlink, dir, kind)
+	if !errors.Is(err, link.ErrPermission) {
+		return err
+	}
+
+	if link.Default.IsLink(symlink) {
+		if err := m.elevatedRun("rmdir", symlink); err != nil {
+			return err
+		}
+	}
+
+	option := "/D"
+	if kind == link.Junction {
+		option = "/J"
+	}
+	return m.elevatedRun("mklink", option, symlink, dir)
+}
+
+// Removes NVM_SYMLINK, elevating only when access is denied. In shim mode,
+// the default version is cleared instead.
+func (m *Manager) deactivate() error {
+	s := m.Settings
+	if s.Activation == shim.Mode {
+		s.DefaultVersion = ""
+		return s.Save()
+	}
+
+	err := link.Default.Remove(s.Symlink)
+	if errors.Is(err, link.ErrPermission) {
+		err = m.elevatedRun("rmdir", filepath.Clean(s.Symlink))
+	}
+
+	return err
+}
@@ -0,0 +1,314 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"nvm/arch"
+	"nvm/exit"
+	"nvm/node"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/blang/semver"
+)
+
+// Resolve returns the version and architecture a version argument refers
+// to. The argument can be a version (partial versions select the newest
+// matching one), "latest" (or "node"), "lts", "newest" (the newest installed
+// version), a release name (i.e. "hydrogen"), a named version (see Link), or
+// an architecture, which selects the active version. An unknown
+// architecture selects the default one. With local, partial versions match
+// installed versions first.
+func (m *Manager) Resolve(spec string, a arch.Architecture, local bool) (string, arch.Architecture, error) {
+	s := m.Settings
+	version := spec
+
+	if a == arch.Unknown {
+		a = s.Arch
+	}
+
+	if version == "" {
+		return "", a, exit.New(exit.ErrUsage, "A version argument is required but missing.")
+	}
+
+	// Named versions default to the architecture they provide
+	if node.IsLinked(s.Root, version) {
+		dir := node.Dir(s.Root, version)
+		if !node.HasArchitecture(dir, a) {
+			a = node.ActiveArchitecture(dir)
+		}
+		return version, a, nil
+	}
+
+	var err error
+	switch version {
+	case "latest", "node":
+		version, err = m.Latest()
+	case "lts":
+		version, err = m.LTS()
+	case "newest":
+		installed := node.GetInstalled(s.Root)
+		if len(installed) == 0 {
+			return version, a, exit.New(exit.ErrNotFound, "No versions of node.js found. Try installing the latest by typing nvm install latest.")
+		}
+		version = installed[0]
+	}
+	if err != nil {
+		return "", a, err
+	}
+
+	if parsed, err := arch.Parse(version); err == nil {
+		a = parsed
+		version, _ = m.Active()
+		if version == "Unknown" {
+			return "", a, exit.New(exit.ErrNotFound, "No version is active. Provide the version to use.")
+		}
+	}
+
+	version, err = m.versionNumber(version)
+	if err != nil {
+		return "", a, err
+	}
+
+	v, err := semver.Make(version)
+	if err == nil {
+		err = v.Validate()
+	}
+
+	if err == nil {
+		if len(v.Pre) == 0 {
+			version = CleanVersion(version)
+		}
+	} else if strings.Contains(err.Error(), "No Major.Minor.Patch") {
+		// Partial versions select the newest matching version
+		version, err = m.latestSubVersion(version, local)
+		if err == nil && len(version) == 0 {
+			err = exit.New(exit.ErrNotFound, "Unrecognized version: \""+spec+"\"")
+		}
+	}
+
+	return version, a, err
+}
+
+// Strips the "v" prefix of a version. Release names (i.e. "hydrogen") are
+// looked up.
+func (m *Manager) versionNumber(version string) (string, error) {
+	reg := regexp.MustCompile("[^0-9]")
+
+	if reg.MatchString(version[:1]) && version[0:1] != "v" {
+		url := m.Web.GetFullNodeUrl("latest-" + version + "/SHASUMS256.txt")
+		remoteContent, err := m.Web.GetRemoteTextFile(url)
+		if errors.Is(err, exit.ErrNotFound) {
+			err = nil
+		}
+		if err != nil {
+			return "", err
+		}
+		content := strings.Split(remoteContent, "\n")[0]
+		if strings.Contains(content, "node") {
+			parts := strings.Split(content, "-")
+			if len(parts) > 1 {
+				if parts[1][0:1] == "v" {
+					return parts[1][1:], nil
+				}
+			}
+		}
+		return "", exit.Errorf(exit.ErrNotFound, "\"%v\" is not a valid version or known alias.\n\nAvailable aliases: latest, node (latest), lts\nNamed releases (boron, dubnium, etc) are also supported.", version)
+	}
+
+	for len(version) > 0 && reg.MatchString(version[:1]) {
+		version = version[1:]
+	}
+
+	return version, nil
+}
+
+func splitVersion(version string) map[string]int {
+	parts := strings.Split(version, ".")
+	var result = make([]int, 3)
+
+	for i, item := range parts {
+		v, _ := strconv.Atoi(item)
+		result[i] = v
+	}
+
+	return map[string]int{
+		"major": result[0],
+		"minor": result[1],
+		"patch": result[2],
+	}
+}
+
+// Returns the newest version matching a partial version (i.e. 18 or
+// 18.2). With localOnly, installed versions are searched first.
+func (m *Manager) latestSubVersion(version string, localOnly bool) (string, error) {
+	if localOnly {
+		installed := node.GetInstalled(m.Settings.Root)
+		result := ""
+		for _, v := range installed {
+			if strings.HasPrefix(v, "v"+version) {
+				if result != "" {
+					current, _ := semver.New(strings.TrimPrefix(result, "v"))
+					next, _ := semver.New(strings.TrimPrefix(v, "v"))
+					if current.LT(*next) {
+						result = v
+					}
+				} else {
+					result = v
+				}
+			}
+		}
+
+		if len(strings.TrimSpace(result)) > 0 {
+			return strings.TrimPrefix(result, "v"), nil
+		}
+	}
+
+	// Other sources do not publish latest-vX.x directories, so their index
+	// (sorted newest first) is searched instead.
+	if !m.Web.Source().Official() {
+		all, _, _, _, _, _, err := m.available()
+		if err != nil {
+			return "", err
+		}
+		for _, v := range all {
+			if strings.HasPrefix(v, version+".") {
+				return v, nil
+			}
+		}
+		return "", nil
+	}
+
+	if len(strings.Split(version, ".")) == 2 {
+		all, _, _, _, _, _, err := m.available()
+		if err != nil {
+			return "", err
+		}
+		requested := splitVersion(version + ".0")
+		for _, v := range all {
+			available := splitVersion(v)
+			if requested["major"] == available["major"] {
+				if requested["minor"] == available["minor"] {
+					if available["patch"] > requested["patch"] {
+						requested["patch"] = available["patch"]
+					}
+				}
+				if requested["minor"] > available["minor"] {
+					break
+				}
+			}
+
+			if requested["major"] > available["major"] {
+				break
+			}
+		}
+		return fmt.Sprintf("%v.%v.%v", requested["major"], requested["minor"], requested["patch"]), nil
+	}
+
+	url := m.Web.GetFullNodeUrl("latest-v" + version + ".x" + "/SHASUMS256.txt")
+	content, err := m.Web.GetRemoteTextFile(url)
+	if err != nil {
+		if errors.Is(err, exit.ErrNotFound) {
+			return "", exit.Errorf(exit.ErrNotFound, "\"%s\" is not a valid version number (or partial version number).\n\nIf you are trying to install a version that was just announced within the last few minutes, it may not be available for download yet (try again in 15 minutes).", version)
+		}
+		return "", err
+	}
+	re := regexp.MustCompile("node-v(.+)+msi")
+	reg := regexp.MustCompile("node-v|-[xa].+")
+	return reg.ReplaceAllString(re.FindString(content), ""), nil
+}
+
+// Reports whether a version is newer than the latest release.
+func (m *Manager) exceedsLatest(version string) (bool, error) {
+	latest, err := m.officialLatest()
+	if err != nil {
+		return false, err
+	}
+
+	var vArr = strings.Split(version, ".")
+	var lArr = strings.Split(latest, ".")
+	for index := range lArr {
+		lat, _ := strconv.Atoi(lArr[index])
+		ver, _ := strconv.Atoi(vArr[index])
+		//Should check for valid input (checking for conversion errors) but this tool is made to trust the user
+		if ver < lat {
+			return false, nil
+		} else if ver > lat {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CleanVersion completes a partial version number (i.e. 18 -> 18.0.0).
+func CleanVersion(version string) string {
+	re := regexp.MustCompile("\\d+.\\d+.\\d+")
+	matched := re.FindString(version)
+
+	if len(matched) == 0 {
+		re = regexp.MustCompile("\\d+.\\d+")
+		matched = re.FindString(version)
+		if len(matched) == 0 {
+			matched = version + ".0.0"
+		} else {
+			matched = matched + ".0"
+		}
+	}
+
+	return matched
+}
+
+// Returns the npm version bundled with a node version.
+func (m *Manager) npmVersion(nodeversion string) (string, error) {
+	_, _, _, _, _, npm, err := m.available()
+	if err != nil {
+		return "", err
+	}
+	if len(npm) == 0 {
+		return "", exit.New(exit.ErrNetwork, "Error looking up versions: Remote host returned no results. This usually indicates a problem with with Node.js web server. Please try again in a few minutes.")
+	}
+	return npm[nodeversion], nil
+}
+
+// Latest returns the latest node release of the current source.
+func (m *Manager) Latest() (string, error) {
+	if !m.Web.Source().Official() {
+		all, _, _, _, _, _, err := m.available()
+		if err != nil {
+			return "", err
+		}
+		if len(all) == 0 {
+			return "", exit.Errorf(exit.ErrNetwork, "No versions are available from %s", m.Web.Source().IndexURL())
+		}
+		return all[0], nil
+	}
+
+	return m.officialLatest()
+}
+
+func (m *Manager) officialLatest() (string, error) {
+	url := m.Web.GetFullNodeUrl("latest/SHASUMS256.txt")
+	content, err := m.Web.GetRemoteTextFile(url)
+	if err != nil {
+		return "", err
+	}
+	re := regexp.MustCompile("node-v(.+)+msi")
+	reg := regexp.MustCompile("node-v|-[xa].+")
+	return reg.ReplaceAllString(re.FindString(content), ""), nil
+}
+
+// LTS returns the latest long-term support release.
+func (m *Manager) LTS() (string, error) {
+	_, ltsList, _, _, _, _, err := m.available()
+	if err != nil {
+		return "", err
+	}
+
+	if len(ltsList) == 0 {
+		return "", exit.New(exit.ErrNetwork, "Error looking up LTS version: Remote host returned no results. This usually indicates a problem with with Node.js web server. Please try again in a few minutes.")
+	}
+
+	// ltsList has already been numerically sorted
+	return ltsList[0], nil
+}
@@ -0,0 +1,50 @@
+package node
+
+import (
+	"fmt"
+	"nvm/arch"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var artifactName = regexp.MustCompile(`(?i)^node-v(\d+\.\d+\.\d+(?:-[0-9a-z.]+)?)-win-(x86|x64|arm64)(?:\.zip)?$`)
+
+// ParseArtifact returns the version and architecture encoded in the name of
+// a distribution archive or directory (i.e. node-v20.11.1-win-x64.zip).
+func ParseArtifact(name string) (string, arch.Architecture, bool) {
+	match := artifactName.FindStringSubmatch(filepath.Base(name))
+	if match == nil {
+		return "", arch.Unknown, false
+	}
+
+	a, err := arch.Parse(match[2])
+	if err != nil {
+		return "", arch.Unknown, false
+	}
+
+	return match[1], a, true
+}
+
+// Inspect detects the version and architecture of the node.exe within dir.
+// The architecture is read from the PE header. The version is reported by
+// node -v, so it is empty when this computer cannot run the executable.
+func Inspect(dir string) (string, arch.Architecture, error) {
+	exe := filepath.Join(dir, "node.exe")
+	img, err := arch.Detect(exe)
+	if err != nil {
+		return "", arch.Unknown, fmt.Errorf("%s is not a valid node executable: %v", exe, err)
+	}
+
+	if !arch.Host().CanRun(img.Arch) {
+		return "", img.Arch, nil
+	}
+
+	out, err := exec.Command(exe, "-v").Output()
+	if err != nil {
+		return "", img.Arch, fmt.Errorf("failed to run %s -v: %v", exe, err)
+	}
+
+	return strings.TrimPrefix(strings.TrimSpace(string(out)), "v"), img.Arch, nil
+}
@@ -0,0 +1,192 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"nvm/arch"
+	"nvm/file"
+	"os"
+	"path/filepath"
+)
+
+// An installation directory can hold several architectures of the same
+// version side by side. The active architecture is always node.exe, and
+// every other architecture is stored as node-<arch>.exe (i.e. node-x64.exe
+// and node-arm64.exe). Older releases of nvm used node32.exe and
+// node64.exe, which are migrated by MigrateLayout.
+var legacyExecutables = map[string]arch.Architecture{
+	"node32.exe": arch.X86,
+	"node64.exe": arch.X64,
+}
+
+// MigrateLayout renames the legacy node32.exe/node64.exe executables of an
+// installation directory to the node-<arch>.exe layout.
+func MigrateLayout(dir string) error {
+	for name, a := range legacyExecutables {
+		legacy := filepath.Join(dir, name)
+		if !file.Exists(legacy) {
+			continue
+		}
+
+		target := filepath.Join(dir, a.Executable())
+		if file.Exists(target) {
+			if err := os.Remove(legacy); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := os.Rename(legacy, target); err != nil {
+			return fmt.Errorf("failed to migrate %s: %v", legacy, err)
+		}
+	}
+
+	return nil
+}
+
+// SourceFile records the distribution an installation was downloaded from.
+const SourceFile = ".nvm-source.json"
+
+type Source struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// RecordSource stores the distribution an installation was downloaded from.
+func RecordSource(dir string, name string, url string) error {
+	data, err := json.Marshal(Source{Name: name, URL: url})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, SourceFile), data, os.ModePerm)
+}
+
+// GetSource returns the distribution an installation was downloaded from.
+// Installations without a record are assumed to be official.
+func GetSource(dir string) Source {
+	result := Source{Name: "official"}
+	data, err := os.ReadFile(filepath.Join(dir, SourceFile))
+	if err == nil {
+		json.Unmarshal(data, &result)
+	}
+	return result
+}
+
+// ActiveArchitecture returns the architecture of the installation's node.exe.
+func ActiveArchitecture(dir string) arch.Architecture {
+	img, err := arch.Detect(filepath.Join(dir, "node.exe"))
+	if err != nil {
+		return arch.Unknown
+	}
+	return img.Arch
+}
+
+// Architectures lists every architecture available within an installation
+// directory, starting with the active architecture.
+func Architectures(dir string) []arch.Architecture {
+	result := make([]arch.Architecture, 0)
+	active := ActiveArchitecture(dir)
+	if active != arch.Unknown {
+		result = append(result, active)
+	}
+
+	for _, a := range []arch.Architecture{arch.ARM64, arch.X64, arch.X86} {
+		if a == active {
+			continue
+		}
+
+		if file.Exists(filepath.Join(dir, a.Executable())) {
+			result = append(result, a)
+			continue
+		}
+
+		for name, legacy := range legacyExecutables {
+			if legacy == a && file.Exists(filepath.Join(dir, name)) {
+				result = append(result, a)
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+// HasArchitecture reports whether the architecture is available within an
+// installation directory.
+func HasArchitecture(dir string, a arch.Architecture) bool {
+	for _, available := range Architectures(dir) {
+		if available == a {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveArchitecture deletes a single architecture from an installation
+// directory. When it is the active architecture, the next available one is
+// activated first. The last architecture cannot be removed this way.
+func RemoveArchitecture(dir string, a arch.Architecture) error {
+	if err := MigrateLayout(dir); err != nil {
+		return err
+	}
+
+	available := Architectures(dir)
+	if !HasArchitecture(dir, a) {
+		return fmt.Errorf("the %s executable is not installed in %s", a.Label(), dir)
+	}
+	if len(available) == 1 {
+		return fmt.Errorf("%s is the only architecture installed in %s", a.Label(), dir)
+	}
+
+	if ActiveArchitecture(dir) == a {
+		for _, other := range available {
+			if other != a {
+				if err := Activate(dir, other); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+
+	return os.Remove(filepath.Join(dir, a.Executable()))
+}
+
+// Activate makes the architecture the active node.exe of an installation
+// directory. The previously active node.exe is stored as node-<arch>.exe.
+func Activate(dir string, a arch.Architecture) error {
+	if err := MigrateLayout(dir); err != nil {
+		return err
+	}
+
+	active := ActiveArchitecture(dir)
+	if active == a {
+		return nil
+	}
+
+	nodepath := filepath.Join(dir, "node.exe")
+	target := filepath.Join(dir, a.Executable())
+	if !file.Exists(target) {
+		return fmt.Errorf("the %s executable is not installed in %s", a.Label(), dir)
+	}
+
+	if file.Exists(nodepath) {
+		if active == arch.Unknown {
+			return fmt.Errorf("cannot determine the architecture of %s", nodepath)
+		}
+
+		inactive := filepath.Join(dir, active.Executable())
+		if err := os.Rename(nodepath, inactive); err != nil {
+			return err
+		}
+
+		if err := os.Rename(target, nodepath); err != nil {
+			os.Rename(inactive, nodepath)
+			return err
+		}
+
+		return nil
+	}
+
+	return os.Rename(target, nodepath)
+}
@@ -0,0 +1,134 @@
+package node
+
+import (
+	"fmt"
+	"nvm/arch"
+	"nvm/file"
+	"nvm/link"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/blang/semver"
+)
+
+// Named versions are external node directories (i.e. custom builds)
+// registered with nvm link. Each one is a directory junction inside the
+// root, named after the version, so it can be used like any installed
+// version. Removing it only removes the junction.
+
+var linkName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9._-]*$`)
+
+// Aliases and other arguments a named version cannot be confused with.
+var reservedNames = []string{"all", "current", "latest", "lts", "newest", "node", "off", "stable", "system"}
+
+type Link struct {
+	Name   string
+	Target string
+}
+
+// ValidateName returns an error when name cannot be used for a named
+// version, i.e. because it could be mistaken for a version or an alias.
+func ValidateName(name string) error {
+	if !linkName.MatchString(name) {
+		return fmt.Errorf("\"%s\" is not a valid name (use letters, digits, \".\", \"-\" and \"_\", starting with a letter)", name)
+	}
+
+	lower := strings.ToLower(name)
+	for _, reserved := range reservedNames {
+		if lower == reserved {
+			return fmt.Errorf("\"%s\" is reserved and cannot be used as a name", name)
+		}
+	}
+
+	if _, err := arch.Parse(name); err == nil {
+		return fmt.Errorf("\"%s\" is an architecture and cannot be used as a name", name)
+	}
+
+	if len(lower) > 1 && lower[0] == 'v' && lower[1] >= '0' && lower[1] <= '9' {
+		return fmt.Errorf("\"%s\" looks like a version and cannot be used as a name", name)
+	}
+
+	if _, err := semver.Make(lower); err == nil {
+		return fmt.Errorf("\"%s\" looks like a version and cannot be used as a name", name)
+	}
+
+	return nil
+}
+
+// IsLinked reports whether name is a named version.
+func IsLinked(root string, name string) bool {
+	if ValidateName(name) != nil {
+		return false
+	}
+
+	return link.Default.IsLink(filepath.Join(root, name))
+}
+
+// Dir returns the directory of an installed or named version.
+func Dir(root string, version string) string {
+	if IsLinked(root, version) {
+		return filepath.Join(root, version)
+	}
+
+	return filepath.Join(root, "v"+version)
+}
+
+// GetLinked returns the named versions, sorted by name.
+func GetLinked(root string) []Link {
+	links := make([]Link, 0)
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return links
+	}
+
+	for _, entry := range entries {
+		if ValidateName(entry.Name()) != nil {
+			continue
+		}
+
+		target, err := link.Default.Target(filepath.Join(root, entry.Name()))
+		if err != nil {
+			continue
+		}
+
+		links = append(links, Link{Name: entry.Name(), Target: target})
+	}
+
+	sort.Slice(links, func(i, j int) bool {
+		return strings.ToLower(links[i].Name) < strings.ToLower(links[j].Name)
+	})
+
+	return links
+}
+
+// CreateLink registers an external node directory as a named version.
+// Junctions do not require elevated permissions.
+func CreateLink(root string, name string, target string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+
+	target, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+
+	if !file.Exists(filepath.Join(target, "node.exe")) {
+		return fmt.Errorf("%s does not contain node.exe", target)
+	}
+
+	_, err = link.Default.Create(filepath.Join(root, name), target, link.Junction)
+	return err
+}
+
+// RemoveLink removes a named version without touching its target.
+func RemoveLink(root string, name string) error {
+	if !IsLinked(root, name) {
+		return fmt.Errorf("%s is not a named version", name)
+	}
+
+	return link.Default.Remove(filepath.Join(root, name))
+}
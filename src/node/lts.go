@@ -0,0 +1,65 @@
+package node
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LTSFile is the file in the nvm root caching the LTS versions of the last
+// version list retrieved by GetAvailable, so "lts/*" and "lts/<codename>"
+// in .nvmrc files resolve without network access.
+const LTSFile = ".lts.json"
+
+// saveLTS caches the LTS codename (lowercase) of each LTS version in the
+// nvm root.
+func saveLTS(root string, codenames map[string]string) {
+	if root == "" || len(codenames) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(codenames)
+	if err != nil {
+		return
+	}
+
+	// Written to a temporary file first, so the shims never read a
+	// partial cache
+	path := filepath.Join(root, LTSFile)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		os.Remove(path + ".tmp")
+	}
+}
+
+// LTSCodenames returns the cached LTS codename (lowercase) of each LTS
+// version, or an empty map when the version list was never retrieved.
+func LTSCodenames(root string) map[string]string {
+	codenames := make(map[string]string)
+	data, err := os.ReadFile(filepath.Join(root, LTSFile))
+	if err == nil {
+		json.Unmarshal(data, &codenames)
+	}
+
+	return codenames
+}
+
+// matchLTS returns the newest installed version of an LTS release line:
+// any line for "*", or the line with the given codename.
+func matchLTS(root string, installed []string, codename string) string {
+	codenames := LTSCodenames(root)
+	codename = strings.ToLower(codename)
+
+	// Installed versions are sorted newest first
+	for _, v := range installed {
+		v = strings.TrimPrefix(v, "v")
+		if name, ok := codenames[v]; ok && (codename == "*" || name == codename) {
+			return v
+		}
+	}
+
+	return ""
+}
@@ -5,21 +5,89 @@ import (
 	"fmt"
 	"io/ioutil"
 	"nvm/arch"
-	"nvm/file"
+	"nvm/exit"
 	"nvm/web"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
 	// "../semver"
 	"github.com/blang/semver"
 )
 
+// Current describes the active node installation.
+type Current struct {
+	Version string
+	Arch    arch.Architecture
+	// Path is the directory of the active installation.
+	Path string
+	// Foreign is true when the first node.exe found in the PATH is not the
+	// one managed by nvm. ForeignPath identifies its location.
+	Foreign     bool
+	ForeignPath string
+}
+
+// GetCurrent identifies the active installation by reading the target of
+// the NVM_SYMLINK, and determines the architecture from the PE header of its
+// node.exe. node.exe is only spawned when the symlink cannot be read.
+func GetCurrent(root string, symlink string) Current {
+	current := Current{Version: "Unknown"}
+
+	target, err := os.Readlink(symlink)
+	if err == nil {
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(symlink), target)
+		}
+		target = filepath.Clean(target)
+		name := filepath.Base(target)
+
+		if strings.EqualFold(filepath.Dir(target), filepath.Clean(root)) && (strings.HasPrefix(name, "v") || IsLinked(root, name)) {
+			current.Version = strings.TrimPrefix(name, "v")
+			if IsLinked(root, name) {
+				current.Version = name
+			}
+			current.Path = target
+			if img, err := arch.Detect(filepath.Join(target, "node.exe")); err == nil {
+				current.Arch = img.Arch
+			}
+		}
+	}
+
+	if current.Path == "" {
+		current.Version, current.Arch, current.Path = spawnCurrentVersion()
+	}
+
+	current.DetectForeign(symlink)
+
+	return current
+}
+
+// DetectForeign determines whether another node.exe than the one in the
+// NVM_SYMLINK (or the active installation) takes precedence in the PATH.
+func (c *Current) DetectForeign(symlink string) {
+	if found, err := exec.LookPath("node"); err == nil {
+		dir := filepath.Dir(found)
+		if !strings.EqualFold(filepath.Clean(dir), filepath.Clean(symlink)) && (c.Path == "" || !strings.EqualFold(filepath.Clean(dir), c.Path)) {
+			c.Foreign = true
+			c.ForeignPath = found
+		}
+	}
+}
+
 /**
  * Returns version, architecture
  */
-func GetCurrentVersion() (string, string) {
+func GetCurrentVersion(root string, symlink string) (string, arch.Architecture) {
+	current := GetCurrent(root, symlink)
+	return current.Version, current.Arch
+}
+
+// Fallback for environments where the NVM_SYMLINK cannot be read. This
+// reports whichever node.exe is first in the PATH.
+func spawnCurrentVersion() (string, arch.Architecture, string) {
 	cmd := exec.Command("node", "-v")
 	str, err := cmd.Output()
 	if err == nil {
@@ -27,62 +95,60 @@ func GetCurrentVersion() (string, string) {
 		cmd := exec.Command("node", "-p", "console.log(process.execPath)")
 		str, _ := cmd.Output()
 		file := strings.Trim(regexp.MustCompile("undefined").ReplaceAllString(string(str), ""), " \n\r")
-		bit := arch.Bit(file)
-		if bit == "?" {
-			cmd := exec.Command("node", "-e", "console.log(process.arch)")
-			str, err := cmd.Output()
-			if err == nil {
-				if string(str) == "x64" {
-					bit = "64"
-				} else if string(str) == "arm64" {
-					bit = "arm64"
-				} else {
-					bit = "32"
-				}
-			} else {
-				return v, "Unknown"
-			}
+		if img, err := arch.Detect(file); err == nil {
+			return v, img.Arch, filepath.Dir(file)
+		}
+
+		cmd = exec.Command("node", "-e", "console.log(process.arch)")
+		str, err = cmd.Output()
+		if err != nil {
+			return v, arch.Unknown, filepath.Dir(file)
 		}
-		return v, bit
+
+		a, err := arch.Parse(string(str))
+		if err != nil {
+			return v, arch.Unknown, filepath.Dir(file)
+		}
+		return v, a, filepath.Dir(file)
 	}
-	return "Unknown", ""
+	return "Unknown", arch.Unknown, ""
 }
 
-func IsVersionInstalled(root string, version string, cpu string) bool {
-	e32 := file.Exists(root + "\\v" + version + "\\node32.exe")
-	e64 := file.Exists(root + "\\v" + version + "\\node64.exe")
-	used := file.Exists(root + "\\v" + version + "\\node.exe")
-	if cpu == "all" {
-		return ((e32 || e64) && used) || e32 && e64
-	}
-	if file.Exists(root + "\\v" + version + "\\node" + cpu + ".exe") {
-		return true
-	}
-	if ((e32 || e64) && used) || (e32 && e64) {
-		return true
-	}
-	if !e32 && !e64 && used && arch.Validate(cpu) == arch.Bit(root+"\\v"+version+"\\node.exe") {
-		return true
-	}
-	if cpu == "32" {
-		return e32
+// Env returns the environment variables required to run the node
+// installation in dir without activating it globally. The installation
+// directory is placed at the front of the supplied PATH.
+func Env(dir string, path string) map[string]string {
+	if len(path) > 0 {
+		path = dir + string(os.PathListSeparator) + path
+	} else {
+		path = dir
 	}
-	if cpu == "64" {
-		return e64
+
+	return map[string]string{
+		"PATH":              path,
+		"NVM_BIN":           dir,
+		"NODE":              filepath.Join(dir, "node.exe"),
+		"NPM_CONFIG_PREFIX": dir,
 	}
-	return false
 }
 
-func IsVersionAvailable(v string) bool {
+func IsVersionInstalled(root string, version string, cpu arch.Architecture) bool {
+	return HasArchitecture(Dir(root, version), cpu)
+}
+
+func IsVersionAvailable(c *web.Client, cache string, v string) (bool, error) {
 	// Check the service to make sure the version is available
-	avail, _, _, _, _, _ := GetAvailable()
+	avail, _, _, _, _, _, err := GetAvailable(c, cache)
+	if err != nil {
+		return false, err
+	}
 
 	for _, b := range avail {
 		if b == v {
-			return true
+			return true, nil
 		}
 	}
-	return false
+	return false, nil
 }
 
 func reverseStringArray(str []string) []string {
@@ -94,18 +160,21 @@ func reverseStringArray(str []string) []string {
 	return str
 }
 
+// GetInstalled returns the installed versions ("v" prefixed), newest first.
+// Named versions are not semantic versions and are listed by GetLinked.
 func GetInstalled(root string) []string {
 	list := make([]semver.Version, 0)
 	files, _ := ioutil.ReadDir(root)
 
 	for i := len(files) - 1; i >= 0; i-- {
 		if files[i].IsDir() || (files[i].Mode()&os.ModeSymlink == os.ModeSymlink) {
-			isnode, _ := regexp.MatchString("v", files[i].Name())
-
-			if isnode {
-				currentVersionString := strings.Replace(files[i].Name(), "v", "", 1)
-				currentVersion, _ := semver.Make(currentVersionString)
+			// Staging directories (e.g. .staging) are not installations
+			if !strings.HasPrefix(files[i].Name(), "v") {
+				continue
+			}
 
+			currentVersion, err := semver.Make(strings.TrimPrefix(files[i].Name(), "v"))
+			if err == nil {
 				list = append(list, currentVersion)
 			}
 		}
@@ -124,6 +193,159 @@ func GetInstalled(root string) []string {
 	return loggableList
 }
 
+// MatchInstalled returns the newest installed version (without a "v"
+// prefix) satisfying a full or partial version specification, such as
+// "18", "18.19" or "18.19.1". The aliases "node", "latest", "newest" and
+// "current" match the newest installed version. "lts/*" matches the newest
+// installed LTS version and "lts/<codename>" (i.e. "lts/hydrogen") the
+// newest installed version of that LTS line, based on the version list
+// cached by GetAvailable. Only local installations are considered, so no
+// network access is required. A named version (see nvm link) matches
+// itself. An empty string is returned when nothing matches.
+func MatchInstalled(root string, spec string) string {
+	if IsLinked(root, strings.TrimSpace(spec)) {
+		return strings.TrimSpace(spec)
+	}
+
+	spec = strings.TrimSpace(strings.ToLower(spec))
+	spec = strings.TrimPrefix(spec, "v")
+	installed := GetInstalled(root)
+
+	switch spec {
+	case "node", "latest", "newest", "current", "stable":
+		if len(installed) > 0 {
+			return strings.TrimPrefix(installed[0], "v")
+		}
+		return ""
+	}
+
+	if codename := strings.TrimPrefix(spec, "lts/"); codename != spec {
+		return matchLTS(root, installed, codename)
+	}
+
+	spec = strings.TrimSuffix(strings.TrimSuffix(spec, ".x"), ".x")
+	if spec == "" {
+		return ""
+	}
+
+	// Installed versions are sorted newest first
+	for _, v := range installed {
+		v = strings.TrimPrefix(v, "v")
+		if v == spec || strings.HasPrefix(v, spec+".") {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// FindInstalled returns the installed versions (without a "v" prefix)
+// matching spec, newest first. The spec may be an exact version, a partial
+// version ("18", "18.2", "18.x") or a range of comparators (">=16 <18",
+// "<14 || 16.x").
+func FindInstalled(root string, spec string) ([]string, error) {
+	r, err := semver.ParseRange(expandRange(spec))
+	if err != nil {
+		return nil, fmt.Errorf("\"%s\" is not a valid version or range", spec)
+	}
+
+	result := make([]string, 0)
+	for _, v := range GetInstalled(root) {
+		v = strings.TrimPrefix(v, "v")
+		sv, err := semver.Make(v)
+		if err == nil && r(sv) {
+			result = append(result, v)
+		}
+	}
+
+	return result, nil
+}
+
+// IsRange reports whether the spec may select more than one version.
+func IsRange(spec string) bool {
+	spec = strings.TrimPrefix(strings.TrimSpace(spec), "v")
+	_, err := semver.Make(spec)
+	return err != nil
+}
+
+// expandRange rewrites partial versions into the complete versions
+// semver.ParseRange expects (i.e. "<18" becomes "<18.0.0" and "18" becomes
+// "18.x"). An excluded partial version ("!18") excludes the whole release
+// line, which takes two alternatives (<18.0.0 || >=19.0.0), so the
+// comparator set containing it is duplicated for each alternative.
+func expandRange(spec string) string {
+	sets := make([]string, 0)
+	for _, set := range strings.Split(strings.ToLower(spec), "||") {
+		expanded := []string{""}
+		for _, field := range strings.Fields(set) {
+			alternatives := expandComparator(field)
+			product := make([]string, 0, len(expanded)*len(alternatives))
+			for _, prefix := range expanded {
+				for _, alternative := range alternatives {
+					product = append(product, strings.TrimSpace(prefix+" "+alternative))
+				}
+			}
+			expanded = product
+		}
+		sets = append(sets, expanded...)
+	}
+
+	return strings.Join(sets, " || ")
+}
+
+// expandComparator returns the alternatives a single comparator expands to.
+func expandComparator(field string) []string {
+	op := ""
+	for _, prefix := range []string{">=", "<=", "!=", ">", "<", "!", "="} {
+		if strings.HasPrefix(field, prefix) {
+			op = prefix
+			break
+		}
+	}
+
+	v := strings.TrimPrefix(strings.TrimPrefix(field, op), "v")
+	parts := strings.Split(v, ".")
+	for len(parts) > 0 && (parts[len(parts)-1] == "x" || parts[len(parts)-1] == "*") {
+		parts = parts[:len(parts)-1]
+	}
+	if len(parts) >= 3 || len(parts) == 0 {
+		return []string{field}
+	}
+
+	switch op {
+	case "", "=":
+		return []string{strings.Join(parts, ".") + ".x"}
+	case ">":
+		// >18 and <=18 both refer to the first version after 18.x
+		return []string{">=" + bump(parts)}
+	case "<=":
+		return []string{"<" + bump(parts)}
+	case "!", "!=":
+		return []string{"<" + pad(parts), ">=" + bump(parts)}
+	default:
+		return []string{op + pad(parts)}
+	}
+}
+
+// pad completes a partial version with zeros.
+func pad(parts []string) string {
+	for len(parts) < 3 {
+		parts = append(parts, "0")
+	}
+	return strings.Join(parts, ".")
+}
+
+// bump returns the first version after a partial version (18.2 -> 18.3.0).
+func bump(parts []string) string {
+	next := append([]string{}, parts...)
+	n, err := strconv.Atoi(next[len(next)-1])
+	if err != nil {
+		return pad(next)
+	}
+	next[len(next)-1] = strconv.Itoa(n + 1)
+	return pad(next)
+}
+
 // Sorting
 type BySemanticVersion []string
 
@@ -199,33 +421,34 @@ func isUnstable(element map[string]interface{}) bool {
 	return version.Minor%2 != 0
 }
 
-// Retrieve the remotely available versions
-func GetAvailable() ([]string, []string, []string, []string, []string, map[string]string) {
+// Retrieve the remotely available versions: all of them, followed by the
+// LTS, current, old stable and old unstable versions, and the npm version
+// bundled with each version. The LTS versions are cached in the nvm root
+// cache (see LTSFile), unless it is empty.
+func GetAvailable(c *web.Client, cache string) ([]string, []string, []string, []string, []string, map[string]string, error) {
 	all := make([]string, 0)
 	lts := make([]string, 0)
 	current := make([]string, 0)
 	stable := make([]string, 0)
 	unstable := make([]string, 0)
 	npm := make(map[string]string)
-	url := web.GetFullNodeUrl("index.json")
+	codenames := make(map[string]string)
+	url := c.Source().IndexURL()
 
 	// Check the service to make sure the version is available
-	text, err := web.GetRemoteTextFile(url)
+	text, err := c.GetRemoteTextFile(url)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return all, lts, current, stable, unstable, npm, err
 	}
 	if len(text) == 0 {
-		fmt.Println("Error retrieving version list: \"" + url + "\" returned blank results. This can happen when the remote file is being updated. Please try again in a few minutes.")
-		os.Exit(0)
+		return all, lts, current, stable, unstable, npm, exit.Errorf(exit.ErrNetwork, "Error retrieving version list: \"%s\" returned blank results. This can happen when the remote file is being updated. Please try again in a few minutes.", url)
 	}
 
 	// Parse
 	var data = make([]map[string]interface{}, 0)
 	err = json.Unmarshal([]byte(text), &data)
 	if err != nil {
-		fmt.Printf("Error retrieving versions from \"%s\": %v", url, err.Error())
-		os.Exit(1)
+		return all, lts, current, stable, unstable, npm, exit.Errorf(exit.ErrNetwork, "Error retrieving versions from \"%s\": %v", url, err)
 	}
 
 	for _, element := range data {
@@ -238,6 +461,9 @@ func GetAvailable() ([]string, []string, []string, []string, []string, map[strin
 
 		if isLTS(element) {
 			lts = append(lts, version)
+			if name, ok := element["lts"].(string); ok {
+				codenames[version] = strings.ToLower(name)
+			}
 		} else if isCurrent(element) {
 			current = append(current, version)
 		} else if isStable(element) {
@@ -247,5 +473,7 @@ func GetAvailable() ([]string, []string, []string, []string, []string, map[strin
 		}
 	}
 
-	return all, lts, current, stable, unstable, npm
+	saveLTS(cache, codenames)
+
+	return all, lts, current, stable, unstable, npm, nil
 }
@@ -0,0 +1,115 @@
+package node
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fakeRoot creates an nvm root with the given versions installed.
+func fakeRoot(t *testing.T, versions ...string) string {
+	t.Helper()
+
+	root := t.TempDir()
+	for _, v := range versions {
+		if err := os.MkdirAll(filepath.Join(root, "v"+v), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Not an installation
+	if err := os.MkdirAll(filepath.Join(root, ".staging"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return root
+}
+
+func TestFindInstalled(t *testing.T) {
+	root := fakeRoot(t, "16.20.2", "18.2.0", "18.19.1", "20.11.0")
+
+	tests := []struct {
+		spec string
+		want []string
+	}{
+		{"18", []string{"18.19.1", "18.2.0"}},
+		{"18.x", []string{"18.19.1", "18.2.0"}},
+		{"v18.2", []string{"18.2.0"}},
+		{"18.19.1", []string{"18.19.1"}},
+		{"<18", []string{"16.20.2"}},
+		{">18", []string{"20.11.0"}},
+		{"<=18", []string{"18.19.1", "18.2.0", "16.20.2"}},
+		{">=18", []string{"20.11.0", "18.19.1", "18.2.0"}},
+		{"!18", []string{"20.11.0", "16.20.2"}},
+		{"!=18", []string{"20.11.0", "16.20.2"}},
+		{"!18.2.0", []string{"20.11.0", "18.19.1", "16.20.2"}},
+		{"<20 !18", []string{"16.20.2"}},
+		{">=16 <18 || 20.x", []string{"20.11.0", "16.20.2"}},
+		{"22", []string{}},
+	}
+
+	for _, test := range tests {
+		got, err := FindInstalled(root, test.spec)
+		if err != nil {
+			t.Errorf("FindInstalled(%q): %v", test.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("FindInstalled(%q) = %v, want %v", test.spec, got, test.want)
+		}
+	}
+
+	if _, err := FindInstalled(root, "eighteen"); err == nil {
+		t.Error("an invalid range was accepted")
+	}
+}
+
+func TestMatchInstalled(t *testing.T) {
+	root := fakeRoot(t, "16.20.2", "18.2.0", "18.19.1", "20.11.0", "21.6.0")
+
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"18", "18.19.1"},
+		{"v18.2", "18.2.0"},
+		{"18.x", "18.19.1"},
+		{"latest", "21.6.0"},
+		{"22", ""},
+		// Without a cached version list, LTS versions are unknown
+		{"lts/*", ""},
+	}
+	for _, test := range tests {
+		if got := MatchInstalled(root, test.spec); got != test.want {
+			t.Errorf("MatchInstalled(%q) = %q, want %q", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestMatchInstalledLTS(t *testing.T) {
+	root := fakeRoot(t, "16.20.2", "18.2.0", "18.19.1", "20.11.0", "21.6.0")
+
+	saveLTS(root, map[string]string{
+		"16.20.2": "gallium",
+		"18.19.1": "hydrogen",
+		"18.18.0": "hydrogen",
+		"20.11.0": "iron",
+	})
+
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"lts/*", "20.11.0"},
+		{"lts/hydrogen", "18.19.1"},
+		{"LTS/Gallium", "16.20.2"},
+		// Not installed
+		{"lts/jod", ""},
+		{"lts/", ""},
+	}
+	for _, test := range tests {
+		if got := MatchInstalled(root, test.spec); got != test.want {
+			t.Errorf("MatchInstalled(%q) = %q, want %q", test.spec, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package npm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Package is a globally installed npm module.
+type Package struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Spec returns the package in name@version format.
+func (p Package) Spec() string {
+	if p.Version == "" {
+		return p.Name
+	}
+	return p.Name + "@" + p.Version
+}
+
+// Modules bundled with node.js are never treated as global packages.
+var bundled = map[string]bool{
+	"npm":      true,
+	"corepack": true,
+}
+
+// Globals lists the top-level global packages installed within a node
+// installation directory (i.e. root\vX.Y.Z), excluding npm and corepack.
+func Globals(dir string) ([]Package, error) {
+	packages := make([]Package, 0)
+	modules := filepath.Join(dir, "node_modules")
+
+	entries, err := os.ReadDir(modules)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return packages, nil
+		}
+		return packages, err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") || bundled[strings.ToLower(name)] {
+			continue
+		}
+
+		// Scoped packages are nested one level deeper
+		if strings.HasPrefix(name, "@") {
+			scoped, err := os.ReadDir(filepath.Join(modules, name))
+			if err != nil {
+				return packages, err
+			}
+
+			for _, s := range scoped {
+				packages = append(packages, describe(modules, name+"/"+s.Name()))
+			}
+			continue
+		}
+
+		packages = append(packages, describe(modules, name))
+	}
+
+	return packages, nil
+}
+
+func describe(modules string, name string) Package {
+	pkg := Package{Name: name}
+
+	content, err := os.ReadFile(filepath.Join(modules, filepath.FromSlash(name), "package.json"))
+	if err == nil {
+		var manifest Package
+		if json.Unmarshal(content, &manifest) == nil {
+			pkg.Version = manifest.Version
+		}
+	}
+
+	return pkg
+}
+
+// InstallGlobal installs the package specs globally into the node
+// installation directory using that installation's own npm. The directory
+// is placed first in the PATH so lifecycle scripts run with the same node.
+func InstallGlobal(dir string, specs ...string) error {
+	npmcmd := filepath.Join(dir, "npm.cmd")
+	if _, err := os.Stat(npmcmd); err != nil {
+		return fmt.Errorf("npm is not available in %s", dir)
+	}
+
+	args := append([]string{"install", "--global", "--prefix", dir}, specs...)
+	cmd := exec.Command(npmcmd, args...)
+	cmd.Env = append(os.Environ(), "PATH="+dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("npm install %s failed: %v", strings.Join(specs, " "), err)
+	}
+
+	return nil
+}
+
+// DefaultPackages reads the package specs from a default packages file.
+// Each non-empty line holds one package, optionally with a version
+// (i.e. typescript@5). Lines starting with # are comments. A missing file
+// returns no packages.
+func DefaultPackages(path string) ([]string, error) {
+	specs := make([]string, 0)
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return specs, nil
+		}
+		return specs, err
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+
+		for _, spec := range strings.Fields(line) {
+			specs = append(specs, spec)
+		}
+	}
+
+	return specs, nil
+}
@@ -1,7 +1,8 @@
 package main
 
 import (
-	"bytes"
+	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -15,16 +16,26 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
-	"sync"
 	"syscall"
 	"time"
 	"unsafe"
 
 	"nvm/arch"
 	"nvm/author"
+	"nvm/bundle"
+	"nvm/cli"
+	"nvm/du"
 	"nvm/encoding"
+	"nvm/exit"
 	"nvm/file"
+	"nvm/journal"
+	"nvm/link"
+	"nvm/lock"
+	"nvm/manager"
 	"nvm/node"
+	"nvm/nvmrc"
+	"nvm/shell"
+	"nvm/shim"
 	"nvm/upgrade"
 	"nvm/utility"
 	"nvm/web"
@@ -34,6 +45,7 @@ import (
 	// "github.com/fatih/color"
 
 	"github.com/coreybutler/go-where"
+	"github.com/dustin/go-humanize"
 	"github.com/ncruces/zenity"
 	"github.com/olekukonko/tablewriter"
 	"golang.org/x/sys/windows"
@@ -43,34 +55,12 @@ import (
 // Replaced at build time
 var NvmVersion = ""
 
-type Environment struct {
-	settings        string
-	root            string
-	symlink         string
-	arch            string
-	node_mirror     string
-	npm_mirror      string
-	proxy           string
-	originalpath    string
-	originalversion string
-	verifyssl       bool
-}
-
 var home = filepath.Clean(os.Getenv("NVM_HOME") + "\\settings.txt")
 var symlink = filepath.Clean(os.Getenv("NVM_SYMLINK"))
 
-var env = &Environment{
-	settings:        home,
-	root:            "",
-	symlink:         symlink,
-	arch:            strings.ToLower(os.Getenv("PROCESSOR_ARCHITECTURE")),
-	node_mirror:     "",
-	npm_mirror:      "",
-	proxy:           "none",
-	originalpath:    "",
-	originalversion: "",
-	verifyssl:       true,
-}
+// The settings (read by setup) and the manager performing the operations.
+var env = manager.NewSettings(home, symlink)
+var mgr *manager.Manager
 
 func writeToErrorLog(i interface{}, abort ...bool) {
 	exe, _ := os.Executable()
@@ -87,7 +77,7 @@ func writeToErrorLog(i interface{}, abort ...bool) {
 
 	if len(abort) > 0 && abort[0] {
 		fmt.Println(msg)
-		os.Exit(1)
+		quit(1)
 	}
 }
 
@@ -107,10 +97,12 @@ type Action struct {
 	URI   string `json:"uri"`
 }
 
+// Shows a notification. The bridge runs to completion, so nvm can exit as
+// soon as notify returns.
 func notify(data Notification) {
 	data.AppID = "NVM for Windows"
 	content, _ := json.Marshal(data)
-	go author.Bridge("notify", string(content))
+	author.Bridge("notify", string(content))
 }
 
 func init() {
@@ -165,116 +157,164 @@ func init() {
 					},
 				})
 
-				time.Sleep(300 * time.Millisecond)
-
-				os.Exit(0)
+				quit(0)
 			default:
 				writeToErrorLog(fmt.Sprintf("%s command not recognized", action), true)
 			}
 		}
 	}
 
-	// Turn on debugging output
-	for _, arg := range os.Args[1:] {
-		if strings.ToLower(strings.ReplaceAll(arg, "-", "")) == "verbose" {
-			utility.EnableDebugLogs()
-			break
-		}
-	}
 }
 
 func main() {
-	utility.DebugLogf("command: %v", strings.Join(os.Args, " "))
-	args := os.Args
-	detail := ""
-	procarch := arch.Validate(env.arch)
-
-	// Capture any additional arguments
-	if len(args) > 2 {
-		detail = args[2]
+	var err error
+	inv, err = app.Parse(os.Args[1:])
+	if err != nil {
+		usageError(err)
 	}
-	if len(args) > 3 {
-		if args[3] == "32" || args[3] == "arm64" || args[3] == "64" {
-			procarch = args[3]
-		}
+
+	// Turn on debugging output
+	if inv.Has("verbose") {
+		utility.EnableDebugLogs()
 	}
-	if len(args) < 2 {
+	utility.DebugLogf("command: %v", strings.Join(os.Args, " "))
+
+	c := inv.Command
+	if c == nil {
 		help()
 		return
 	}
-
-	utility.DebugLogf("arch: %v", procarch)
-
-	if args[1] != "version" && args[1] != "--version" && args[1] != "v" && args[1] != "-v" && args[1] != "--v" {
+	if inv.Has("help") {
+		fmt.Println()
+		fmt.Print(app.CommandHelp(c))
+		return
+	}
+	args := inv.Args
+	switch c.Name {
+	case "version", "completion", shell.CompleteCommand:
+	default:
+		// Settings are read after the lock is taken, so they cannot be
+		// changed by another process in the meantime
+		if mutates(c.Name, args) {
+			acquireLock(strings.Join(append([]string{c.Name}, args...), " "))
+			defer held.Release()
+		}
 		setup()
 	}
 
 	// Run the appropriate method
-	switch args[1] {
-	case "i":
-		fallthrough
+	switch c.Name {
 	case "install":
-		install(detail, procarch)
-	case "rm":
-		fallthrough
+		if path := inv.Value("from-file"); path != "" {
+			installLocal(path, false)
+		} else if path := inv.Value("from-dir"); path != "" {
+			installLocal(path, true)
+		} else if len(args) == 0 {
+			usageError(&cli.UsageError{Command: c, Message: "Provide the version to install."})
+		} else {
+			install(inv.Arg(0), inv.Arg(1))
+		}
 	case "uninstall":
-		uninstall(detail)
+		uninstall(args)
 	case "reinstall":
-		reinstall(detail, procarch)
-	case "u":
-		fallthrough
+		reinstall(inv.Arg(0), inv.Arg(1))
+	case "link":
+		linkVersion(args)
+	case "pack":
+		pack(args)
+	case "unpack":
+		unpack(inv.Arg(0))
+	case "migrate-globals":
+		if code := migrateGlobals(inv.Arg(0), inv.Arg(1), inv.Has("dry-run")); code != exit.OK {
+			quit(code)
+		}
 	case "use":
-		use(detail, procarch)
-	case "ls":
-		fallthrough
+		if inv.Has("session") {
+			session(inv.Arg(0), true)
+			return
+		}
+		use(inv.Arg(0), inv.Arg(1))
+	case "env":
+		session(inv.Arg(0), false)
+	case "shell":
+		subshell(inv.Arg(0))
+	case "resolve":
+		resolve()
+	case "hook":
+		hook()
+	case "completion":
+		completion(inv.Arg(0))
+	case shell.CompleteCommand:
+		complete(args)
+	case "exec":
+		execute(args, false)
+	case "run":
+		execute(args, true)
 	case "list":
-		list(detail)
+		list(inv.Arg(0))
 	case "on":
 		enable()
 	case "off":
 		disable()
 	case "root":
-		if len(args) == 3 {
-			updateRootDir(args[2])
+		if len(args) == 1 {
+			updateRootDir(args[0])
 		} else {
-			fmt.Println("\nCurrent Root: " + env.root)
-		}
-	case "v":
-		fallthrough
-	case "--version":
-		fallthrough
-	case "-version":
-		fallthrough
-	case "--v":
-		fallthrough
-	case "-v":
-		fallthrough
+			fmt.Println("\nCurrent Root: " + env.Root)
+		}
 	case "version":
+		if inv.Has("json") {
+			printJSON(map[string]string{"version": NvmVersion})
+			return
+		}
 		fmt.Println(NvmVersion)
 	case "arch":
-		if strings.Trim(detail, " \r\n") != "" {
-			detail = strings.Trim(detail, " \r\n")
-			if detail != "32" && detail != "64" && detail != "arm64" {
-				fmt.Println("\"" + detail + "\" is an invalid architecture. Use 32, 64, or arm64.")
-				return
-			}
-			env.arch = detail
-			saveSettings()
-			fmt.Println("Default architecture set to " + detail + "-bit.")
+		if detail := strings.Trim(inv.Arg(0), " \r\n"); detail != "" {
+			useArchitecture(detail)
 			return
 		}
-		_, a := node.GetCurrentVersion()
-		fmt.Println("System Default: " + env.arch + "-bit.")
-		fmt.Println("Currently Configured: " + a + "-bit.")
+		_, a := mgr.Active()
+		fmt.Println("System Default: " + env.Arch.Label() + ".")
+		fmt.Println("Currently Configured: " + a.Label() + ".")
 	case "proxy":
-		if detail == "" {
-			fmt.Println("Current proxy: " + env.proxy)
+		if len(args) == 0 {
+			fmt.Println("Current proxy: " + env.Proxy)
 		} else {
-			env.proxy = detail
+			env.Proxy = args[0]
 			saveSettings()
 		}
+	case "link_type":
+		if len(args) == 0 {
+			fmt.Printf("Link type: %v (nvm use creates a %v)\n", env.LinkType, linkKindLabel(mgr.LinkKind()))
+			return
+		}
+		kind, err := link.Parse(args[0])
+		if err != nil {
+			fmt.Println(err)
+			quit(exit.Usage)
+		}
+		env.LinkType = kind
+		saveSettings()
+	case "activation":
+		if len(args) == 0 {
+			fmt.Println("Activation: " + env.Activation)
+			return
+		}
+		setActivation(args[0])
 	case "current":
-		inuse, _ := node.GetCurrentVersion()
+		current := activeNode()
+		inuse := current.Version
+
+		if inv.Has("json") {
+			status := map[string]string{"version": "", "arch": ""}
+			if inuse != "Unknown" {
+				status["version"] = inuse
+				status["arch"] = current.Arch.Bits()
+			}
+			printJSON(status)
+			return
+		}
+
 		v, _ := semver.Make(inuse)
 		err := v.Validate()
 
@@ -285,25 +325,35 @@ func main() {
 		} else {
 			fmt.Println("v" + inuse)
 		}
+		warnForeignNode(current)
 
 	//case "update": update()
 	case "node_mirror":
-		setNodeMirror(detail)
+		setNodeMirror(inv.Arg(0))
 	case "npm_mirror":
-		setNpmMirror(detail)
+		setNpmMirror(inv.Arg(0))
 	case "debug":
 		checkLocalEnvironment()
-	case "subscribe":
-		fallthrough
-	case "unsubscribe":
-		author.Bridge(args[1:]...)
+	case "du":
+		diskUsage()
+	case "subscribe", "unsubscribe":
+		topics := append([]string{c.Name}, args...)
+		for _, topic := range []string{"lts", "current", "nvm4w", "author"} {
+			if inv.Has(topic) {
+				topics = append(topics, "--"+topic)
+			}
+		}
+		author.Bridge(topics...)
 	case "author":
-		author.Bridge(args[2:]...)
+		author.Bridge(args...)
 	case "upgrade":
-		upgrade.Run(NvmVersion)
-	default:
-		fmt.Printf(`"%s" is not a valid command.`+"\n", args[1])
-		help()
+		if inv.Has("offline") {
+			fmt.Println("nvm upgrade requires network access.")
+			quit(exit.Network)
+		}
+		if err := upgrade.Run(NvmVersion, shimDir(), inv.Has("show-progress-ui")); err != nil {
+			quit(exit.Code(err))
+		}
 	}
 }
 
@@ -311,990 +361,948 @@ func main() {
 // BEGIN | CLI functions
 // ===============================================================
 func setNodeMirror(uri string) {
-	env.node_mirror = uri
+	env.NodeMirror = uri
 	saveSettings()
 }
 
 func setNpmMirror(uri string) {
-	env.npm_mirror = uri
+	env.NpmMirror = uri
 	saveSettings()
 }
 
-func getVersion(version string, cpuarch string, localInstallsOnly ...bool) (string, string, error) {
-	requestedVersion := version
-	cpuarch = strings.ToLower(cpuarch)
-
-	if cpuarch != "" {
-		if cpuarch != "32" && cpuarch != "64" && cpuarch != "arm64" && cpuarch != "all" {
-			return version, cpuarch, errors.New("\"" + cpuarch + "\" is not a valid CPU architecture. Must be 32, 64, or arm64.")
-		}
-	} else {
-		cpuarch = env.arch
+// Parses the architecture argument of a command. An empty argument
+// returns the default architecture. "all" is only valid when allowed, and
+// returns every architecture the host can run.
+func getArchitectures(cpuarch string, allowAll bool) ([]arch.Architecture, error) {
+	if cpuarch == "" {
+		return []arch.Architecture{env.Arch}, nil
 	}
 
-	if cpuarch != "all" {
-		cpuarch = arch.Validate(cpuarch)
+	if allowAll && strings.ToLower(cpuarch) == "all" {
+		return arch.Host().Runnable(), nil
 	}
 
-	if version == "" {
-		return "", cpuarch, errors.New("A version argument is required but missing.")
+	a, err := arch.Parse(cpuarch)
+	if err != nil {
+		return nil, err
 	}
 
-	// If user specifies "latest" version, find out what version is
-	if version == "latest" || version == "node" {
-		version = getLatest()
-		fmt.Println(version)
-	}
+	return []arch.Architecture{a}, nil
+}
 
-	if version == "lts" {
-		version = getLTS()
+func install(version string, cpuarch string) {
+	archs, archerr := getArchitectures(cpuarch, true)
+	if archerr != nil {
+		fmt.Println(archerr)
+		help()
+		quit(exit.Usage)
 	}
 
-	if version == "newest" {
-		installed := node.GetInstalled(env.root)
-		if len(installed) == 0 {
-			return version, "", errors.New("No versions of node.js found. Try installing the latest by typing nvm install latest.")
-		}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
 
-		version = installed[0]
+	// Determine whether to show the progress dialog
+	if inv.Has("show-progress-ui") {
+		openProgressDialog(version, cancel)
 	}
 
-	if version == "32" || version == "64" || version == "arm64" {
-		cpuarch = version
-		v, _ := node.GetCurrentVersion()
-		version = v
-	}
+	result, err := mgr.Install(ctx, version, installOptions(archs))
+	quit(reportInstall(version, result, err))
+}
 
-	version = versionNumberFrom(version)
-	v, err := semver.Make(version)
-	if err == nil {
-		err = v.Validate()
+// Returns the install options selected on the command line.
+func installOptions(archs []arch.Architecture) manager.InstallOptions {
+	return manager.InstallOptions{
+		Archs:                 archs,
+		Insecure:              inv.Has("insecure"),
+		Source:                inv.Value("source"),
+		Checksums:             inv.Value("checksums"),
+		SkipDefaultPackages:   inv.Has("skip-default-packages"),
+		ReinstallPackagesFrom: inv.Value("reinstall-packages-from"),
 	}
+}
 
-	if err == nil {
-		// if the user specifies only the major/minor version, identify the latest
-		// version applicable to what was provided.
-		sv := strings.Split(version, ".")
-		if len(sv) < 3 {
-			version = findLatestSubVersion(version)
-		} else {
-			version = cleanVersion(version)
-		}
+// The progress dialog shown by install --show-progress-ui, if any.
+var dialog zenity.ProgressDialog
 
-		version = versionNumberFrom(version)
-	} else if strings.Contains(err.Error(), "No Major.Minor.Patch") {
-		latestLocalInstall := false
-		if len(localInstallsOnly) > 0 {
-			latestLocalInstall = localInstallsOnly[0]
-		}
-		version = findLatestSubVersion(version, latestLocalInstall)
-		if len(version) == 0 {
-			err = errors.New("Unrecognized version: \"" + requestedVersion + "\"")
-		}
+// Opens the installation progress dialog. Closing it cancels the
+// installation.
+func openProgressDialog(version string, cancel context.CancelFunc) {
+	exe, _ := os.Executable()
+	winIco := filepath.Join(filepath.Dir(exe), "nvm.ico")
+	ico := filepath.Join(filepath.Dir(exe), "nodejs.ico")
+
+	dlg, err := zenity.Progress(
+		zenity.Title(fmt.Sprintf("Installing Node.js v%s", version)),
+		zenity.Icon(ico),
+		zenity.WindowIcon(winIco),
+		zenity.AutoClose(),
+		zenity.NoCancel(),
+		zenity.Pulsate())
+	if err != nil {
+		fmt.Println("Failed to create progress dialog")
+		return
 	}
 
-	return version, cpuarch, err
+	dialog = dlg
+	go func() {
+		<-dlg.Done()
+		if err := dlg.Complete(); err == zenity.ErrCanceled {
+			cancel()
+		}
+	}()
+	dialog.Text("Validating version...")
 }
 
-type Status struct {
-	Text string
-	Err  error
-	Done bool
-	Help bool
+// Prints the progress of manager operations, or shows it in the progress
+// dialog when one is open.
+func report(e manager.Event) {
+	switch {
+	case e.Kind == manager.Warning:
+		fmt.Println("WARNING: " + e.Text)
+	case dialog != nil:
+		dialog.Text(e.Text)
+	default:
+		fmt.Println(e.Text)
+	}
 }
 
-func rollback(version string) error {
-	p := filepath.Join(env.root, "v"+version)
+// Reports the outcome of an installation and returns the exit code.
+func reportInstall(spec string, result *manager.InstallResult, err error) int {
+	version := spec
+	if result != nil {
+		version = result.Version
+	}
+
+	var npmerr *manager.NpmError
+	var pkgerr *manager.PackageError
+	switch {
+	case errors.Is(err, context.Canceled):
+		fmt.Printf("Node.js %s installation canceled by user\n", version)
+		if dialog != nil {
+			notify(Notification{
+				Title:   fmt.Sprintf("Node.js v%s", version),
+				Message: "Installation canceled by user",
+				Icon:    "error",
+				Actions: []Action{
+					{Type: "protocol", Label: "Restart Installation", URI: fmt.Sprintf("nvm://launch?action=install%%26version=%s%%26use=false%%26=show=true", version)},
+				},
+			})
+		}
+		fmt.Println("Rollback complete.")
+		return exit.Failure
+
+	case errors.As(err, &npmerr) && dialog != nil:
+		// Send special error notification with link to npm release when it cannot be downloaded
+		notify(Notification{
+			Title:   "Download Failure (npm)",
+			Message: fmt.Sprintf("Please download npm v%s manually and extract to %s", version, npmerr.Dir),
+			Icon:    "error",
+			Actions: []Action{
+				{Type: "protocol", Label: "Manually Download", URI: npmerr.URL},
+			},
+		})
+		return exit.Partial
+
+	case err != nil && !errors.As(err, &pkgerr):
+		if dialog != nil {
+			// Close progress dialog and send error notificaion
+			notify(Notification{
+				Title:   "Node.js Installation Error",
+				Message: err.Error(),
+				Icon:    "error",
+			})
+
+			dialog.Text(fmt.Sprintf("error: %v", err))
+			dialog.Close()
+		} else {
+			fmt.Printf("error installing %s: %v\n", version, err)
+		}
+		return exit.Code(err)
+	}
+
+	if result.Existing {
+		fmt.Println("Version " + version + " is already installed.")
+	} else if len(result.Added) > 0 {
+		labels := make([]string, 0)
+		for _, a := range result.Added {
+			labels = append(labels, a.Label())
+		}
+		fmt.Printf("Added %s to node v%s. To use it, type:\n\nnvm use %s %s\n", strings.Join(labels, ", "), version, version, result.Added[0].Bits())
+	} else if dialog != nil {
+		notify(Notification{
+			Title:   fmt.Sprintf("Node.js v%s", version),
+			Message: "Installation complete.",
+			Icon:    "node",
+			Actions: []Action{
+				{Type: "protocol", Label: "Use", URI: fmt.Sprintf("nvm://launch?action=use%%26version=%s", version)},
+				{Type: "protocol", Label: "Changelog", URI: fmt.Sprintf("https://github.com/nodejs/node/releases/tag/v%s", version)},
+			},
+		})
+
+		dialog.Text("Installation complete.")
+		dialog.Close()
+	} else {
+		fmt.Printf("Installation complete.\nIf you want to use this version, type:\n\nnvm use %s\n", version)
+	}
 
-	_, err := os.Lstat(p)
-	if err != nil {
-		if !os.IsNotExist(err) {
-			writeToErrorLog(err)
-			return fmt.Errorf("Error rolling back node v%s installation: %v.", version, err)
+	if r := result.DefaultPackages; r != nil && len(r.Packages) > 0 {
+		if len(r.Failures) > 0 {
+			fmt.Printf("\nWARNING: %d of %d default package(s) could not be installed:\n", len(r.Failures), len(r.Packages))
+			for _, failure := range r.Failures {
+				fmt.Println("  - " + failure.String())
+			}
+		} else {
+			fmt.Printf("%d default package(s) installed.\n", len(r.Packages))
 		}
 	}
 
-	return nil
-}
+	if result.Migrated != nil {
+		reportMigration(result.Migrated)
+	}
 
-func install(version string, cpuarch string) {
-	requestedVersion := version
-	args := os.Args
-	lastarg := args[len(args)-1]
+	if pkgerr != nil {
+		return exit.Partial
+	}
+	return exit.OK
+}
 
-	if lastarg == "--insecure" {
-		env.verifyssl = false
+// Reinstalls the global npm packages of one installed version into another.
+// Returns the exit code (exit.Partial when some packages failed to install).
+func migrateGlobals(from string, to string, dryrun bool) int {
+	result, err := mgr.MigrateGlobals(from, to, dryrun)
+	if result == nil {
+		fmt.Println(err)
+		return exit.Code(err)
 	}
 
-	if strings.HasPrefix(version, "--") {
-		fmt.Println("\"--\" prefixes are unnecessary in NVM for Windows!")
-		version = strings.ReplaceAll(version, "-", "")
-		fmt.Printf("attempting to install \"%v\" instead...\n\n", version)
-		time.Sleep(2 * time.Second)
+	reportMigration(result)
+	return exit.Code(err)
+}
+
+func reportMigration(r *manager.PackageResult) {
+	if len(r.Packages) == 0 {
+		fmt.Printf("No global packages found in node v%s.\n", r.From)
+		return
 	}
 
-	var exitCode = 0
-	var status = make(chan Status)
-	var cancel = make(chan bool)
-	var show_progress bool = false
-	var dlg zenity.ProgressDialog
+	if r.DryRun {
+		fmt.Printf("\n%d package(s) would be installed into node v%s (dry run).\n", len(r.Packages), r.Version)
+		return
+	}
 
-	wg := &sync.WaitGroup{}
-	wg.Add(1)
+	fmt.Printf("\n%d of %d global package(s) migrated from v%s to v%s.\n", len(r.Packages)-len(r.Failures), len(r.Packages), r.From, r.Version)
+	if len(r.Failures) > 0 {
+		fmt.Println("\nThe following packages could not be installed:")
+		for _, failure := range r.Failures {
+			fmt.Println("  - " + failure.String())
+		}
+	}
+}
 
-	go func() {
-		defer func() {
-			// Reset the SSL verification
-			env.verifyssl = true
-
-			// sleep for 1 second to give users a chance to see the completion notice before exiting
-			if show_progress {
-				time.Sleep(1 * time.Second)
-				fmt.Println("exiting installer dialog")
-			}
+// Installs node from a distribution archive (--from-file) or an extracted
+// distribution directory (--from-dir), without downloading node.
+func installLocal(path string, isDir bool) {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
 
-			wg.Done()
-		}()
-
-		for {
-			select {
-			case s := <-status:
-				if s.Err != nil {
-					exitCode = 1
-					if show_progress && dlg != nil {
-						// Close progress dialog and send error notificaion
-						notify(Notification{
-							Title:   "Node.js Installation Error",
-							Message: s.Err.Error(),
-							Icon:    "error",
-						})
-
-						dlg.Text(fmt.Sprintf("error: %v", s.Err))
-						dlg.Close()
-
-						// Cleanup
-						err := rollback(version)
-						if err != nil {
-							notify(Notification{
-								Title:   "Rollback Error",
-								Message: err.Error(),
-								Icon:    "error",
-								Actions: []Action{
-									{Type: "protocol", Label: "Open Explorer", URI: fmt.Sprintf("file://%s", filepath.ToSlash(filepath.Join(env.root)))},
-								},
-							})
-						}
-					} else {
-						fmt.Printf("error installing %s: %v\n", version, s.Err)
-						if s.Help {
-							fmt.Println(" ")
-							help()
-						}
-					}
-					return
-				}
+	var result *manager.InstallResult
+	var err error
+	if isDir {
+		result, err = mgr.InstallDir(ctx, path, installOptions(nil))
+	} else {
+		result, err = mgr.InstallFile(ctx, path, installOptions(nil))
+	}
 
-				if s.Done {
-					if show_progress && dlg != nil {
-						notify(Notification{
-							Title:   fmt.Sprintf("Node.js v%s", version),
-							Message: "Installation complete.",
-							Icon:    "node",
-							Actions: []Action{
-								{Type: "protocol", Label: "Use", URI: fmt.Sprintf("nvm://launch?action=use%%26version=%s", version)},
-								{Type: "protocol", Label: "Changelog", URI: fmt.Sprintf("https://github.com/nodejs/node/releases/tag/v%s", version)},
-							},
-						})
-
-						dlg.Text("Installation complete.")
-						time.Sleep(1 * time.Second)
-					} else {
-						fmt.Printf("Installation complete.\nIf you want to use this version, type:\n\nnvm use %s\n", version)
-					}
-
-					return
-				}
+	quit(reportInstall(path, result, err))
+}
 
-				if show_progress && dlg != nil {
-					dlg.Text(s.Text)
-				} else {
-					fmt.Println(s.Text)
-				}
-			case <-cancel:
-				fmt.Printf("Node.js %s installation canceled by user\n", version)
-
-				if show_progress {
-					notify(Notification{
-						Title:   fmt.Sprintf("Node.js v%s", version),
-						Message: "Installation canceled by user",
-						Icon:    "error",
-						Actions: []Action{
-							{Type: "protocol", Label: "Restart Installation", URI: fmt.Sprintf("nvm://launch?action=install%%26version=%s%%26use=false%%26=show=true", version)},
-						},
-					})
-				}
+func reinstall(version, cpuarch string) {
+	archs, err := getArchitectures(cpuarch, true)
+	if err != nil {
+		fmt.Println(err)
+		help()
+		quit(exit.Usage)
+	}
 
-				err := rollback(version)
-				if err != nil {
-					if show_progress {
-						notify(Notification{
-							Title:   "Rollback Error",
-							Message: err.Error(),
-							Icon:    "error",
-							Actions: []Action{
-								{Type: "protocol", Label: "Open Explorer", URI: fmt.Sprintf("file://%s", filepath.ToSlash(filepath.Join(env.root)))},
-							},
-						})
-					} else {
-						fmt.Printf("rollback error: %v\n", err)
-					}
-				} else {
-					fmt.Println("Rollback complete.")
-				}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
 
-				if cpuarch == "arm64" && !web.IsNodeArm64bitAvailable(version) {
-					status <- Status{Err: fmt.Errorf("Node.js v%s is only available in 32-bit and 64-bit.", version)}
-				}
+	result, err := mgr.Reinstall(ctx, version, installOptions(archs))
+	quit(reportInstall(version, result, err))
+}
 
-				if !node.IsVersionInstalled(env.root, version, cpuarch) {
-					if !node.IsVersionAvailable(version) {
-						url := web.GetFullNodeUrl("index.json")
-						status <- Status{Err: fmt.Errorf("Version %s is not available.\n\nThe complete list of available versions can be found at %s", version, url)}
-					}
-				}
+// A version (or a single architecture of it) selected for removal.
+type removal struct {
+	version string
+	arch    arch.Architecture
+}
 
-				return
-			}
+func uninstall(args []string) {
+	force := inv.Has("force")
+	current, _ := mgr.Active()
+	confirmation := false
+	targets := make([]removal, 0)
+	seen := make(map[removal]bool)
+	links := make([]string, 0)
+
+	// Exits with exit.Partial when some versions could not be removed, or
+	// with the exit code of the first failure when none could
+	failures := make([]error, 0)
+	removed := 0
+	fail := func(err error) {
+		fmt.Println(err)
+		failures = append(failures, err)
+	}
+	done := func() {
+		switch {
+		case len(failures) == 0:
+		case removed > 0:
+			quit(exit.Partial)
+		default:
+			quit(exit.Code(failures[0]))
+		}
+	}
+
+	// The versions selected by the preceding argument, nil after a named
+	// version or an architecture
+	var previous []string
+	for i, arg := range args {
+		// Named versions (see nvm link) are only unlinked
+		if node.IsLinked(env.Root, arg) {
+			links = append(links, arg)
+			previous = nil
+			continue
 		}
-	}()
-
-	// Wait for the prior subroutine to initialize before starting the next dependent thread
-	time.Sleep(300 * time.Millisecond)
 
-	go func() {
-		v, a, err := getVersion(version, cpuarch)
-		version = v
-		cpuarch = a
-
-		// Setup signal handling first
-		signalChan := make(chan os.Signal, 1)
-		signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
-		defer signal.Stop(signalChan)
-
-		// Add signal handler
-		go func() {
-			<-signalChan
-			cancel <- true
-		}()
-
-		// Determine whether to show the progress dialog
-		for _, arg := range os.Args {
-			if arg == "--show-progress-ui" {
-				show_progress = true
-
-				exe, _ := os.Executable()
-				winIco := filepath.Join(filepath.Dir(exe), "nvm.ico")
-				ico := filepath.Join(filepath.Dir(exe), "nodejs.ico")
-
-				var perr error
-				dlg, perr = zenity.Progress(
-					zenity.Title(fmt.Sprintf("Installing Node.js v%s", version)),
-					zenity.Icon(ico),
-					zenity.WindowIcon(winIco),
-					zenity.AutoClose(),
-					zenity.NoCancel(),
-					zenity.Pulsate())
-				if perr != nil {
-					fmt.Println("Failed to create progress dialog")
+		// An architecture following a version only removes that architecture.
+		// A range must select exactly one installed version.
+		if a, err := arch.Parse(arg); err == nil && previous != nil {
+			if len(previous) > 1 {
+				usageError(&cli.UsageError{Command: inv.Command, Message: fmt.Sprintf("\"%s\" matches %d installed versions (%s). Specify one version to uninstall only its %s architecture.", args[i-1], len(previous), strings.Join(previous, ", "), a.Label())})
+			}
+			for j := range targets {
+				if len(previous) == 1 && targets[j] == (removal{version: previous[0]}) {
+					delete(seen, targets[j])
+					targets[j].arch = a
+					seen[targets[j]] = true
 				}
-				go func() {
-					for {
-						select {
-						case <-dlg.Done():
-							if err := dlg.Complete(); err == zenity.ErrCanceled {
-								cancel <- true
-							}
-							return
-						}
-					}
-				}()
-				status <- Status{Text: "Validating version..."}
-				break
 			}
+			previous = nil
+			continue
 		}
 
-		if err != nil {
-			if strings.Contains(err.Error(), "No Major.Minor.Patch") {
-				sv, sverr := semver.Make(version)
-				if sverr == nil {
-					sverr = sv.Validate()
-				}
-				if sverr != nil {
-					version = findLatestSubVersion(version)
-					if len(version) == 0 {
-						sverr = errors.New("Unrecognized version: \"" + requestedVersion + "\"")
-					}
-				}
-				err = sverr
+		versions := make([]string, 0)
+		switch strings.ToLower(arg) {
+		case "latest", "node", "lts":
+			version, _, err := mgr.Resolve(strings.ToLower(arg), arch.Unknown, false)
+			if err != nil {
+				fatal(err)
 			}
-
+			versions = append(versions, version)
+		case "newest":
+			installed := node.GetInstalled(env.Root)
+			if len(installed) == 0 {
+				fmt.Println("No versions of node.js found. Try installing the latest by typing nvm install latest.")
+				quit(exit.NotFound)
+			}
+			versions = append(versions, strings.TrimPrefix(installed[0], "v"))
+		default:
+			matches, err := node.FindInstalled(env.Root, arg)
 			if err != nil {
-				status <- Status{Err: err, Help: true}
-				return
+				fatal(err)
 			}
+			if node.IsRange(arg) {
+				confirmation = true
+			}
+			versions = matches
 		}
 
-		if err != nil {
-			status <- Status{Err: fmt.Errorf(`"%s" is not a valid version.`+"\n"+`Please use a valid semantic version number, "lts", or "latest".`, requestedVersion)}
-			return
+		if len(versions) == 0 || !mgr.InstalledAny(versions[0]) {
+			fail(exit.Errorf(exit.ErrNotFound, "node %s is not installed. Type \"nvm list\" to see what is installed.", arg))
+			previous = []string{}
+			continue
 		}
 
-		if checkVersionExceedsLatest(version) {
-			status <- Status{Err: fmt.Errorf("Node.js v%s is not yet released or is not available for download yet.", version)}
-			return
+		for _, v := range versions {
+			t := removal{version: v}
+			if !seen[t] {
+				seen[t] = true
+				targets = append(targets, t)
+			}
 		}
+		previous = versions
+	}
 
-		if cpuarch == "64" && !web.IsNode64bitAvailable(version) {
-			status <- Status{Err: fmt.Errorf("Node.js v%s is only available in 32-bit.", version)}
-			return
+	removedCurrent := false
+	for _, name := range links {
+		if name == current && !force {
+			fail(fmt.Errorf("%s is the active version. Use --force to unlink it and switch to another installed version.", name))
+			continue
 		}
 
-		// Check to see if the version is already installed
-		if !node.IsVersionInstalled(env.root, version, cpuarch) {
-			if !node.IsVersionAvailable(version) {
-				url := web.GetFullNodeUrl("index.json")
-				status <- Status{Err: fmt.Errorf("Version %s is not available.\n\nThe complete list of available versions can be found at %s", version, url)}
-				return
-			}
-
-			// Make the output directories
-			root, err := os.MkdirTemp("", "nvm-install-*")
-			if err != nil {
-				status <- Status{Err: err}
-			}
-			defer os.RemoveAll(root)
-			os.MkdirAll(filepath.Join(root, "v"+version, "node_modules"), os.ModeDir)
-			// os.MkdirAll(filepath.Join(env.root, "v"+version, "node_modules"), os.ModeDir)
+		fmt.Printf("Unlinking %s...", name)
+		if err := mgr.Unlink(name, name == current); err != nil {
+			fmt.Println(" failed")
+			fail(err)
+			continue
+		}
+		if name == current {
+			removedCurrent = true
+		}
+		removed++
+		fmt.Println(" done")
+	}
 
-			// Warn the user if they're attempting to install without verifying the remote SSL cert
-			if !env.verifyssl {
-				fmt.Println("\nWARNING: The remote SSL certificate will not be validated during the download process.\n")
-			}
+	if len(targets) == 0 && !removedCurrent {
+		done()
+		return
+	}
 
-			// Download node
-			if show_progress {
-				status <- Status{Text: "Downloading & extracting..."}
-			}
-			append32 := node.IsVersionInstalled(env.root, version, "64")
-			append64 := node.IsVersionInstalled(env.root, version, "32")
-			if (cpuarch == "32" || cpuarch == "all") && !node.IsVersionInstalled(root, version, "32") {
-				success := web.GetNodeJS(root, version, "32", append32)
-				if !success {
-					status <- Status{Err: fmt.Errorf("failed to download v%v 32-bit executable", version)}
-					return
-				}
-			}
-			if (cpuarch == "64" || cpuarch == "all") && !node.IsVersionInstalled(root, version, "64") {
-				success := web.GetNodeJS(root, version, "64", append64)
-				if !success {
-					status <- Status{Err: fmt.Errorf("failed to download v%v 64-bit executable", version)}
-					return
-				}
-			}
-			if (cpuarch == "arm64" || cpuarch == "all") && !node.IsVersionInstalled(root, version, "arm64") {
-				success := web.GetNodeJS(root, version, "arm64", append64)
-				if !success {
-					status <- Status{Err: fmt.Errorf("failed to download v%v arm 64-bit executable", version)}
-					return
-				}
-			}
+	// The active version is only removed when forced
+	selected := make([]removal, 0)
+	for _, t := range targets {
+		if t.version == current && t.arch == arch.Unknown && !force {
+			fail(fmt.Errorf("node v%s is the active version. Use --force to remove it and switch to another installed version.", t.version))
+			continue
+		}
+		selected = append(selected, t)
+	}
 
-			if file.Exists(filepath.Join(root, "v"+version, "node_modules", "npm")) {
-				utility.DebugLogf("move %v to %v", filepath.Join(root, "v"+version), filepath.Join(env.root, "v"+version))
-				if rnerr := utility.Rename(filepath.Join(root, "v"+version), filepath.Join(env.root, "v"+version)); rnerr != nil {
-					status <- Status{Err: err}
-				}
-				utility.DebugFn(func() {
-					utility.DebugLogf("env root: %v", env.root)
-					cmd := exec.Command("cmd", "/C", "dir", filepath.Join(env.root, "v"+version))
-					out, err := cmd.CombinedOutput()
-					if err != nil {
-						utility.DebugLog(err.Error())
-					} else {
-						utility.DebugLog(string(out))
-					}
-				})
+	if len(selected) == 0 && !removedCurrent {
+		done()
+		return
+	}
 
-				if show_progress {
-					status <- Status{Text: "Configuring npm..."}
-					time.Sleep(1 * time.Second)
-					status <- Status{Done: true}
-				} else {
-					npmv := getNpmVersion(version)
-					status <- Status{Text: fmt.Sprintf("npm v%s installed successfully.\n\nIf you want to use this version, type\n\nnvm use %s", npmv, version), Done: true}
-				}
+	if confirmation && len(selected) > 0 && !inv.Has("yes") {
+		fmt.Println("The following versions will be uninstalled:")
+		for _, t := range selected {
+			if t.arch != arch.Unknown {
+				fmt.Printf("  v%s (%s only)\n", t.version, t.arch.Label())
+			} else {
+				fmt.Printf("  v%s\n", t.version)
 			}
+		}
 
-			// If successful, add npm
-			status <- Status{Text: "Downloading npm..."}
-			npmv := getNpmVersion(version)
-			success := web.GetNpm(root, getNpmVersion(version))
-			if success {
-				status <- Status{Text: fmt.Sprintf("Installing npm v%s...", npmv)}
-
-				// new temp directory under the nvm root
-				tempDir, err := os.MkdirTemp("", "nvm-npm-*")
-				if err != nil {
-					status <- Status{Err: err}
-				}
-				defer os.RemoveAll(tempDir)
-
-				// Extract npm to the temp directory
-				err = file.Unzip(filepath.Join(tempDir, "npm-v"+npmv+".zip"), filepath.Join(tempDir, "nvm-npm"))
-				if err != nil {
-					status <- Status{Err: err}
-				}
-
-				// Copy the npm and npm.cmd files to the installation directory
-				tempNpmBin := filepath.Join(tempDir, "nvm-npm", "cli-"+npmv, "bin")
-
-				// Support npm < 6.2.0
-				if file.Exists(tempNpmBin) == false {
-					tempNpmBin = filepath.Join(tempDir, "nvm-npm", "npm-"+npmv, "bin")
-				}
-
-				if file.Exists(tempNpmBin) == false {
-					status <- Status{Err: fmt.Errorf("Failed to extract npm. Could not find %s", tempNpmBin), Done: true}
-					return
-				}
-
-				// Standard npm support
-				utility.Rename(filepath.Join(tempNpmBin, "npm"), filepath.Join(root, "v"+version, "npm"))
-				utility.Rename(filepath.Join(tempNpmBin, "npm.cmd"), filepath.Join(root, "v"+version, "npm.cmd"))
-
-				// npx support
-				if _, err := os.Stat(filepath.Join(tempNpmBin, "npx")); err == nil {
-					utility.Rename(filepath.Join(tempNpmBin, "npx"), filepath.Join(root, "v"+version, "npx"))
-					utility.Rename(filepath.Join(tempNpmBin, "npx.cmd"), filepath.Join(root, "v"+version, "npx.cmd"))
-				}
+		if !confirm("Continue?") {
+			fmt.Println("Uninstall canceled.")
+			done()
+			return
+		}
+	}
 
-				npmSourcePath := filepath.Join(tempDir, "nvm-npm", "npm-"+npmv)
+	for _, t := range selected {
+		dir := filepath.Join(env.Root, "v"+t.version)
 
-				if file.Exists(npmSourcePath) == false {
-					npmSourcePath = filepath.Join(tempDir, "nvm-npm", "cli-"+npmv)
-				}
+		// Remove a single architecture, unless it is the only one installed
+		if t.arch != arch.Unknown && len(node.Architectures(dir)) > 1 {
+			fmt.Printf("Uninstalling node v%s (%s)...", t.version, t.arch.Label())
+			if err := mgr.RemoveArchitecture(t.version, t.arch); err != nil {
+				fmt.Println(" failed")
+				fail(err)
+				continue
+			}
+			removed++
+			fmt.Println(" done")
+			continue
+		} else if t.arch != arch.Unknown && !node.HasArchitecture(dir, t.arch) {
+			fail(exit.Errorf(exit.ErrNotFound, "node v%s (%s) is not installed.", t.version, t.arch.Label()))
+			continue
+		}
 
-				moveNpmErr := utility.Rename(npmSourcePath, filepath.Join(root, "v"+version, "node_modules", "npm"))
-				if moveNpmErr != nil {
-					// sometimes Windows can take some time to enable access to large amounts of files after unzip, use exponential backoff to wait until it is ready
-					for _, i := range [5]int{1, 2, 4, 8, 16} {
-						time.Sleep(time.Duration(i) * time.Second)
-						moveNpmErr = utility.Rename(npmSourcePath, filepath.Join(root, "v"+version, "node_modules", "npm"))
-						if moveNpmErr == nil {
-							break
-						}
-					}
-				}
+		if t.version == current && !force {
+			fail(fmt.Errorf("node v%s (%s) is the only architecture of the active version. Use --force to remove it.", t.version, t.arch.Label()))
+			continue
+		}
 
-				if err == nil && moveNpmErr == nil {
-					err = utility.Rename(filepath.Join(root, "v"+version), filepath.Join(env.root, "v"+version))
-					if err != nil {
-						status <- Status{Err: err}
-					}
-					if show_progress {
-						status <- Status{Done: true}
-					} else {
-						status <- Status{Text: fmt.Sprintf("Installation complete. If you want to use this version, type\n\nnvm use %s", version), Done: true}
-					}
-				} else if moveNpmErr != nil {
-					status <- Status{Err: fmt.Errorf("Unable to move directory %s to node_modules: %v", npmSourcePath, moveNpmErr), Done: true}
-				} else {
-					status <- Status{Err: fmt.Errorf("Failed to extract npm: %v", err), Done: true}
-				}
-			} else {
-				err = utility.Rename(filepath.Join(root, "v"+version), filepath.Join(env.root, "v"+version))
-				if err != nil {
-					status <- Status{Err: err}
-				}
+		fmt.Printf("Uninstalling node v%s...", t.version)
+		if err := mgr.Remove(t.version, t.version == current); err != nil {
+			fmt.Println(" failed")
+			fail(err)
+			continue
+		}
+		if t.version == current {
+			removedCurrent = true
+		}
+		removed++
+		fmt.Println(" done")
+	}
 
-				npmurl := web.GetFullNpmUrl(version)
-				if show_progress {
-					// Send special error notification with link to npm release when it cannot be downloaded
-					notify(Notification{
-						Title:   "Download Failure (npm)",
-						Message: fmt.Sprintf("Please download npm v%s manually and extract to %s\\v%s", version, env.root, version),
-						Icon:    "error",
-						Actions: []Action{
-							{Type: "protocol", Label: "Manually Download", URI: npmurl},
-						},
-					})
-					status <- Status{Done: true}
-				} else {
-					status <- Status{Err: fmt.Errorf("Could not download npm for node v%s.\nPlease visit %s to download npm.\nIt should be extracted to %s\\v%s", version, npmurl, env.root, version), Done: true}
-				}
-			}
+	// Fall back to the newest remaining version
+	if removedCurrent {
+		installed := node.GetInstalled(env.Root)
+		if len(installed) == 0 {
+			fmt.Println("No versions of node.js remain installed.")
 		} else {
-			status <- Status{Text: "Version " + version + " is already installed.", Done: true}
+			fmt.Printf("Switching to node %s...\n", installed[0])
+			use(strings.TrimPrefix(installed[0], "v"), "")
 		}
-	}()
+	}
 
-	// Wait for the process to complete before exiting
-	wg.Wait()
-	os.Exit(exitCode)
+	done()
 }
 
-func reinstall(version, cpuarch string) {
-	// Make sure a version is specified
-	if len(version) == 0 {
-		fmt.Println("Provide the version you want to uninstall.")
-		help()
-		return
-	}
+// Asks a yes/no question on the console. Anything but yes means no.
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
 
-	if strings.ToLower(version) == "latest" || strings.ToLower(version) == "node" {
-		version = getLatest()
-	} else if strings.ToLower(version) == "lts" {
-		version = getLTS()
-	} else if strings.ToLower(version) == "newest" {
-		installed := node.GetInstalled(env.root)
-		if len(installed) == 0 {
-			fmt.Println("No versions of node.js found. Try installing the latest by typing nvm install latest.")
+// Registers an external node directory as a named version, which can be
+// used like any installed version. Without arguments, the named versions
+// are listed.
+func linkVersion(args []string) {
+	if len(args) == 0 {
+		links := node.GetLinked(env.Root)
+		if len(links) == 0 {
+			fmt.Println("No named versions. Use \"nvm link <name> <path>\" to add one.")
 			return
 		}
+		for _, l := range links {
+			fmt.Printf("  %s -> %s\n", l.Name, l.Target)
+		}
+		return
+	}
 
-		version = installed[0]
+	if len(args) < 2 {
+		fmt.Println("Provide the name and the directory of the node build to link.")
+		help()
+		quit(exit.Usage)
 	}
 
-	version = cleanVersion(version)
+	a, err := mgr.Link(args[0], args[1])
+	if err != nil {
+		fatal(err)
+	}
 
-	// Determine if the version exists and skip if it doesn't
-	if node.IsVersionInstalled(env.root, version, "32") || node.IsVersionInstalled(env.root, version, "64") {
-		v, _ := node.GetCurrentVersion()
+	fmt.Printf("Linked %s (%s) to %s. To use it, type:\n\nnvm use %s\n", args[0], a.Label(), args[1], args[0])
+}
 
-		fmt.Printf("Removing v%v...\n", version)
+// Writes installed versions to an offline bundle (see bundle).
+func pack(specs []string) {
+	out := inv.Value("out")
+	if out == "" {
+		out = "nvm-bundle.zip"
+	}
 
-		if v == version {
-			// _, err := runElevated(fmt.Sprintf(`"%s" cmd /C rmdir "%s"`, filepath.Join(env.root, "elevate.cmd"), filepath.Clean(env.symlink)))
-			abortOnBadSymlink(env.symlink)
-			_, err := elevatedRun("rmdir", filepath.Clean(env.symlink))
-			if err != nil {
-				fmt.Println(fmt.Sprint(err))
-				return
-			}
+	versions := make([]string, 0)
+	for _, spec := range specs {
+		version := node.MatchInstalled(env.Root, spec)
+		if version == "" {
+			fmt.Printf("node %s is not installed. Type \"nvm list\" to see what is installed.\n", spec)
+			quit(exit.NotFound)
 		}
+		versions = append(versions, version)
+	}
 
-		e := os.RemoveAll(filepath.Join(env.root, "v"+version))
-		if e != nil {
-			fmt.Printf("error: failed to remove v%v: %v\n", version, e)
-			os.Exit(1)
-		}
-	} else {
-		fmt.Printf("node v%v is not installed. Type \"nvm list\" to see what is installed.\n", version)
+	fmt.Printf("Packing node %s...\n", "v"+strings.Join(versions, ", v"))
+	meta, err := bundle.Pack(env.Root, versions, out)
+	if err != nil {
+		fmt.Printf("Error creating %s: %v\n", out, err)
+		quit(exit.Code(err))
 	}
 
-	install(version, cpuarch)
+	for _, v := range meta.Versions {
+		fmt.Printf("  v%s (%s): %d files, %s\n", v.Version, strings.Join(v.Architectures, ", "), v.Files, humanize.Bytes(uint64(v.Size)))
+	}
+	fmt.Printf("Created %s\n", out)
 }
 
-func uninstall(version string) {
-	// Make sure a version is specified
-	if len(version) == 0 {
-		fmt.Println("Provide the version you want to uninstall.")
-		help()
-		return
+// Verifies and installs the versions of an offline bundle.
+func unpack(path string) {
+	fmt.Printf("Unpacking %s...\n", path)
+	results, err := bundle.Unpack(path, env.Root)
+	if err != nil {
+		fmt.Printf("Error unpacking %s: %v\n", path, err)
+		quit(exit.Code(err))
 	}
 
-	if strings.ToLower(version) == "latest" || strings.ToLower(version) == "node" {
-		version = getLatest()
-	} else if strings.ToLower(version) == "lts" {
-		version = getLTS()
-	} else if strings.ToLower(version) == "newest" {
-		installed := node.GetInstalled(env.root)
-		if len(installed) == 0 {
-			fmt.Println("No versions of node.js found. Try installing the latest by typing nvm install latest.")
-			return
+	var failure error
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Printf("  v%s: %v\n", r.Version, r.Err)
+			if failure == nil {
+				failure = r.Err
+			}
+			failed++
+		} else if r.Exists {
+			fmt.Printf("  v%s: already installed\n", r.Version)
+		} else {
+			fmt.Printf("  v%s: installed\n", r.Version)
 		}
+	}
 
-		version = installed[0]
+	switch {
+	case failed == 0:
+		quit(exit.OK)
+	case failed < len(results):
+		quit(exit.Partial)
+	default:
+		quit(exit.Code(failure))
 	}
+}
 
-	version = cleanVersion(version)
+func use(version string, requestedArch string) {
+	archs, err := getArchitectures(requestedArch, false)
+	if err != nil {
+		fmt.Printf("activation error: %v\n", err)
+		quit(exit.Usage)
+	}
 
-	// Determine if the version exists and skip if it doesn't
-	if node.IsVersionInstalled(env.root, version, "32") || node.IsVersionInstalled(env.root, version, "64") || node.IsVersionInstalled(env.root, version, "arm64") {
-		fmt.Printf("Uninstalling node v" + version + "...")
-		v, _ := node.GetCurrentVersion()
-		if v == version {
-			// _, err := runElevated(fmt.Sprintf(`"%s" cmd /C rmdir "%s"`, filepath.Join(env.root, "elevate.cmd"), filepath.Clean(env.symlink)))
-			abortOnBadSymlink(env.symlink)
-			_, err := elevatedRun("rmdir", filepath.Clean(env.symlink))
-			if err != nil {
-				fmt.Println(fmt.Sprint(err))
-				return
-			}
+	notifications := inv.Has("notify")
+
+	result, err := mgr.Use(version, archs[0])
+	if err != nil {
+		if result != nil {
+			version = result.Version
 		}
-		e := os.RemoveAll(filepath.Join(env.root, "v"+version))
-		if e != nil {
-			fmt.Println("Error removing node v" + version)
-			fmt.Println("Manually remove " + filepath.Join(env.root, "v"+version) + ".")
-		} else {
-			fmt.Printf(" done")
+
+		if notifications {
+			notify(Notification{
+				Title:   "Node.js Activation Error",
+				Message: fmt.Sprintf("nvm use %s failed because %v", version, err),
+				Icon:    "error",
+			})
 		}
-	} else {
-		fmt.Println("node v" + version + " is not installed. Type \"nvm list\" to see what is installed.")
-	}
-	return
-}
 
-func versionNumberFrom(version string) string {
-	reg, _ := regexp.Compile("[^0-9]")
+		fmt.Printf("activation error: %v\n", err)
 
-	if reg.MatchString(version[:1]) {
-		if version[0:1] != "v" {
-			url := web.GetFullNodeUrl("latest-" + version + "/SHASUMS256.txt")
-			remoteContent, err := web.GetRemoteTextFile(url)
-			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
-			}
-			content := strings.Split(remoteContent, "\n")[0]
-			if strings.Contains(content, "node") {
-				parts := strings.Split(content, "-")
-				if len(parts) > 1 {
-					if parts[1][0:1] == "v" {
-						return parts[1][1:]
-					}
-				}
+		var missing *manager.NotInstalledError
+		if errors.As(err, &missing) {
+			if len(missing.Installed) > 0 {
+				other := missing.Installed[0]
+				fmt.Printf("Did you mean node v%s (%v)?\nIf so, type \"nvm use %s %v\" to use it.\n", version, other.Label(), version, other.Bits())
+			} else {
+				fmt.Println("Version not installed. Run \"nvm ls\" to see available versions.")
 			}
-			fmt.Printf("\"%v\" is not a valid version or known alias.\n", version)
-			fmt.Println("\nAvailable aliases: latest, node (latest), lts\nNamed releases (boron, dubnium, etc) are also supported.")
-			os.Exit(0)
 		}
+
+		quit(exit.Code(err))
 	}
 
-	for reg.MatchString(version[:1]) {
-		version = version[1:]
+	if result.Unchanged {
+		fmt.Println("node v" + result.Version + " (" + result.Arch.Label() + ") is already in use.")
+		return
+	}
+
+	if notifications {
+		notify(Notification{
+			Title:   "Node.js Activated",
+			Message: fmt.Sprintf("Your system is now configured to use v%s (%v).", result.Version, result.Arch.Label()),
+			Icon:    "success",
+			Actions: []Action{
+				{Type: "protocol", Label: "View Changelog", URI: fmt.Sprintf("https://github.com/nodejs/node/releases/tag/v%s", result.Version)},
+			},
+		})
 	}
 
-	return version
+	fmt.Printf("Now using node v%s (%v)\n", result.Version, result.Arch.Label())
 }
 
-func splitVersion(version string) map[string]int {
-	parts := strings.Split(version, ".")
-	var result = make([]int, 3)
+// Runs a command with the specified node version without changing the
+// active version. The NVM_SYMLINK is not modified, so no elevation is
+// required. When script is true, the command is run by node itself.
+func execute(args []string, script bool) {
+	version, _, err := mgr.Resolve(args[0], env.Arch, true)
+	if err != nil {
+		fatal(err)
+	}
 
-	for i, item := range parts {
-		v, _ := strconv.Atoi(item)
-		result[i] = v
+	dir := node.Dir(env.Root, version)
+	if !file.Exists(filepath.Join(dir, "node.exe")) {
+		fmt.Printf("node v%s is not installed. Type \"nvm list\" to see what is installed.\n", version)
+		quit(exit.NotFound)
 	}
 
-	return map[string]int{
-		"major": result[0],
-		"minor": result[1],
-		"patch": result[2],
+	command := args[1:]
+	if len(command) > 0 && command[0] == "--" {
+		command = command[1:]
+	}
+	if script {
+		command = append([]string{filepath.Join(dir, "node.exe")}, command...)
 	}
-}
 
-func findLatestSubVersion(version string, localOnly ...bool) string {
-	if len(localOnly) > 0 && localOnly[0] {
-		installed := node.GetInstalled(env.root)
-		result := ""
-		for _, v := range installed {
-			if strings.HasPrefix(v, "v"+version) {
-				if result != "" {
-					current, _ := semver.New(versionNumberFrom(result))
-					next, _ := semver.New(versionNumberFrom(v))
-					if current.LT(*next) {
-						result = v
-					}
-				} else {
-					result = v
-				}
-			}
-		}
+	if len(command) == 0 {
+		fmt.Println("Provide a command to run.")
+		quit(exit.Usage)
+	}
 
-		if len(strings.TrimSpace(result)) > 0 {
-			return versionNumberFrom(result)
-		}
+	// Apply the environment to this process so the command itself is
+	// resolved from the requested version's directory first.
+	for key, value := range node.Env(dir, os.Getenv("PATH")) {
+		os.Setenv(key, value)
 	}
 
-	if len(strings.Split(version, ".")) == 2 {
-		all, _, _, _, _, _ := node.GetAvailable()
-		requested := splitVersion(version + ".0")
-		for _, v := range all {
-			available := splitVersion(v)
-			if requested["major"] == available["major"] {
-				if requested["minor"] == available["minor"] {
-					if available["patch"] > requested["patch"] {
-						requested["patch"] = available["patch"]
-					}
-				}
-				if requested["minor"] > available["minor"] {
-					break
-				}
-			}
+	utility.DebugLogf("exec (v%s): %v", version, strings.Join(command, " "))
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		fmt.Printf("error running %s: %v\n", command[0], err)
+		quit(exit.Code(err))
+	}
 
-			if requested["major"] > available["major"] {
-				break
+	// The child shares the console, so it receives Ctrl+C directly. Other
+	// termination requests are forwarded to it.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		for sig := range signals {
+			if sig == os.Interrupt {
+				continue
+			}
+			if err := cmd.Process.Signal(sig); err != nil {
+				cmd.Process.Kill()
 			}
 		}
-		return fmt.Sprintf("%v.%v.%v", requested["major"], requested["minor"], requested["patch"])
+	}()
+
+	err = cmd.Wait()
+	if err != nil {
+		if exiterr, ok := err.(*exec.ExitError); ok {
+			quit(exiterr.ExitCode())
+		}
+		fmt.Printf("error running %s: %v\n", command[0], err)
+		quit(exit.Code(err))
 	}
 
-	url := web.GetFullNodeUrl("latest-v" + version + ".x" + "/SHASUMS256.txt")
-	content, err := web.GetRemoteTextFile(url)
-	if err != nil {
-		if strings.Contains(err.Error(), "HTTP Status 404") {
-			fmt.Printf("\"%s\" is not a valid version number (or partial version number).\n\nIf you are trying to install a version that was just announced within the last few minutes, it may not be available for download yet (try again in 15 minutes).\n", version)
-		} else {
+	quit(0)
+}
+
+// Returns the shell specified with --shell, or the detected shell.
+func sessionShell() shell.Shell {
+	if name := inv.Value("shell"); name != "" {
+		sh, err := shell.Parse(name)
+		if err != nil {
 			fmt.Println(err)
+			quit(exit.Usage)
 		}
-		os.Exit(1)
+		return sh
 	}
-	re := regexp.MustCompile("node-v(.+)+msi")
-	reg := regexp.MustCompile("node-v|-[xa].+")
-	latest := reg.ReplaceAllString(re.FindString(content), "")
-	return latest
+
+	return shell.Detect()
 }
 
-func accessDenied(err error) bool {
-	fmt.Println(fmt.Sprintf("%v", err))
+// Returns the environment variables that activate a version for a single
+// session. Any version previously activated for the session is removed
+// from the PATH. An empty version deactivates the session version.
+func sessionEnv(version string) map[string]string {
+	path := shell.Filter(os.Getenv("PATH"), func(entry string) bool {
+		return strings.EqualFold(filepath.Dir(filepath.Clean(entry)), env.Root)
+	})
 
-	if strings.Contains(strings.ToLower(err.Error()), "access is denied") {
-		fmt.Println("See https://bit.ly/nvm4w-help")
-		return true
+	if version == "" {
+		return map[string]string{
+			"PATH":                path,
+			"NVM_BIN":             "",
+			"NODE":                "",
+			"NPM_CONFIG_PREFIX":   "",
+			shell.SessionVariable: "",
+		}
 	}
 
-	return false
+	vars := node.Env(node.Dir(env.Root, version), path)
+	vars[shell.SessionVariable] = version
+
+	return vars
 }
 
-func isSymlink(path string) (bool, error) {
-	info, err := os.Lstat(path)
+// Resolves an installed version for session use, exiting if it is not available.
+func sessionVersion(version string) string {
+	v, _, err := mgr.Resolve(version, env.Arch, true)
 	if err != nil {
-		return false, err
+		fatal(err)
+	}
+
+	if !file.Exists(filepath.Join(node.Dir(env.Root, v), "node.exe")) {
+		fmt.Printf("node v%s is not installed. Type \"nvm list\" to see what is installed.\n", v)
+		quit(exit.NotFound)
 	}
-	return info.Mode()&os.ModeSymlink != 0, nil
-}
 
-func use(version string, cpuarch string, reload ...bool) {
-	version, cpuarch, err := getVersion(version, cpuarch, true)
+	return v
+}
 
-	exitCode := 0
-	status := make(chan Status)
-	wg := &sync.WaitGroup{}
-	wg.Add(1)
-	notifications := false
+// Prints the statements that activate a version for the current shell
+// session only. The NVM_SYMLINK is not modified. Use "off" to deactivate.
+func session(version string, hint bool) {
+	sh := sessionShell()
 
-	if os.Args[len(os.Args)-1] == "--notify" {
-		notifications = true
+	if version == "" {
+		fmt.Println("Provide the version to activate for this session, or \"off\" to deactivate it.")
+		quit(exit.Usage)
 	}
 
-	go func() {
-		defer func() {
-			if notifications {
-				time.Sleep(1 * time.Second)
-			}
-			wg.Done()
-		}()
-
-		for {
-			select {
-			case s := <-status:
-				if s.Err != nil {
-					exitCode = 1
-					if notifications {
-						// Close progress dialog and send error notificaion
-						notify(Notification{
-							Title:   "Node.js Activation Error",
-							Message: fmt.Sprintf("nvm use %s failed because %v", version, s.Err),
-							Icon:    "error",
-						})
-					}
-
-					fmt.Printf("activation error: %v\n", s.Err)
-					if s.Help {
-						fmt.Println(" ")
-						help()
-					}
-
-					return
-				}
+	if strings.ToLower(version) != "off" {
+		version = sessionVersion(version)
+	} else {
+		version = ""
+	}
 
-				if s.Done {
-					if s.Err == nil {
-						if notifications {
-							notify(Notification{
-								Title:   "Node.js Activated",
-								Message: fmt.Sprintf("Your system is now configured to use v%s (%v-bit).", version, cpuarch),
-								Icon:    "success",
-								Actions: []Action{
-									{Type: "protocol", Label: "View Changelog", URI: fmt.Sprintf("https://github.com/nodejs/node/releases/tag/v%s", version)},
-								},
-							})
-						}
-
-						fmt.Printf("Now using node v%s (%v-bit)\n", version, cpuarch)
-					}
-
-					return
-				}
+	fmt.Println(shell.Script(sh, sessionEnv(version)))
 
-				if len(strings.TrimSpace(s.Text)) > 0 {
-					fmt.Println(s.Text)
-				}
-			}
+	if hint && isConsole(os.Stdout) {
+		cmd := strings.Join(os.Args[1:], " ")
+		switch sh {
+		case shell.PowerShell:
+			fmt.Fprintf(os.Stderr, "\nTo apply to this session, run: nvm %s | Out-String | Invoke-Expression\n", cmd)
+		case shell.Cmd:
+			fmt.Fprintf(os.Stderr, "\nTo apply to this session, run: for /f \"delims=\" %%i in ('nvm %s') do @%%i\n", cmd)
+		case shell.Bash:
+			fmt.Fprintf(os.Stderr, "\nTo apply to this session, run: eval \"$(nvm %s)\"\n", cmd)
 		}
-	}()
+	}
+}
 
-	time.Sleep(300 * time.Millisecond)
+// Resolves the version required by the nearest .nvmrc file. With --shell,
+// the statements required to switch the session to that version are
+// printed (nothing is printed when the session already uses it). This runs
+// on every prompt when the shell hook is installed, so it must never access
+// the network or spawn node.
+func resolve() {
+	cwd, _ := os.Getwd()
+	project, err := shim.Project(env.Root, cwd)
+	var missing *shim.NotInstalledError
+	if err != nil && !errors.Is(err, nvmrc.ErrNotFound) && !errors.As(err, &missing) {
+		fmt.Fprintln(os.Stderr, err)
+		quit(exit.Code(err))
+	}
 
-	go func() {
-		if err != nil {
-			if !strings.Contains(err.Error(), "No Major.Minor.Patch") {
-				status <- Status{Err: err, Done: true}
-			}
+	if inv.Value("shell") == "" {
+		if errors.Is(err, nvmrc.ErrNotFound) {
+			fmt.Fprintln(os.Stderr, "No .nvmrc file found.")
+			quit(exit.NotFound)
 		}
 
-		// Check if a change is needed
-		curVersion, curCpuarch := node.GetCurrentVersion()
-		if version == curVersion && cpuarch == curCpuarch {
-			fmt.Println("node v" + version + " (" + cpuarch + "-bit) is already in use.")
-			status <- Status{Done: true}
-			return
+		if missing != nil {
+			fmt.Fprintf(os.Stderr, "%s requires node %s, which is not installed.\n", missing.File, missing.Spec)
+			quit(exit.NotFound)
 		}
 
-		// Make sure the version is installed. If not, warn.
-		if !node.IsVersionInstalled(env.root, version, cpuarch) {
-			err = fmt.Errorf("node v%s (%v-bit) is not installed.", version, cpuarch)
-			if notifications {
-				status <- Status{Err: err, Done: true}
-			}
-			if (cpuarch == "32" && node.IsVersionInstalled(env.root, version, "64")) || (cpuarch == "64" && node.IsVersionInstalled(env.root, version, "32")) {
-				status <- Status{Err: fmt.Errorf("Did you mean node v%s (%v-bit)?\nIf so, type \"nvm use %s %v\" to use it.", version, cpuarch, version, cpuarch), Done: true}
-			}
-			status <- Status{Err: fmt.Errorf("Version not installed. Run \"nvm ls\" to see available versions."), Done: true}
-		}
+		fmt.Println(project.Version)
+		return
+	}
 
-		// Remove symlink if it already exists
-		sym, _ := os.Lstat(env.symlink)
-		if sym != nil {
-			err = validSymlink(env.symlink)
-			if err != nil {
-				status <- Status{Err: err, Done: true}
-			}
+	sh := sessionShell()
+	current := os.Getenv(shell.SessionVariable)
 
-			// _, err := runElevated(fmt.Sprintf(`"%s" cmd /C rmdir "%s"`, filepath.Join(env.root, "elevate.cmd"), filepath.Clean(env.symlink)))
-			_, err := elevatedRun("rmdir", filepath.Clean(env.symlink))
-			if err != nil {
-				if accessDenied(err) {
-					status <- Status{Err: err, Done: true}
-				}
-			}
+	// Leaving a project restores the global version, but only when the
+	// session version was activated by the hook.
+	if errors.Is(err, nvmrc.ErrNotFound) {
+		if current != "" && os.Getenv(shell.RCVariable) != "" {
+			vars := sessionEnv("")
+			vars[shell.RCVariable] = ""
+			fmt.Println(shell.Script(sh, vars))
 		}
+		return
+	}
 
-		// Create new symlink
-		var ok bool
-		// ok, err = runElevated(fmt.Sprintf(`"%s" cmd /C mklink /D "%s" "%s"`, filepath.Join(env.root, "elevate.cmd"), filepath.Clean(env.symlink), filepath.Join(env.root, "v"+version)))
-		ok, err = elevatedRun("mklink", "/D", filepath.Clean(env.symlink), filepath.Join(env.root, "v"+version))
-		if err != nil {
-			if strings.Contains(err.Error(), "not have sufficient privilege") || strings.Contains(strings.ToLower(err.Error()), "access is denied") {
-				ok, err = elevatedRun("mklink", "/D", filepath.Clean(env.symlink), filepath.Join(env.root, "v"+version))
-				if err != nil {
-					ok = false
-					status <- Status{Err: err, Done: true}
-					// fmt.Println(fmt.Sprint(err)) // + ": " + _stderr.String())
-				} else {
-					ok = true
-				}
-			} else if strings.Contains(err.Error(), "file already exists") {
-				err = validSymlink(env.symlink)
-				if err != nil {
-					status <- Status{Err: err, Done: true}
-				}
-
-				ok, err = elevatedRun("rmdir", filepath.Clean(env.symlink))
-				// ok, err = runElevated(fmt.Sprintf(`"%s" cmd /C rmdir "%s"`, filepath.Join(env.root, "elevate.cmd"), filepath.Clean(env.symlink)))
-				reloadable := true
-				if len(reload) > 0 {
-					reloadable = reload[0]
-				}
-				if err != nil {
-					status <- Status{Err: err, Done: true}
-				} else if reloadable {
-					use(version, cpuarch, false)
-					return
-				}
-			} else {
-				status <- Status{Err: err, Done: true}
-			}
-		}
-		if !ok {
-			status <- Status{Err: fmt.Errorf("failed to elevate permissions to create symlink"), Done: true}
-		}
-
-		// Use the assigned CPU architecture
-		cpuarch = arch.Validate(cpuarch)
-		nodepath := filepath.Join(env.root, "v"+version, "node.exe")
-		node32path := filepath.Join(env.root, "v"+version, "node32.exe")
-		node64path := filepath.Join(env.root, "v"+version, "node64.exe")
-		node32exists := file.Exists(node32path)
-		node64exists := file.Exists(node64path)
-		nodeexists := file.Exists(nodepath)
-		if node32exists && cpuarch == "32" { // user wants 32, but node.exe is 64
-			if nodeexists {
-				utility.Rename(nodepath, node64path) // node.exe -> node64.exe
-			}
-			utility.Rename(node32path, nodepath) // node32.exe -> node.exe
-		}
-		if node64exists && cpuarch == "64" { // user wants 64, but node.exe is 32
-			if nodeexists {
-				utility.Rename(nodepath, node32path) // node.exe -> node32.exe
+	if missing != nil && inv.Has("install") {
+		fmt.Fprintf(os.Stderr, "%s requires node %s. Installing...\n", missing.File, missing.Spec)
+		exe, _ := os.Executable()
+		cmd := exec.Command(exe, "install", missing.Spec)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to install node %s: %v\n", missing.Spec, err)
+			if exiterr, ok := err.(*exec.ExitError); ok {
+				quit(exiterr.ExitCode())
 			}
-			utility.Rename(node64path, nodepath) // node64.exe -> node.exe
+			quit(exit.Code(err))
 		}
+		project, err = shim.Project(env.Root, cwd)
+	}
 
-		status <- Status{Done: true}
-	}()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+
+	if project.Version == current {
+		return
+	}
 
-	// Wait for the process to complete before exiting
-	wg.Wait()
-	os.Exit(exitCode)
+	vars := sessionEnv(project.Version)
+	vars[shell.RCVariable] = project.File
+	fmt.Println(shell.Script(sh, vars))
 }
 
-func abortOnBadSymlink(symlinkpath string) {
-	if err := validSymlink(symlinkpath); err != nil {
-		fmt.Printf("%v\n", err)
-		os.Exit(1)
+// Prints the shell hook that switches versions automatically whenever the
+// working directory changes.
+func hook() {
+	exe, _ := os.Executable()
+	args := []string{}
+	if inv.Has("install") {
+		args = append(args, "--install")
+	}
+
+	script, err := shell.Hook(sessionShell(), exe, args...)
+	if err != nil {
+		fatal(err)
 	}
+
+	fmt.Println(script)
 }
 
-func validSymlink(symlinkpath string) error {
-	symlinkpath = filepath.Clean(symlinkpath)
-	// Prevent deletion if the symlink has been set to a physical directpry/file.
-	// This isn't supposed to ever happen, but users have manually changed the settings.txt,
-	// removing the physical file/directory unintentionally.
-	// This is an anti-footgun.
-	if symlink, err := isSymlink(symlinkpath); !symlink && err == nil {
-		return fmt.Errorf("NVM_SYMLINK is set to a physical file/directory at %s\nPlease remove the location and try again, or select a different location for NVM_SYMLINK.\n", env.symlink)
+// Launches a new interactive shell with a version activated for that
+// shell only. The version is deactivated when the shell exits.
+func subshell(version string) {
+	version = sessionVersion(version)
+	sh := sessionShell()
+
+	for key, value := range sessionEnv(version) {
+		os.Setenv(key, value)
 	}
 
-	return nil
+	fmt.Printf("Starting a new %s session using node v%s. Type \"exit\" to return.\n", sh, version)
+
+	cmd := exec.Command(sh.Executable())
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	signal.Ignore(os.Interrupt)
+
+	if err := cmd.Run(); err != nil {
+		if exiterr, ok := err.(*exec.ExitError); ok {
+			quit(exiterr.ExitCode())
+		}
+		fmt.Printf("error starting %s: %v\n", sh.Executable(), err)
+		quit(exit.Code(err))
+	}
+}
+
+// Returns true when the file is attached to a console (i.e. not redirected).
+func isConsole(f *os.File) bool {
+	var mode uint32
+	return windows.GetConsoleMode(windows.Handle(f.Fd()), &mode) == nil
 }
 
 func useArchitecture(a string) {
-	if strings.ContainsAny("32", os.Getenv("PROCESSOR_ARCHITECTURE")) {
-		fmt.Println("This computer only supports 32-bit processing.")
+	target, err := arch.Parse(a)
+	if err != nil {
+		fmt.Println(err)
 		return
 	}
-	if strings.Contains("arm64", strings.ToLower(os.Getenv("PROCESSOR_ARCHITECTURE"))) {
-		fmt.Println("This computer only supports arm64-bit processing.")
+
+	host := arch.Host()
+	if !host.CanRun(target) {
+		fmt.Printf("This computer (%s) cannot run %s executables.\n", host.Label(), target.Label())
 		return
 	}
-	if a == "32" || a == "64" {
-		env.arch = a
-		saveSettings()
-		fmt.Println("Set to " + a + "-bit mode")
+
+	env.Arch = target
+	saveSettings()
+
+	if host.Emulated(target) {
+		fmt.Printf("Default architecture set to %s (runs under emulation on this %s computer).\n", target.Label(), host.Label())
 	} else {
-		fmt.Println("Cannot set architecture to " + a + ". Must be 32 or 64 are acceptable values.")
+		fmt.Printf("Default architecture set to %s.\n", target.Label())
 	}
 }
 
@@ -1308,11 +1316,17 @@ func list(listtype string) {
 		return
 	}
 
+	if inv.Has("json") {
+		listJSON(listtype)
+		return
+	}
+
 	if listtype == "installed" {
 		fmt.Println("")
-		inuse, a := node.GetCurrentVersion()
+		current := activeNode()
+		inuse, a := current.Version, current.Arch
 
-		v := node.GetInstalled(env.root)
+		v := node.GetInstalled(env.Root)
 
 		for i := 0; i < len(v); i++ {
 			version := v[i]
@@ -1325,18 +1339,40 @@ func list(listtype string) {
 					str = str + "    "
 				}
 				str = str + regexp.MustCompile("v").ReplaceAllString(version, "")
+				if src := node.GetSource(filepath.Join(env.Root, version)); src.Name != "official" {
+					str = str + " [" + src.Name + "]"
+				}
 				if "v"+inuse == version {
-					str = str + " (Currently using " + a + "-bit executable)"
+					str = str + " (Currently using " + a.Label() + " executable)"
 					//            str = ansi.Color(str,"green:black")
 				}
 				fmt.Printf(str + "\n")
 			}
 		}
-		if len(v) == 0 {
+
+		// Named versions (see nvm link)
+		links := node.GetLinked(env.Root)
+		for _, link := range links {
+			str := "    "
+			if inuse == link.Name {
+				str = "  * "
+			}
+			str = str + link.Name + " -> " + link.Target
+			if inuse == link.Name {
+				str = str + " (Currently using " + a.Label() + " executable)"
+			}
+			fmt.Println(str)
+		}
+
+		if len(v) == 0 && len(links) == 0 {
 			fmt.Println("No installations recognized.")
 		}
+		warnForeignNode(current)
 	} else {
-		_, lts, current, stable, unstable, _ := node.GetAvailable()
+		_, lts, current, stable, unstable, _, err := node.GetAvailable(mgr.Web, env.Root)
+		if err != nil {
+			fatal(err)
+		}
 
 		releases := 20
 
@@ -1389,9 +1425,163 @@ func list(listtype string) {
 	}
 }
 
+// An installation in the output of nvm list --json.
+type listEntry struct {
+	Version string `json:"version"`
+	Source  string `json:"source,omitempty"`
+	// Target is the directory of a named version (see nvm link).
+	Target string `json:"target,omitempty"`
+	Active bool   `json:"active"`
+	Arch   string `json:"arch,omitempty"`
+}
+
+func listJSON(listtype string) {
+	if listtype == "available" {
+		_, lts, current, stable, unstable, _, err := node.GetAvailable(mgr.Web, env.Root)
+		if err != nil {
+			fatal(err)
+		}
+		printJSON(map[string][]string{"current": current, "lts": lts, "stable": stable, "unstable": unstable})
+		return
+	}
+
+	current := activeNode()
+	entries := make([]listEntry, 0)
+	for _, version := range node.GetInstalled(env.Root) {
+		entry := listEntry{Version: strings.TrimPrefix(version, "v")}
+		entry.Source = node.GetSource(filepath.Join(env.Root, version)).Name
+		entry.Active = entry.Version == current.Version
+		entries = append(entries, entry)
+	}
+	for _, l := range node.GetLinked(env.Root) {
+		entries = append(entries, listEntry{Version: l.Name, Target: l.Target, Active: l.Name == current.Version})
+	}
+	for i := range entries {
+		if entries[i].Active {
+			entries[i].Arch = current.Arch.Bits()
+		}
+	}
+
+	printJSON(entries)
+}
+
+func diskUsage() {
+	asjson := inv.Has("json")
+
+	installations, err := du.Scan(env.Root)
+	if err != nil {
+		fmt.Printf("error measuring %v: %v\n", env.Root, err)
+		quit(exit.Code(err))
+	}
+
+	exe, _ := os.Executable()
+	tmp := os.TempDir()
+	corepack := os.Getenv("COREPACK_HOME")
+	if corepack == "" {
+		corepack = filepath.Join(os.Getenv("LOCALAPPDATA"), "node", "corepack")
+	}
+
+	other := make([]du.Entry, 0)
+	for _, item := range []struct {
+		name     string
+		patterns []string
+	}{
+		{"corepack cache", []string{corepack}},
+		// The cached version list and the npm downloads
+		{"nvm cache", []string{
+			filepath.Join(env.Root, node.LTSFile),
+			filepath.Join(env.Root, "temp"),
+		}},
+		{"temporary files", []string{
+			filepath.Join(env.Root, journal.Directory),
+			filepath.Join(env.Root, file.TrashDirectory),
+			filepath.Join(tmp, "nvm-install-*"),
+			filepath.Join(tmp, "nvm-npm-*"),
+			filepath.Join(tmp, "nvm-upgrade-*"),
+			filepath.Join(tmp, "nvm-backup-*"),
+			filepath.Join(tmp, "nvm4w-remove-*"),
+		}},
+		{"upgrade backups", []string{filepath.Join(filepath.Dir(exe), ".update")}},
+	} {
+		entry, err := du.Glob(item.name, item.patterns...)
+		if err != nil {
+			fmt.Printf("error measuring %v: %v\n", item.name, err)
+			quit(exit.Code(err))
+		}
+		other = append(other, entry)
+	}
+
+	report := du.NewReport(installations, other...)
+
+	if asjson {
+		printJSON(report)
+		return
+	}
+
+	fmt.Println("")
+	if len(report.Installations) == 0 {
+		fmt.Println("No installations recognized.")
+	} else {
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Version", "npm", "Globals", "Corepack", "Other", "Total"})
+		table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
+		table.SetAlignment(tablewriter.ALIGN_RIGHT)
+		table.SetCenterSeparator("|")
+		for _, i := range report.Installations {
+			table.Append([]string{i.Version, humanize.IBytes(uint64(i.Npm)), humanize.IBytes(uint64(i.Globals)), humanize.IBytes(uint64(i.Corepack)), humanize.IBytes(uint64(i.Other)), humanize.IBytes(uint64(i.Total))})
+		}
+		table.Render()
+	}
+
+	fmt.Println("")
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Location", "Size"})
+	table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
+	table.SetAlignment(tablewriter.ALIGN_RIGHT)
+	table.SetCenterSeparator("|")
+	for _, entry := range report.Other {
+		table.Append([]string{entry.Name, humanize.IBytes(uint64(entry.Size))})
+	}
+	table.Render()
+
+	fmt.Printf("\nTotal: %v\n", humanize.IBytes(uint64(report.Total)))
+}
+
+// Returns the shim directory (NVM_SYMLINK) in shim mode, or "".
+func shimDir() string {
+	if env.Activation != shim.Mode {
+		return ""
+	}
+	return env.Symlink
+}
+
+// Returns the globally active version: the target of NVM_SYMLINK or, in
+// shim mode, the default version (see manager.Active).
+func activeNode() node.Current {
+	if env.Activation != shim.Mode {
+		return node.GetCurrent(env.Root, env.Symlink)
+	}
+
+	current := node.Current{}
+	current.Version, current.Arch = mgr.Active()
+	if current.Version != "Unknown" {
+		current.Path = node.Dir(env.Root, current.Version)
+	}
+	current.DetectForeign(env.Symlink)
+
+	return current
+}
+
+// Warns when the node.exe resolved from the PATH is not managed by nvm.
+func warnForeignNode(current node.Current) {
+	if current.Foreign {
+		fmt.Printf("\nWARNING: %s precedes the NVM_SYMLINK (%s) in the PATH, so it runs instead of the active version.\nRun \"nvm debug\" for details.\n", current.ForeignPath, env.Symlink)
+	}
+}
+
 func enable() {
 	dir := ""
-	files, _ := ioutil.ReadDir(env.root)
+	files, _ := ioutil.ReadDir(env.Root)
 	for _, f := range files {
 		if f.IsDir() {
 			isnode, _ := regexp.MatchString("v", f.Name())
@@ -1402,21 +1592,15 @@ func enable() {
 	}
 	fmt.Println("nvm enabled")
 	if dir != "" {
-		use(strings.Trim(regexp.MustCompile("v").ReplaceAllString(dir, ""), " \n\r"), env.arch)
+		use(strings.Trim(regexp.MustCompile("v").ReplaceAllString(dir, ""), " \n\r"), "")
 	} else {
 		fmt.Println("No versions of node.js found. Try installing the latest by typing nvm install latest")
 	}
 }
 
 func disable() {
-	// ok, err := runElevated(fmt.Sprintf(`"%s" cmd /C rmdir "%s"`, filepath.Join(env.root, "elevate.cmd"), filepath.Clean(env.symlink)))
-	abortOnBadSymlink(env.symlink)
-	ok, err := elevatedRun("rmdir", filepath.Clean(env.symlink))
-	if !ok {
-		return
-	}
-	if err != nil {
-		fmt.Print(fmt.Sprint(err))
+	if err := mgr.Disable(); err != nil {
+		fatal(err)
 	}
 
 	fmt.Println("nvm disabled")
@@ -1442,7 +1626,7 @@ func checkLocalEnvironment() {
 
 	// Check for PATH problems
 	paths := strings.Split(os.Getenv("PATH"), ";")
-	current := env.symlink
+	current := env.Symlink
 	if strings.HasSuffix(current, "/") || strings.HasSuffix(current, "\\") {
 		current = current[:len(current)-1]
 	}
@@ -1468,23 +1652,19 @@ func checkLocalEnvironment() {
 
 	// Check for developer mode
 	devmode := "OFF"
-	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows\CurrentVersion\AppModelUnlock`, registry.QUERY_VALUE)
+	enabled, err := manager.DeveloperMode()
 	if err == nil {
-		value, _, err := k.GetIntegerValue("AllowDevelopmentWithoutDevLicense")
-		if err == nil {
-			if value > 0 {
-				devmode = "ON"
-			}
-		} else {
-			devmode = "UNKNOWN"
+		if enabled {
+			devmode = "ON"
 		}
+	} else if errors.Is(err, registry.ErrNotExist) {
+		devmode = "UNKNOWN"
 	} else {
 		devmode = "UNKNOWN (user cannot read registry)"
 	}
-	defer k.Close()
 
 	// Check for permission problems
-	admin, elevated, err := getProcessPermissions()
+	admin, elevated, err := manager.Permissions()
 	if err == nil {
 		if !admin && !elevated {
 			user, _ := user.Current()
@@ -1573,7 +1753,7 @@ func checkLocalEnvironment() {
 		out = string(output)
 	}
 
-	v := node.GetInstalled(env.root)
+	v := node.GetInstalled(env.Root)
 
 	// Make sure author-nvm.exe is available and runs
 	exe, _ := os.Executable()
@@ -1588,24 +1768,24 @@ func checkLocalEnvironment() {
 
 	nvmhome := os.Getenv("NVM_HOME")
 	mirrors := "No mirrors configured"
-	if len(env.node_mirror) > 0 && len(env.npm_mirror) > 0 {
-		mirrors = env.node_mirror + " (node) and " + env.npm_mirror + " (npm)"
-	} else if len(env.node_mirror) > 0 {
-		mirrors = env.node_mirror + " (node)"
-	} else if len(env.npm_mirror) > 0 {
-		mirrors = env.npm_mirror + " (npm)"
+	if len(env.NodeMirror) > 0 && len(env.NpmMirror) > 0 {
+		mirrors = env.NodeMirror + " (node) and " + env.NpmMirror + " (npm)"
+	} else if len(env.NodeMirror) > 0 {
+		mirrors = env.NodeMirror + " (node)"
+	} else if len(env.NpmMirror) > 0 {
+		mirrors = env.NpmMirror + " (npm)"
 	}
-	fmt.Printf("\nNVM4W Version:          %v\nNVM4W Author Bridge:    %v\nNVM4W Path:             %v\nNVM4W Settings:         %v\nNVM_HOME:               %v\nNVM_SYMLINK:            %v\nNode Installations:     %v\nDefault Architecture:   %v-bit\nMirrors:                %v\nHTTP Proxy:             %v\n\nTotal Node.js Versions: %v\nActive Node.js Version: %v", NvmVersion, authorNvmVersion, path, home, nvmhome, symlink, env.root, env.arch, mirrors, env.proxy, len(v), out)
+	fmt.Printf("\nNVM4W Version:          %v\nNVM4W Author Bridge:    %v\nNVM4W Path:             %v\nNVM4W Settings:         %v\nNVM_HOME:               %v\nNVM_SYMLINK:            %v\nNode Installations:     %v\nDefault Architecture:   %v\nMirrors:                %v\nHTTP Proxy:             %v\n\nTotal Node.js Versions: %v\nActive Node.js Version: %v", NvmVersion, authorNvmVersion, path, home, nvmhome, symlink, env.Root, env.Arch.Label(), mirrors, env.Proxy, len(v), out)
 
 	if !nvmsymlinkfound {
-		problems = append(problems, "The NVM4W symlink ("+env.symlink+") was not found in the PATH environment variable.")
+		problems = append(problems, "The NVM4W symlink ("+env.Symlink+") was not found in the PATH environment variable.")
 	}
 
 	if home == symlink {
 		problems = append(problems, "NVM_HOME and NVM_SYMLINK cannot be the same value ("+symlink+"). Change NVM_SYMLINK.")
 	}
 
-	fileInfo, err := os.Lstat(symlink)
+	_, err = os.Lstat(symlink)
 	if err != nil {
 		if os.IsNotExist(err) {
 			fmt.Println("NVM_SYMLINK does not exist yet. This is auto-created when \"nvm use\" is run.")
@@ -1613,8 +1793,9 @@ func checkLocalEnvironment() {
 			problems = append(problems, "Could not determine if NVM_SYMLINK is actually a symlink: "+err.Error())
 		}
 	} else {
-		if fileInfo.Mode()&os.ModeSymlink != 0 {
-			targetPath, err := os.Readlink(symlink)
+		if kind, err := link.Default.Type(symlink); err == nil {
+			fmt.Printf("NVM_SYMLINK is a %v (link_type: %v).\n", kind, env.LinkType)
+			targetPath, err := link.Default.Target(symlink)
 			if err != nil {
 				problems = append(problems, fmt.Sprintf("SYMLINK_READ Error: %v", err))
 			} else {
@@ -1625,8 +1806,13 @@ func checkLocalEnvironment() {
 					problems = append(problems, "NVM_SYMLINK is a symlink linking to a file instead of a directory.")
 				}
 			}
+		} else if shim.IsInstalled(symlink) {
+			fmt.Printf("NVM_SYMLINK contains the version shims (activation: %v, default version: %v).\n", env.Activation, env.DefaultVersion)
+			if env.Activation != shim.Mode {
+				problems = append(problems, "NVM_SYMLINK ("+symlink+") contains shims, but shim activation is off. Run \"nvm activation shim\" or \"nvm activation symlink\".")
+			}
 		} else {
-			problems = append(problems, "NVM_SYMLINK ("+symlink+") is not a valid symlink.")
+			problems = append(problems, "NVM_SYMLINK ("+symlink+") is not a valid symlink or junction.")
 		}
 	}
 
@@ -1641,13 +1827,13 @@ func checkLocalEnvironment() {
 		fmt.Println("\nIPv6 is enabled. This has been known to slow downloads significantly.")
 	}
 
-	nodelist := web.Ping(web.GetFullNodeUrl("index.json"))
+	nodelist := inv.Has("offline") || mgr.Web.Ping(mgr.Web.Source().IndexURL())
 	if !nodelist {
-		if len(env.node_mirror) > 0 && env.node_mirror != "none" {
-			problems = append(problems, "Connection to "+env.node_mirror+" (mirror) cannot be established. Check the mirror server to assure it is online.")
+		if len(env.NodeMirror) > 0 && env.NodeMirror != "none" {
+			problems = append(problems, "Connection to "+env.NodeMirror+" (mirror) cannot be established. Check the mirror server to assure it is online.")
 		} else {
-			if len(env.proxy) > 0 {
-				problems = append(problems, "Connection to nodejs.org cannot be established. Check your proxy ("+env.proxy+") and your physical internet connection.")
+			if len(env.Proxy) > 0 {
+				problems = append(problems, "Connection to nodejs.org cannot be established. Check your proxy ("+env.Proxy+") and your physical internet connection.")
 			} else {
 				problems = append(problems, "Connection to nodejs.org cannot be established. Check your internet connection.")
 			}
@@ -1657,9 +1843,9 @@ func checkLocalEnvironment() {
 	invalid := make([]string, 0)
 	invalidnpm := make([]string, 0)
 	for i := 0; i < len(v); i++ {
-		if _, err = os.Stat(filepath.Join(env.root, v[i], "node.exe")); err != nil {
+		if _, err = os.Stat(filepath.Join(env.Root, v[i], "node.exe")); err != nil {
 			invalid = append(invalid, v[i])
-		} else if _, err = os.Stat(filepath.Join(env.root, v[i], "npm.cmd")); err != nil {
+		} else if _, err = os.Stat(filepath.Join(env.Root, v[i], "npm.cmd")); err != nil {
 			fmt.Println(err)
 			invalidnpm = append(invalid, v[i])
 		}
@@ -1673,12 +1859,12 @@ func checkLocalEnvironment() {
 		fmt.Printf("\nWARNING: The following Node installations are missing npm: %v\n         (Node will still run, but npm will not work on these versions)\n", strings.Join(invalidnpm, ", "))
 	}
 
-	if len(env.npm_mirror) > 0 {
-		fmt.Println("If you are experiencing npm problems, check the npm mirror (" + env.npm_mirror + ") to assure it is online and accessible.")
+	if len(env.NpmMirror) > 0 {
+		fmt.Println("If you are experiencing npm problems, check the npm mirror (" + env.NpmMirror + ") to assure it is online and accessible.")
 	}
 
-	if _, err := os.Stat(env.settings); err != nil {
-		problems = append(problems, "Cannot find "+env.settings)
+	if _, err := os.Stat(env.File); err != nil {
+		problems = append(problems, "Cannot find "+env.File)
 	}
 
 	if len(problems) == 0 {
@@ -1691,6 +1877,10 @@ func checkLocalEnvironment() {
 	}
 
 	// Check for updates
+	if inv.Has("offline") {
+		fmt.Println("\n" + "Find help at https://github.com/coreybutler/nvm-windows/wiki/Common-Issues")
+		return
+	}
 	colorize := true
 	if err := upgrade.EnableVirtualTerminalProcessing(); err != nil {
 		colorize = false
@@ -1727,132 +1917,496 @@ func checkLocalEnvironment() {
 	fmt.Println("\n" + "Find help at https://github.com/coreybutler/nvm-windows/wiki/Common-Issues")
 }
 
+// The parsed command line (see main).
+var inv *cli.Invocation
+
+var app = &cli.App{
+	Name: "nvm",
+	Flags: []cli.Flag{
+		{Name: "help", Short: "h", Usage: "Show the help of a command."},
+		{Name: "verbose", Usage: "Print debugging output."},
+		{Name: "json", Usage: "Print the output as JSON (du, current, list and version)."},
+		{Name: "offline", Usage: "Never access the network. Commands that need to download fail instead."},
+		{Name: "yes", Short: "y", Usage: "Answer yes to confirmation prompts."},
+		{Name: "wait", Value: "seconds", Optional: true, Usage: "Wait for another nvm operation to finish instead of failing (see below)."},
+	},
+	Commands: []*cli.Command{
+		{
+			Name:    "activation",
+			Args:    "[mode]",
+			MaxArgs: 1,
+			Summary: []string{
+				"Set how versions are activated: symlink (default) points NVM_SYMLINK to the version,",
+				"shim places node, npm and npx shims in NVM_SYMLINK that run the version of the session,",
+				"the nearest .nvmrc file, or the default version set with nvm use.",
+			},
+			Complete: completeWords("symlink", shim.Mode),
+		},
+		{
+			Name:    "arch",
+			Args:    "[arch]",
+			MaxArgs: 1,
+			Summary: []string{
+				"Show if node is running in 32-bit, 64-bit or arm64 mode. Specify 32 (x86), 64 (x64), or arm64",
+				"to change the default architecture. arm64 computers can also run x64 under emulation.",
+			},
+			Complete: completeWords("32", "64", "arm64"),
+		},
+		{
+			Name:    "completion",
+			Args:    "<shell>",
+			MinArgs: 1,
+			MaxArgs: 1,
+			Summary: []string{
+				"Print a script that enables tab completion in pwsh, cmd (requires clink) or bash.",
+				"pwsh:  nvm completion pwsh | Out-String | Invoke-Expression (add it to your $PROFILE)",
+				"bash:  eval \"$(nvm completion bash)\" (add it to your ~/.bashrc)",
+				"cmd:   nvm completion cmd > <clink scripts directory>\\nvm.lua",
+			},
+			Complete: completeWords(string(shell.PowerShell), string(shell.Cmd), string(shell.Bash)),
+		},
+		{
+			Name:    "current",
+			MaxArgs: 0,
+			JSON:    true,
+			Summary: []string{"Display active version."},
+		},
+		{
+			Name:    "debug",
+			MaxArgs: 0,
+			Summary: []string{"Check the NVM4W process for known problems (troubleshooter)."},
+		},
+		{
+			Name:    "du",
+			MaxArgs: 0,
+			JSON:    true,
+			Summary: []string{"Show the disk space used by each installation, caches, and temporary files."},
+		},
+		{
+			Name:    "env",
+			Args:    "<version|off>",
+			MinArgs: 1,
+			MaxArgs: 1,
+			Summary: []string{"Print the statements that activate a version for the current shell session only."},
+			Flags: []cli.Flag{
+				{Name: "shell", Value: "shell", Usage: "The shell syntax: pwsh, cmd or bash (auto-detected by default).", Complete: shellNames},
+			},
+			Complete: completeInstalled("off"),
+		},
+		{
+			Name:         "exec",
+			Args:         "<version> <command...>",
+			MinArgs:      2,
+			MaxArgs:      -1,
+			Literal:      true,
+			LiteralAfter: 1,
+			Summary: []string{
+				"Run a command using the specified version without changing the active version.",
+				"Everything following the version is passed to the command.",
+			},
+			Complete: completeInstalled(),
+		},
+		{
+			Name:    "hook",
+			MaxArgs: 0,
+			Summary: []string{
+				"Print a shell hook that switches the session version to match the nearest .nvmrc",
+				"file whenever the directory changes.",
+			},
+			Flags: []cli.Flag{
+				{Name: "shell", Value: "shell", Usage: "The shell syntax: pwsh or bash (auto-detected by default).", Complete: shellNames},
+				{Name: "install", Usage: "Install missing versions automatically."},
+			},
+		},
+		{
+			Name:    "install",
+			Aliases: []string{"i"},
+			Args:    "<version> [arch]",
+			MaxArgs: 2,
+			Summary: []string{
+				"Install a version of node.js. The version can be a specific version, \"latest\" for the latest",
+				"current version, or \"lts\" for the most recent LTS version. Optionally specify whether to install",
+				"the 32 or 64 bit version (defaults to system arch). Set [arch] to \"all\" to install every",
+				"architecture this computer can run.",
+				"Packages listed in %NVM_HOME%\\default-packages are installed globally unless",
+				"--skip-default-packages is specified.",
+				"Use --from-file or --from-dir to install a distribution without downloading node. The version",
+				"and arch are detected automatically. Archives are verified against --checksums <file> or a",
+				"SHASUMS256.txt file next to them.",
+			},
+			Flags: []cli.Flag{
+				{Name: "insecure", Usage: "Bypass SSL validation of the remote download server."},
+				{Name: "source", Value: "name|url", Usage: "Install from another distribution (unofficial, nightly, rc or a source in sources.json).", Complete: sourceNames},
+				{Name: "reinstall-packages-from", Value: "version", Usage: "Reinstall the global npm packages of an installed version.", Complete: installedVersions},
+				{Name: "skip-default-packages", Usage: "Do not install the packages listed in default-packages."},
+				{Name: "from-file", Value: "zip", Usage: "Install a distribution archive (i.e. node-v20.11.1-win-x64.zip)."},
+				{Name: "from-dir", Value: "dir", Usage: "Install an extracted distribution directory."},
+				{Name: "checksums", Value: "file", Usage: "The SHASUMS256.txt file to verify --from-file archives against."},
+				{Name: "show-progress-ui", Usage: "Show the progress in a window."},
+			},
+			Complete: completeArch(true),
+		},
+		{
+			Name:    "link",
+			Args:    "[<name> <path>]",
+			MaxArgs: 2,
+			Summary: []string{
+				"Register an external node directory (i.e. a custom build) as a named version that can be",
+				"used like any installed version. nvm uninstall <name> only removes the link. Without",
+				"arguments, the named versions are listed.",
+			},
+		},
+		{
+			Name:    "link_type",
+			Args:    "[type]",
+			MaxArgs: 1,
+			Summary: []string{
+				"Set the kind of link nvm use creates: symlink, junction, or auto (default). Junctions",
+				"do not require elevation. auto uses symlinks when the user may create them.",
+			},
+			Complete: completeWords("auto", "symlink", "junction"),
+		},
+		{
+			Name:    "list",
+			Aliases: []string{"ls"},
+			Args:    "[installed|available]",
+			MaxArgs: 1,
+			JSON:    true,
+			Summary: []string{"List the node.js installations. Type \"available\" at the end to see what can be installed."},
+			Flags: []cli.Flag{
+				{Name: "source", Value: "name|url", Usage: "List the versions of another distribution.", Complete: sourceNames},
+			},
+			Complete: completeWords("installed", "available"),
+		},
+		{
+			Name:    "migrate-globals",
+			Args:    "<from> <to>",
+			MinArgs: 2,
+			MaxArgs: 2,
+			Summary: []string{"Reinstall the global npm packages of one installed version into another."},
+			Flags: []cli.Flag{
+				{Name: "dry-run", Usage: "List the packages without installing them."},
+			},
+			Complete: completeInstalled(),
+		},
+		{
+			Name:    "node_mirror",
+			Args:    "[url]",
+			MaxArgs: 1,
+			Summary: []string{"Set the node mirror. Defaults to https://nodejs.org/dist/. Leave [url] blank to use default url."},
+		},
+		{
+			Name:    "npm_mirror",
+			Args:    "[url]",
+			MaxArgs: 1,
+			Summary: []string{"Set the npm mirror. Defaults to https://github.com/npm/cli/archive/. Leave [url] blank to default url."},
+		},
+		{
+			Name:    "off",
+			MaxArgs: 0,
+			Summary: []string{"Disable node.js version management."},
+		},
+		{
+			Name:    "on",
+			MaxArgs: 0,
+			Summary: []string{"Enable node.js version management."},
+		},
+		{
+			Name:    "pack",
+			Args:    "<version...>",
+			MinArgs: 1,
+			MaxArgs: -1,
+			Summary: []string{"Write installed versions to an offline bundle."},
+			Flags: []cli.Flag{
+				{Name: "out", Value: "file", Usage: "The bundle to write (defaults to nvm-bundle.zip)."},
+			},
+			Complete: completeInstalled(),
+		},
+		{
+			Name:    "proxy",
+			Args:    "[url]",
+			MaxArgs: 1,
+			Summary: []string{
+				"Set a proxy to use for downloads. Leave [url] blank to see the current proxy.",
+				"Set [url] to \"none\" to remove the proxy.",
+			},
+		},
+		{
+			Name:    "reinstall",
+			Args:    "<version> [arch]",
+			MinArgs: 1,
+			MaxArgs: 2,
+			Summary: []string{"A shortcut method to clean and reinstall a specific version."},
+			Flags: []cli.Flag{
+				{Name: "insecure", Usage: "Bypass SSL validation of the remote download server."},
+				{Name: "source", Value: "name|url", Usage: "Install from another distribution.", Complete: sourceNames},
+			},
+			Complete: completeInstalled(),
+		},
+		{
+			Name:    "resolve",
+			MaxArgs: 0,
+			Summary: []string{"Display the installed version matching the nearest .nvmrc file (no network access)."},
+			Flags: []cli.Flag{
+				{Name: "shell", Value: "shell", Usage: "Print the statements that switch the session to the version instead.", Complete: shellNames},
+				{Name: "install", Usage: "Install the version when it is missing (with --shell)."},
+			},
+		},
+		{
+			Name:    "root",
+			Args:    "[path]",
+			MaxArgs: 1,
+			Summary: []string{
+				"Set the directory where nvm should store different versions of node.js.",
+				"If <path> is not set, the current root will be displayed.",
+			},
+		},
+		{
+			Name:         "run",
+			Args:         "<version> <script...>",
+			MinArgs:      2,
+			MaxArgs:      -1,
+			Literal:      true,
+			LiteralAfter: 1,
+			Summary:      []string{"Run a script with node using the specified version without changing the active version."},
+			Complete:     completeInstalled(),
+		},
+		{
+			Name:    "shell",
+			Args:    "<version>",
+			MinArgs: 1,
+			MaxArgs: 1,
+			Summary: []string{"Start a new shell that uses the specified version. Other shells are unaffected."},
+			Flags: []cli.Flag{
+				{Name: "shell", Value: "shell", Usage: "The shell to start: pwsh, cmd or bash (auto-detected by default).", Complete: shellNames},
+			},
+			Complete: completeInstalled(),
+		},
+		{
+			Name:     "subscribe",
+			Args:     "<topic...>",
+			MaxArgs:  -1,
+			Summary:  []string{"Subscribe to desktop notifications. Valid topics: lts, current, nvm4w, author"},
+			Flags:    topicFlags,
+			Complete: completeWords("lts", "current", "nvm4w", "author"),
+		},
+		{
+			Name:    "uninstall",
+			Aliases: []string{"rm"},
+			Args:    "<version...>",
+			MinArgs: 1,
+			MaxArgs: -1,
+			Summary: []string{
+				"Uninstall one or more versions. A partial version (18) or a range (\"<18\", \">=16 <18\")",
+				"lists the matching versions and asks for confirmation (skip with --yes).",
+				"Follow a version with an arch (nvm uninstall 20.11.0 32) to remove only that architecture.",
+			},
+			Flags: []cli.Flag{
+				{Name: "force", Usage: "Remove the active version and switch to the newest remaining one."},
+			},
+			Complete: completeInstalled(),
+		},
+		{
+			Name:    "unpack",
+			Args:    "<bundle>",
+			MinArgs: 1,
+			MaxArgs: 1,
+			Summary: []string{"Verify and install the versions of a bundle created by nvm pack."},
+		},
+		{
+			Name:     "unsubscribe",
+			Args:     "<topic...>",
+			MaxArgs:  -1,
+			Summary:  []string{"Unsubscribe from desktop notifications. Valid topics: lts, current, nvm4w, author"},
+			Flags:    topicFlags,
+			Complete: completeWords("lts", "current", "nvm4w", "author"),
+		},
+		{
+			Name:    "upgrade",
+			MaxArgs: 0,
+			Summary: []string{"Update nvm to the latest version. Manual rollback available for 7 days after upgrade."},
+			Flags: []cli.Flag{
+				{Name: "show-progress-ui", Usage: "Show the progress in a window."},
+			},
+		},
+		{
+			Name:    "use",
+			Aliases: []string{"u"},
+			Args:    "[version] [arch]",
+			MaxArgs: 2,
+			Summary: []string{
+				"Switch to use the specified version. Optionally use \"latest\", \"lts\", or \"newest\".",
+				"\"newest\" is the latest installed version. Optionally specify 32/64/arm64 architecture.",
+				"nvm use <arch> will continue using the selected version, but switch to another installed arch.",
+			},
+			Flags: []cli.Flag{
+				{Name: "session", Usage: "Activate the version for the current shell session only (see nvm env)."},
+				{Name: "shell", Value: "shell", Usage: "The shell syntax used with --session: pwsh, cmd or bash.", Complete: shellNames},
+				{Name: "notify", Usage: "Show the result as a desktop notification."},
+			},
+			Complete: completeArch(false),
+		},
+		{
+			Name:    "version",
+			Aliases: []string{"v", "--version", "-version", "--v", "-v"},
+			MaxArgs: 0,
+			JSON:    true,
+			Summary: []string{"Displays the current running version of nvm for Windows. Aliased as v."},
+		},
+		{
+			Name:         "author",
+			Hidden:       true,
+			MaxArgs:      -1,
+			Literal:      true,
+			LiteralAfter: 0,
+		},
+		{
+			Name:    shell.CompleteCommand,
+			Hidden:  true,
+			MinArgs: 1,
+			MaxArgs: -1,
+			Literal: true,
+			// The word being completed is always first
+			LiteralAfter: 0,
+		},
+	},
+}
+
+var topicFlags = []cli.Flag{
+	{Name: "lts", Usage: "New LTS releases."},
+	{Name: "current", Usage: "New current releases."},
+	{Name: "nvm4w", Usage: "New releases of nvm for Windows."},
+	{Name: "author", Usage: "News from the author."},
+}
+
 func help() {
 	fmt.Println("\nRunning version " + NvmVersion + ".")
-	fmt.Println("\nUsage:")
-	fmt.Println(" ")
-	fmt.Println("  nvm arch                     : Show if node is running in 32 or 64 bit mode.")
-	fmt.Println("  nvm current                  : Display active version.")
-	fmt.Println("  nvm debug                    : Check the NVM4W process for known problems (troubleshooter).")
-	fmt.Println("  nvm install <version> [arch] : The version can be a specific version, \"latest\" for the latest current version, or \"lts\" for the")
-	fmt.Println("                                 most recent LTS version. Optionally specify whether to install the 32 or 64 bit version (defaults")
-	fmt.Println("                                 to system arch). Set [arch] to \"all\" to install 32 AND 64 bit versions.")
-	fmt.Println("                                 Add --insecure to the end of this command to bypass SSL validation of the remote download server.")
-	fmt.Println("  nvm list [available]         : List the node.js installations. Type \"available\" at the end to see what can be installed. Aliased as ls.")
-	fmt.Println("  nvm on                       : Enable node.js version management.")
-	fmt.Println("  nvm off                      : Disable node.js version management.")
-	fmt.Println("  nvm proxy [url]              : Set a proxy to use for downloads. Leave [url] blank to see the current proxy.")
-	fmt.Println("                                 Set [url] to \"none\" to remove the proxy.")
-	fmt.Println("  nvm node_mirror [url]        : Set the node mirror. Defaults to https://nodejs.org/dist/. Leave [url] blank to use default url.")
-	fmt.Println("  nvm npm_mirror [url]         : Set the npm mirror. Defaults to https://github.com/npm/cli/archive/. Leave [url] blank to default url.")
-	fmt.Println("  nvm uninstall <version>      : The version must be a specific version.")
-	fmt.Println("  nvm upgrade                  : Update nvm to the latest version. Manual rollback available for 7 days after upgrade.")
-	fmt.Println("  nvm use [version] [arch]     : Switch to use the specified version. Optionally use \"latest\", \"lts\", or \"newest\".")
-	fmt.Println("                                 \"newest\" is the latest installed version. Optionally specify 32/64bit architecture.")
-	fmt.Println("                                 nvm use <arch> will continue using the selected version, but switch to 32/64 bit mode.")
-	fmt.Println("  nvm reinstall <version>      : A shortcut method to clean and reinstall a specific version.")
-	fmt.Println("  nvm root [path]              : Set the directory where nvm should store different versions of node.js.")
-	fmt.Println("                                 If <path> is not set, the current root will be displayed.")
-	fmt.Println("  nvm subscribe [--]<topic>    : Subscribe to desktop notifications.")
-	fmt.Println("                                 Valid topics: lts, current, nvm4w, author")
-	fmt.Println("  nvm unsubscribe [--]<topic>  : Unsubscribe from desktop notifications.")
-	fmt.Println("                                 Valid topics: lts, current, nvm4w, author")
-	fmt.Println("  nvm [--]version              : Displays the current running version of nvm for Windows. Aliased as v.")
+	fmt.Println("")
+	fmt.Print(app.Help())
+	fmt.Println("")
+	fmt.Println("Commands that change installations or settings run one at a time. Add --wait to wait for another nvm")
+	fmt.Println("operation to finish (or --wait=<seconds> to limit the wait) instead of failing.")
+	fmt.Println("")
+	fmt.Println("Exit codes: 0 success, 1 failure, 2 usage error, 3 network failure, 4 not found, 5 permission denied,")
+	fmt.Println("6 integrity failure, 7 partial success.")
 	fmt.Println(" ")
 }
 
-// ===============================================================
-// END | CLI functions
-// ===============================================================
+// Reports a command line that cannot be parsed and exits.
+func usageError(err error) {
+	fmt.Println(err)
 
-// ===============================================================
-// BEGIN | Utility functions
-// ===============================================================
-func checkVersionExceedsLatest(version string) bool {
-	//content := web.GetRemoteTextFile("http://nodejs.org/dist/latest/SHASUMS256.txt")
-	url := web.GetFullNodeUrl("latest/SHASUMS256.txt")
-	content, err := web.GetRemoteTextFile(url)
+	var usage *cli.UsageError
+	if errors.As(err, &usage) && usage.Command != nil {
+		fmt.Printf("Type \"nvm %s --help\" for help.\n", usage.Command.Name)
+	} else {
+		help()
+	}
+
+	quit(exit.Usage)
+}
+
+// Exits with code, releasing the inter-process lock first. Use it instead of
+// os.Exit, which skips deferred calls.
+func quit(code int) {
+	held.Exit(code)
+}
+
+// Prints an error and exits with the exit code of its kind (see exit.Code).
+func fatal(err error) {
+	fmt.Println(err)
+	quit(exit.Code(err))
+}
+
+// Prints a value as indented JSON (see --json).
+func printJSON(v interface{}) {
+	out, _ := json.MarshalIndent(v, "", "  ")
+	fmt.Println(string(out))
+}
+
+// Prints the script that enables tab completion in a shell.
+func completion(name string) {
+	sh, err := shell.Parse(name)
 	if err != nil {
 		fmt.Println(err)
-		os.Exit(1)
-	}
-	re := regexp.MustCompile("node-v(.+)+msi")
-	reg := regexp.MustCompile("node-v|-[xa].+")
-	latest := reg.ReplaceAllString(re.FindString(content), "")
-	var vArr = strings.Split(version, ".")
-	var lArr = strings.Split(latest, ".")
-	for index := range lArr {
-		lat, _ := strconv.Atoi(lArr[index])
-		ver, _ := strconv.Atoi(vArr[index])
-		//Should check for valid input (checking for conversion errors) but this tool is made to trust the user
-		if ver < lat {
-			return false
-		} else if ver > lat {
-			return true
-		}
+		quit(exit.Usage)
 	}
-	return false
+
+	exe, _ := os.Executable()
+	script, err := shell.Completion(sh, exe)
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Println(script)
 }
 
-func cleanVersion(version string) string {
-	re := regexp.MustCompile("\\d+.\\d+.\\d+")
-	matched := re.FindString(version)
+// Prints the completion candidates for the completion scripts, one per
+// line (see shell.CompleteCommand).
+func complete(args []string) {
+	// Installed versions are completed without recovering interrupted
+	// operations, so a failure to read the settings is not reported.
+	env.Load()
 
-	if len(matched) == 0 {
-		re = regexp.MustCompile("\\d+.\\d+")
-		matched = re.FindString(version)
-		if len(matched) == 0 {
-			matched = version + ".0.0"
-		} else {
-			matched = matched + ".0"
-		}
-		fmt.Println(matched)
+	current := strings.TrimPrefix(args[0], "=")
+	for _, candidate := range app.Complete(args[1:], current) {
+		fmt.Println(candidate)
 	}
-
-	return matched
 }
 
-// Given a node.js version, returns the associated npm version
-func getNpmVersion(nodeversion string) string {
-	_, _, _, _, _, npm := node.GetAvailable()
-	if len(npm) == 0 {
-		fmt.Println("Error looking up versions: Remote host returned no results. This usually indicates a problem with with Node.js web server. Please try again in a few minutes.")
-		os.Exit(0)
+func completeWords(words ...string) func([]string) []string {
+	return func([]string) []string {
+		return words
 	}
-	return npm[nodeversion]
 }
 
-func getLatest() string {
-	url := web.GetFullNodeUrl("latest/SHASUMS256.txt")
-	content, err := web.GetRemoteTextFile(url)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+// Completes installed versions, followed by the given words.
+func completeInstalled(words ...string) func([]string) []string {
+	return func([]string) []string {
+		return append(installedVersions(), words...)
 	}
-	re := regexp.MustCompile("node-v(.+)+msi")
-	reg := regexp.MustCompile("node-v|-[xa].+")
-	return reg.ReplaceAllString(re.FindString(content), "")
 }
 
-func getLTS() string {
-	// all, ltsList, current, stable, unstable, npm := node.GetAvailable()
-	// fmt.Println(all)
-	// fmt.Println(ltsList)
-	// fmt.Println(current)
-	// fmt.Println(stable)
-	// fmt.Println(unstable)
-	// fmt.Println(npm)
-	_, ltsList, _, _, _, _ := node.GetAvailable()
+// Completes a version (installed versions and, for installs, the aliases),
+// followed by an architecture.
+func completeArch(install bool) func([]string) []string {
+	return func(args []string) []string {
+		if len(args) == 1 {
+			if install {
+				return []string{"32", "64", "arm64", "all"}
+			}
+			return []string{"32", "64", "arm64"}
+		}
+		if install {
+			return []string{"latest", "lts"}
+		}
+		return append(installedVersions(), "latest", "lts", "newest")
+	}
+}
 
-	if len(ltsList) == 0 {
-		fmt.Println("Error looking up LTS version: Remote host returned no results. This usually indicates a problem with with Node.js web server. Please try again in a few minutes.")
-		os.Exit(0)
+func installedVersions() []string {
+	versions := make([]string, 0)
+	for _, v := range node.GetInstalled(env.Root) {
+		versions = append(versions, strings.TrimPrefix(v, "v"))
 	}
+	for _, l := range node.GetLinked(env.Root) {
+		versions = append(versions, l.Name)
+	}
+	return versions
+}
 
-	// ltsList has already been numerically sorted
-	return ltsList[0]
+var shellNames = cli.Words(string(shell.PowerShell), string(shell.Cmd), string(shell.Bash))
+
+func sourceNames() []string {
+	c := web.NewClient("", true)
+	c.LoadSources(filepath.Join(env.Home(), "sources.json"))
+	return c.Sources()
 }
 
+// ===============================================================
+// END | CLI functions
+// ===============================================================
+
 func updateRootDir(path string) {
 	_, err := os.Stat(path)
 	if err != nil {
@@ -1860,118 +2414,56 @@ func updateRootDir(path string) {
 		return
 	}
 
-	currentRoot := env.root
-	env.root = filepath.Clean(path)
+	currentRoot := env.Root
+	env.Root = filepath.Clean(path)
 
 	// Copy command files
-	os.Link(filepath.Clean(currentRoot+"/elevate.cmd"), filepath.Clean(env.root+"/elevate.cmd"))
-	os.Link(filepath.Clean(currentRoot+"/elevate.vbs"), filepath.Clean(env.root+"/elevate.vbs"))
+	os.Link(filepath.Clean(currentRoot+"/elevate.cmd"), filepath.Clean(env.Root+"/elevate.cmd"))
+	os.Link(filepath.Clean(currentRoot+"/elevate.vbs"), filepath.Clean(env.Root+"/elevate.vbs"))
 
 	saveSettings()
 
-	if currentRoot != env.root {
+	if currentRoot != env.Root {
 		fmt.Println("\nRoot has been changed from " + currentRoot + " to " + path)
 	}
 }
 
-func elevatedRun(name string, arg ...string) (bool, error) {
-	ok, err := run("cmd", nil, append([]string{"/C", name}, arg...)...)
-	if err != nil {
-		exe, _ := os.Executable()
-		cmd := filepath.Join(filepath.Dir(exe), "elevate.cmd")
-		ok, err = run(cmd, &env.root, append([]string{"cmd", "/C", name}, arg...)...)
+// Switches between symlink and shim activation, keeping the active version.
+func setActivation(mode string) {
+	if strings.ToLower(mode) == env.Activation {
+		fmt.Println("Activation is already set to " + env.Activation + ".")
+		return
 	}
 
-	return ok, err
-}
-
-func run(name string, dir *string, arg ...string) (bool, error) {
-	c := exec.Command(name, arg...)
-	if dir != nil {
-		c.Dir = *dir
-	}
-	var stderr bytes.Buffer
-	c.Stderr = &stderr
-	err := c.Run()
+	result, err := mgr.SetActivation(mode)
 	if err != nil {
-		return false, errors.New(fmt.Sprint(err) + ": " + stderr.String())
+		fatal(err)
 	}
 
-	return true, nil
-}
-
-func runElevated(command string, forceUAC ...bool) (bool, error) {
-	uac := true //false
-	if len(forceUAC) > 0 {
-		uac = forceUAC[0]
+	if env.Activation == shim.Mode {
+		fmt.Printf("Shim activation enabled. node, npm and npx in %s now run the version of the\nsession (nvm env), the nearest .nvmrc file, or the default version (nvm use).\n", env.Symlink)
+		return
 	}
 
-	if uac {
-		// Alternative elevation option at stackoverflow.com/questions/31558066/how-to-ask-for-administer-privileges-on-windows-with-go
-		cmd := exec.Command(filepath.Join(env.root, "elevate.cmd"), command)
-
-		var output bytes.Buffer
-		var _stderr bytes.Buffer
-		cmd.Stdout = &output
-		cmd.Stderr = &_stderr
-		perr := cmd.Run()
-		if perr != nil {
-			return false, errors.New(fmt.Sprint(perr) + ": " + _stderr.String())
-		}
+	fmt.Println("Symlink activation enabled.")
+	if result != nil {
+		fmt.Printf("Now using node v%s (%v)\n", result.Version, result.Arch.Label())
 	}
+}
 
-	c := exec.Command("cmd") // dummy executable that actually needs to exist but we'll overwrite using .SysProcAttr
-
-	// Based on the official docs, syscall.SysProcAttr.CmdLine doesn't exist.
-	// But it does and is vital:
-	// https://github.com/golang/go/issues/15566#issuecomment-333274825
-	// https://medium.com/@felixge/killing-a-child-process-and-all-of-its-children-in-go-54079af94773
-	c.SysProcAttr = &syscall.SysProcAttr{CmdLine: command}
-
-	var stderr bytes.Buffer
-	c.Stderr = &stderr
-
-	err := c.Run()
-	if err != nil {
-		msg := stderr.String()
-		if strings.Contains(msg, "not have sufficient privilege") && uac {
-			return runElevated(command, false)
-		}
-		// fmt.Println(fmt.Sprint(err) + ": " + stderr.String())
-		return false, errors.New(fmt.Sprint(err) + ": " + msg)
+func linkKindLabel(kind link.Kind) string {
+	if kind == link.Auto {
+		return "symlink (or a junction when symlinks are not allowed)"
 	}
-
-	return true, nil
+	return kind.String()
 }
 
 func saveSettings() {
-	content := "root: " + strings.Trim(encode(env.root), " \n\r") + "\r\narch: " + strings.Trim(encode(env.arch), " \n\r") + "\r\nproxy: " + strings.Trim(encode(env.proxy), " \n\r") + "\r\noriginalpath: " + strings.Trim(encode(env.originalpath), " \n\r") + "\r\noriginalversion: " + strings.Trim(encode(env.originalversion), " \n\r")
-	content = content + "\r\nnode_mirror: " + strings.Trim(encode(env.node_mirror), " \n\r") + "\r\nnpm_mirror: " + strings.Trim(encode(env.npm_mirror), " \n\r")
-	ioutil.WriteFile(env.settings, []byte(content), 0644)
-	os.Setenv("NVM_HOME", strings.Trim(encode(env.root), " \n\r"))
-}
-
-func getProcessPermissions() (admin bool, elevated bool, err error) {
-	admin = false
-	elevated = false
-	var sid *windows.SID
-	err = windows.AllocateAndInitializeSid(
-		&windows.SECURITY_NT_AUTHORITY,
-		2,
-		windows.SECURITY_BUILTIN_DOMAIN_RID,
-		windows.DOMAIN_ALIAS_RID_ADMINS,
-		0, 0, 0, 0, 0, 0,
-		&sid)
-	if err != nil {
-		return
+	if err := env.Save(); err != nil {
+		fmt.Printf("failed to save the settings to %s: %v\n", env.File, err)
+		quit(exit.Code(err))
 	}
-	defer windows.FreeSid(sid)
-
-	token := windows.Token(0)
-	elevated = token.IsElevated()
-	admin, err = token.IsMember(sid)
-
-	return
+	os.Setenv("NVM_HOME", strings.Trim(encode(env.Root), " \n\r"))
 }
 
 func encode(val string) string {
@@ -1989,63 +2481,108 @@ func encode(val string) string {
 // ===============================================================
 
 func setup() {
-	lines, err := file.ReadLines(env.settings)
-	if err != nil {
+	if err := env.Load(); err != nil {
 		fmt.Println("\nERROR", err)
-		os.Exit(1)
+		quit(exit.Code(err))
+	}
+	for _, warning := range env.Warnings {
+		fmt.Println(warning)
 	}
 
-	// Process each line and extract the value
-	m := make(map[string]string)
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		line = os.ExpandEnv(line)
-		res := strings.Split(line, ":")
-		if len(res) < 2 {
-			continue
+	mgr = manager.New(env, report)
+	exe, _ := os.Executable()
+	mgr.Bin = filepath.Dir(exe)
+	mgr.Web.SetOffline(inv.Has("offline"))
+
+	// Custom distribution sources, selected with --source <name>
+	if name := inv.Value("source"); name != "" {
+		if err := mgr.SetSource(name); err != nil {
+			fatal(err)
 		}
-		m[res[0]] = strings.TrimSpace(strings.Join(res[1:], ":"))
 	}
 
-	if val, ok := m["root"]; ok {
-		env.root = filepath.Clean(val)
-	}
-	if val, ok := m["originalpath"]; ok {
-		env.originalpath = filepath.Clean(val)
+	// Make sure the directories exist
+	_, e := os.Stat(env.Root)
+	if e != nil {
+		fmt.Println(env.Root + " could not be found or does not exist. Exiting.")
+		return
 	}
-	if val, ok := m["originalversion"]; ok {
-		env.originalversion = val
+
+	// Commands that change installations finish or discard interrupted
+	// operations first. Other commands (i.e. resolve in the prompt hook)
+	// neither take the lock nor touch the journal and trash.
+	if held != nil {
+		recoverInstallations()
 	}
-	if val, ok := m["arch"]; ok {
-		env.arch = val
+}
+
+// The inter-process lock held by this process, if any.
+var held *lock.Lock
+
+func lockPath() string {
+	return filepath.Join(filepath.Dir(env.File), lock.File)
+}
+
+// Reports whether a command changes installations, NVM_SYMLINK or the
+// settings. These commands run one at a time.
+func mutates(command string, args []string) bool {
+	switch command {
+	case "install", "uninstall", "reinstall", "unpack", "migrate-globals", "on", "off", "node_mirror", "npm_mirror", "upgrade":
+		return true
+	case "use":
+		return !inv.Has("session")
+	case "arch", "proxy", "root", "link", "link_type", "activation":
+		// Without a value, these only display the setting
+		return len(args) > 0
 	}
-	if val, ok := m["node_mirror"]; ok {
-		env.node_mirror = val
+
+	return false
+}
+
+// Takes the inter-process lock for an operation, exiting when another
+// process holds it. --wait waits until the other operation finishes and
+// --wait=<seconds> waits up to the given time.
+func acquireLock(operation string) {
+	timeout := time.Duration(0)
+	if value := inv.Value("wait"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			fmt.Printf("\"%s\" is not a valid --wait value. Provide the number of seconds to wait.\n", value)
+			quit(exit.Usage)
+		}
+		timeout = time.Duration(seconds) * time.Second
+	} else if inv.Has("wait") {
+		timeout = lock.Forever
 	}
-	if val, ok := m["npm_mirror"]; ok {
-		env.npm_mirror = val
+
+	l, err := lock.Acquire(lockPath(), operation, 0)
+	if errors.Is(err, lock.ErrBusy) && timeout != 0 {
+		fmt.Printf("%v. Waiting for it to finish...\n", err)
+		l, err = lock.Acquire(lockPath(), operation, timeout)
 	}
 
-	if val, ok := m["proxy"]; ok {
-		if val != "none" && val != "" {
-			if strings.ToLower(val[0:4]) != "http" {
-				val = "http://" + val
-			}
-			res, err := url.Parse(val)
-			if err == nil {
-				web.SetProxy(res.String(), env.verifyssl)
-				env.proxy = res.String()
-			}
+	if err != nil {
+		fmt.Println(err)
+		if errors.Is(err, lock.ErrBusy) && timeout == 0 {
+			fmt.Println("Try again when it has finished, or add --wait to wait for it.")
 		}
+		quit(exit.Code(err))
 	}
 
-	web.SetMirrors(env.node_mirror, env.npm_mirror)
-	env.arch = arch.Validate(env.arch)
+	held = l
+}
 
-	// Make sure the directories exist
-	_, e := os.Stat(env.root)
-	if e != nil {
-		fmt.Println(env.root + " could not be found or does not exist. Exiting.")
-		return
+// Completes or cleans up installations interrupted by a crash or by closing
+// the console (see manager.Recover).
+func recoverInstallations() {
+	for _, r := range mgr.Recover() {
+		if r.Err != nil {
+			fmt.Printf("Failed to recover the interrupted installation of node v%s: %v\n", r.Version, r.Err)
+			writeToErrorLog(r.Err)
+		} else if r.Resumed {
+			fmt.Printf("Completed the interrupted installation of node v%s.\n", r.Version)
+		} else {
+			utility.DebugLogf("removed the interrupted installation of node v%s", r.Version)
+		}
 	}
 }
@@ -0,0 +1,78 @@
+package nvmrc
+
+import (
+	"errors"
+	"nvm/exit"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Files recognized as project version files, in order of precedence.
+var Files = []string{".nvmrc", ".node-version"}
+
+var ErrNotFound = exit.New(exit.ErrNotFound, "no .nvmrc file found")
+
+// Find returns the path of the nearest project version file, starting in
+// dir and walking up through each parent directory.
+func Find(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		for _, name := range Files {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path, nil
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ErrNotFound
+		}
+		dir = parent
+	}
+}
+
+// Read returns the version specified in a project version file. The first
+// line that is not blank or a comment is used, without a "v" prefix.
+func Read(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if len(line) > 1 && (line[0] == 'v' || line[0] == 'V') && line[1] >= '0' && line[1] <= '9' {
+			line = line[1:]
+		}
+
+		return line, nil
+	}
+
+	return "", errors.New(path + " does not specify a version")
+}
+
+// Lookup finds and reads the nearest project version file, returning the
+// version specification and the file it was read from.
+func Lookup(dir string) (string, string, error) {
+	path, err := Find(dir)
+	if err != nil {
+		return "", "", err
+	}
+
+	spec, err := Read(path)
+	return spec, path, err
+}
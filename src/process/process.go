@@ -0,0 +1,15 @@
+// Package process inspects other processes, i.e. the owners of locks and
+// install journals.
+package process
+
+// Alive reports whether the process that started at start (see StartTime)
+// is still running, so a PID reused by another process is not mistaken for
+// it. An unknown start time (0) only checks the PID.
+func Alive(pid int, start int64) bool {
+	if !Running(pid) {
+		return false
+	}
+
+	current := StartTime(pid)
+	return start == 0 || current == 0 || current == start
+}
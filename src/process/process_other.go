@@ -0,0 +1,51 @@
+//go:build !windows
+
+package process
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Running reports whether a process is still alive.
+func Running(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+
+	return syscall.Kill(pid, 0) == nil
+}
+
+// StartTime returns the start time of a process in clock ticks since boot,
+// or 0 when it cannot be determined.
+func StartTime(pid int) int64 {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0
+	}
+
+	// The command name may contain spaces, so the fields are counted from
+	// its closing parenthesis. The start time is the 22nd field.
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+	if len(fields) < 20 {
+		return 0
+	}
+
+	start, _ := strconv.ParseInt(fields[19], 10, 64)
+	return start
+}
+
+// ParentName returns the name of the parent process, or "" when it cannot
+// be determined.
+func ParentName() string {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", os.Getppid()))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,74 @@
+package process
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// STILL_ACTIVE is the exit code reported for a process that has not exited.
+const stillActive = 259
+
+// Running reports whether a process is still alive.
+func Running(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		// The process exists, but belongs to another user
+		return err == windows.ERROR_ACCESS_DENIED
+	}
+	defer windows.CloseHandle(h)
+
+	var code uint32
+	if err := windows.GetExitCodeProcess(h, &code); err != nil {
+		return false
+	}
+
+	return code == stillActive
+}
+
+// StartTime returns the creation time of a process in nanoseconds, or 0
+// when it cannot be determined.
+func StartTime(pid int) int64 {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return 0
+	}
+	defer windows.CloseHandle(h)
+
+	var creation, exit, kernel, user windows.Filetime
+	if err := windows.GetProcessTimes(h, &creation, &exit, &kernel, &user); err != nil {
+		return 0
+	}
+
+	return creation.Nanoseconds()
+}
+
+// ParentName returns the image name (i.e. "pwsh.exe") of the parent
+// process, or "" when it cannot be determined.
+func ParentName() string {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return ""
+	}
+	defer windows.CloseHandle(snapshot)
+
+	names := make(map[uint32]string)
+	parent := uint32(0)
+	pid := windows.GetCurrentProcessId()
+
+	var entry windows.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	for err = windows.Process32First(snapshot, &entry); err == nil; err = windows.Process32Next(snapshot, &entry) {
+		names[entry.ProcessID] = windows.UTF16ToString(entry.ExeFile[:])
+		if entry.ProcessID == pid {
+			parent = entry.ParentProcessID
+		}
+	}
+
+	// Empty when the parent has exited
+	return names[parent]
+}
@@ -0,0 +1,273 @@
+package shell
+
+import (
+	"fmt"
+	"nvm/process"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SessionVariable holds the version activated for the current session.
+const SessionVariable = "NVM_SESSION_VERSION"
+
+// Shell identifies the syntax used to modify the environment of a session.
+type Shell string
+
+const (
+	PowerShell Shell = "pwsh"
+	Cmd        Shell = "cmd"
+	Bash       Shell = "bash"
+)
+
+// Parse converts a shell name into a Shell.
+func Parse(name string) (Shell, error) {
+	switch strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), ".exe")) {
+	case "pwsh", "powershell", "ps":
+		return PowerShell, nil
+	case "cmd", "command", "clink":
+		return Cmd, nil
+	case "bash", "sh", "gitbash", "git-bash", "msys", "msys2", "mingw", "cygwin", "zsh":
+		return Bash, nil
+	}
+
+	return "", fmt.Errorf("\"%s\" is not a supported shell. Use pwsh, cmd, or bash.", name)
+}
+
+// Detect makes a best guess at the shell the process was launched from.
+func Detect() Shell {
+	return detect(process.ParentName(), os.Getenv)
+}
+
+// detect prefers the parent process, as environment variables are
+// inherited by nested shells (i.e. pwsh started from cmd.exe still has
+// PROMPT). When nvm is not run directly by a shell, MSYS/Git Bash are
+// recognized by MSYSTEM or SHELL, PowerShell by the user module directory
+// it adds to PSModulePath, and cmd.exe by PROMPT. Anything else is assumed
+// to be PowerShell.
+func detect(parent string, getenv func(string) string) Shell {
+	if sh, err := Parse(strings.ToLower(filepath.Base(parent))); err == nil {
+		return sh
+	}
+
+	if getenv("MSYSTEM") != "" || getenv("SHELL") != "" {
+		return Bash
+	}
+
+	if profile := getenv("USERPROFILE"); profile != "" {
+		for _, dir := range filepath.SplitList(getenv("PSModulePath")) {
+			if strings.HasPrefix(strings.ToLower(dir), strings.ToLower(profile)+string(filepath.Separator)) {
+				return PowerShell
+			}
+		}
+	}
+
+	if getenv("PROMPT") != "" {
+		return Cmd
+	}
+
+	return PowerShell
+}
+
+// Executable returns the program used to launch an interactive session.
+func (s Shell) Executable() string {
+	switch s {
+	case Cmd:
+		if comspec := os.Getenv("COMSPEC"); comspec != "" {
+			return comspec
+		}
+		return "cmd.exe"
+	case Bash:
+		if sh := os.Getenv("SHELL"); sh != "" {
+			return sh
+		}
+		return "bash.exe"
+	}
+
+	return "pwsh.exe"
+}
+
+// Script generates the statements that apply the environment variables to
+// the current session. Variables with an empty value are removed.
+func Script(s Shell, vars map[string]string) string {
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := vars[key]
+
+		switch s {
+		case PowerShell:
+			if value == "" {
+				lines = append(lines, fmt.Sprintf("Remove-Item Env:%s -ErrorAction SilentlyContinue", key))
+			} else {
+				lines = append(lines, fmt.Sprintf("$env:%s = '%s'", key, strings.ReplaceAll(value, "'", "''")))
+			}
+		case Cmd:
+			lines = append(lines, fmt.Sprintf("set \"%s=%s\"", key, value))
+		case Bash:
+			if value == "" {
+				lines = append(lines, "unset "+key)
+			} else {
+				if strings.EqualFold(key, "PATH") {
+					value = PosixPathList(value)
+				}
+				lines = append(lines, fmt.Sprintf("export %s='%s'", key, strings.ReplaceAll(value, "'", `'\''`)))
+			}
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Filter removes every entry of a PATH list for which the exclude
+// function returns true.
+func Filter(path string, exclude func(entry string) bool) string {
+	entries := make([]string, 0)
+	for _, entry := range strings.Split(path, string(os.PathListSeparator)) {
+		if len(strings.TrimSpace(entry)) == 0 || exclude(entry) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	return strings.Join(entries, string(os.PathListSeparator))
+}
+
+// PosixPathList converts a Windows PATH list (C:\a;D:\b) into the MSYS/Git
+// Bash format (/c/a:/d/b).
+func PosixPathList(path string) string {
+	entries := strings.Split(path, ";")
+	for i, entry := range entries {
+		entries[i] = PosixPath(entry)
+	}
+
+	return strings.Join(entries, ":")
+}
+
+// PosixPath converts a Windows path (C:\a) into the MSYS/Git Bash format (/c/a).
+func PosixPath(path string) string {
+	if volume := filepath.VolumeName(path); len(volume) == 2 && volume[1] == ':' {
+		path = "/" + strings.ToLower(volume[:1]) + path[2:]
+	}
+
+	return strings.ReplaceAll(path, "\\", "/")
+}
+
+// RCVariable holds the project version file that activated the session
+// version, so the automatic hook knows when it is responsible for it.
+const RCVariable = "NVM_SESSION_RC"
+
+// Hook returns a script that runs the resolve command whenever the working
+// directory changes, applying its output to the session. Only PowerShell
+// and Bash (Git Bash/MSYS) support prompt hooks.
+func Hook(s Shell, nvm string, args ...string) (string, error) {
+	switch s {
+	case PowerShell:
+		command := "& '" + strings.ReplaceAll(nvm, "'", "''") + "' resolve --shell pwsh"
+		if len(args) > 0 {
+			command += " " + strings.Join(args, " ")
+		}
+
+		return `if (-not $global:__nvm_original_prompt) {
+  $global:__nvm_original_prompt = $function:prompt
+}
+function global:prompt {
+  if ($global:__nvm_last_dir -ne $PWD.ProviderPath) {
+    $global:__nvm_last_dir = $PWD.ProviderPath
+    $__nvm_script = (` + command + `) | Out-String
+    if ($__nvm_script.Trim()) {
+      Invoke-Expression $__nvm_script
+    }
+  }
+  & $global:__nvm_original_prompt
+}`, nil
+	case Bash:
+		command := "'" + strings.ReplaceAll(PosixPath(nvm), "'", `'\''`) + "' resolve --shell bash"
+		if len(args) > 0 {
+			command += " " + strings.Join(args, " ")
+		}
+
+		return `__nvm_hook() {
+  if [ "$__NVM_LAST_DIR" != "$PWD" ]; then
+    __NVM_LAST_DIR="$PWD"
+    eval "$(` + command + `)"
+  fi
+}
+case ";${PROMPT_COMMAND};" in
+  *";__nvm_hook;"*) ;;
+  *) PROMPT_COMMAND="__nvm_hook${PROMPT_COMMAND:+;$PROMPT_COMMAND}" ;;
+esac`, nil
+	}
+
+	return "", fmt.Errorf("automatic version switching is not supported in %s. Use pwsh or bash.", s)
+}
+
+// CompleteCommand is the hidden command the completion scripts run. Its
+// first argument is the word being completed prefixed with "=" (so it is
+// never empty), followed by the words before it.
+const CompleteCommand = "__complete"
+
+// Completion returns a script that registers tab completion for nvm. The
+// candidates are produced by nvm itself (see CompleteCommand). The cmd
+// script requires clink (https://chrisant996.github.io/clink/).
+func Completion(s Shell, nvm string) (string, error) {
+	switch s {
+	case PowerShell:
+		return `Register-ArgumentCompleter -Native -CommandName nvm, nvm.exe -ScriptBlock {
+  param($wordToComplete, $commandAst, $cursorPosition)
+  $words = @($commandAst.CommandElements | Select-Object -Skip 1 | ForEach-Object { $_.ToString() })
+  if ($wordToComplete -and $words.Count -gt 0) {
+    $words = @($words | Select-Object -SkipLast 1)
+  }
+  & '` + strings.ReplaceAll(nvm, "'", "''") + `' ` + CompleteCommand + ` "=$wordToComplete" @words 2>$null | ForEach-Object {
+    [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+  }
+}`, nil
+	case Cmd:
+		return `-- nvm completion for clink. Save as nvm.lua in a clink scripts directory
+-- (see "clink info").
+local nvm = ` + luaString(nvm) + `
+local generator = clink.generator(10)
+
+function generator:generate(line_state, match_builder)
+  if path.getbasename(line_state:getword(1)):lower() ~= "nvm" then
+    return false
+  end
+
+  local command = '2>nul "' .. nvm .. '" ` + CompleteCommand + ` "=' .. line_state:getendword() .. '"'
+  for i = 2, line_state:getwordcount() - 1 do
+    command = command .. ' "' .. line_state:getword(i) .. '"'
+  end
+
+  local output = io.popen(command)
+  if not output then
+    return false
+  end
+  for line in output:lines() do
+    match_builder:addmatch(line)
+  end
+  output:close()
+
+  return true
+end`, nil
+	case Bash:
+		return `__nvm_complete() {
+  local IFS=$'\n'
+  COMPREPLY=($('` + strings.ReplaceAll(PosixPath(nvm), "'", `'\''`) + `' ` + CompleteCommand + ` "=${COMP_WORDS[COMP_CWORD]}" "${COMP_WORDS[@]:1:COMP_CWORD-1}" 2>/dev/null | tr -d '\r'))
+}
+complete -o default -F __nvm_complete nvm nvm.exe`, nil
+	}
+
+	return "", fmt.Errorf("completion is not supported in %s. Use pwsh, cmd, or bash.", s)
+}
+
+// Quotes a string for a lua script.
+func luaString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,42 @@
+package shell
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	profile := filepath.Join(t.TempDir(), "user")
+	system := filepath.Join(t.TempDir(), "WindowsPowerShell", "Modules")
+	user := filepath.Join(profile, "Documents", "PowerShell", "Modules")
+	modules := func(dirs ...string) string {
+		return strings.Join(dirs, string(filepath.ListSeparator))
+	}
+
+	tests := []struct {
+		name   string
+		parent string
+		env    map[string]string
+		want   Shell
+	}{
+		{"pwsh started from cmd", "pwsh.exe", map[string]string{"PROMPT": "$P$G"}, PowerShell},
+		{"cmd started from pwsh", "cmd.exe", map[string]string{"PROMPT": "$P$G", "USERPROFILE": profile, "PSModulePath": modules(user, system)}, Cmd},
+		{"windows powershell", "PowerShell.EXE", nil, PowerShell},
+		{"git bash started from cmd", "bash.exe", map[string]string{"PROMPT": "$P$G"}, Bash},
+		{"parent path", filepath.Join("C:", "Windows", "System32", "cmd.exe"), nil, Cmd},
+		{"unknown parent in msys", "node.exe", map[string]string{"MSYSTEM": "MINGW64", "PROMPT": "$P$G"}, Bash},
+		{"unknown parent below pwsh", "node.exe", map[string]string{"PROMPT": "$P$G", "USERPROFILE": profile, "PSModulePath": modules(user, system)}, PowerShell},
+		{"unknown parent below cmd", "node.exe", map[string]string{"PROMPT": "$P$G", "USERPROFILE": profile, "PSModulePath": system}, Cmd},
+		{"no information", "", nil, PowerShell},
+	}
+
+	for _, test := range tests {
+		getenv := func(key string) string {
+			return test.env[key]
+		}
+		if got := detect(test.parent, getenv); got != test.want {
+			t.Errorf("%s: detected %s, want %s", test.name, got, test.want)
+		}
+	}
+}
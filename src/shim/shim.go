@@ -0,0 +1,332 @@
+package shim
+
+import (
+	"errors"
+	"fmt"
+	"nvm/exit"
+	"nvm/file"
+	"nvm/node"
+	"nvm/nvmrc"
+	"nvm/shell"
+	"nvm/utility"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Shim activation replaces the NVM_SYMLINK with a directory of launchers.
+// Every invocation resolves the version to run (see Resolve) and runs the
+// real executable of that version, so terminals and projects can use
+// different versions without changing a link or requiring elevation:
+//
+//	node.exe      a copy of nvm-shim.exe
+//	nvm-shim.exe
+//	npm.cmd       "%~dp0nvm-shim.exe" npm %*
+//	npx.cmd       "%~dp0nvm-shim.exe" npx %*
+//	tsc.cmd       "%~dp0nvm-shim.exe" tsc %* (one per global package executable)
+//	.nvm-shims    marks the directory as managed by nvm and lists the
+//	              launchers of global package executables
+//
+// Global npm packages install their executables into the version directory
+// (i.e. v20.11.1\tsc.cmd), which is not on the PATH in shim mode. Refresh
+// writes a launcher for each of them, which runs the executable of the
+// resolved version.
+const Mode = "shim"
+
+// Executable is the shim binary, distributed next to nvm.exe.
+const Executable = "nvm-shim.exe"
+
+const marker = ".nvm-shims"
+
+var scripts = map[string]string{
+	"npm.cmd": "@echo off\r\n\"%~dp0" + Executable + "\" npm %*\r\n",
+	"npx.cmd": "@echo off\r\n\"%~dp0" + Executable + "\" npx %*\r\n",
+}
+
+// Where a resolved version was selected.
+const (
+	FromSession = "session"
+	FromProject = "project"
+	FromDefault = "default"
+)
+
+var ErrNoVersion = errors.New("no node version is selected. Run \"nvm use <version>\" to select the default version")
+
+// Resolution is the installed version a shim runs.
+type Resolution struct {
+	Version string
+	Dir     string
+	From    string
+	// File is the project version file the version was read from.
+	File string
+}
+
+// NotInstalledError is returned when the project version file requires a
+// version that is not installed.
+type NotInstalledError struct {
+	Spec string
+	File string
+}
+
+func (e *NotInstalledError) Error() string {
+	return fmt.Sprintf("%s requires node %s, which is not installed. Run \"nvm install %s\" to install it.", e.File, e.Spec, e.Spec)
+}
+
+func (e *NotInstalledError) Is(target error) bool {
+	return target == exit.ErrNotFound
+}
+
+// Resolve selects the version to run in cwd: the version activated for the
+// session (nvm env), then the nearest .nvmrc file, then the default version.
+// It never accesses the network or spawns node.
+func Resolve(root string, cwd string, fallback string) (*Resolution, error) {
+	if version := os.Getenv(shell.SessionVariable); version != "" {
+		dir := node.Dir(root, version)
+		if !file.Exists(filepath.Join(dir, "node.exe")) {
+			return nil, fmt.Errorf("node %s (%s) is not installed", version, shell.SessionVariable)
+		}
+		return &Resolution{Version: version, Dir: dir, From: FromSession}, nil
+	}
+
+	r, err := Project(root, cwd)
+	if !errors.Is(err, nvmrc.ErrNotFound) {
+		return r, err
+	}
+
+	if fallback == "" {
+		return nil, ErrNoVersion
+	}
+
+	dir := node.Dir(root, fallback)
+	if !file.Exists(filepath.Join(dir, "node.exe")) {
+		return nil, fmt.Errorf("the default version (node %s) is not installed. Run \"nvm use <version>\" to select another one", fallback)
+	}
+
+	return &Resolution{Version: fallback, Dir: dir, From: FromDefault}, nil
+}
+
+// Project resolves the version required by the nearest project version
+// file. nvmrc.ErrNotFound is returned when there is none.
+func Project(root string, cwd string) (*Resolution, error) {
+	spec, rc, err := nvmrc.Lookup(cwd)
+	if err != nil {
+		return nil, err
+	}
+
+	version := node.MatchInstalled(root, spec)
+	if version == "" {
+		return nil, &NotInstalledError{Spec: spec, File: rc}
+	}
+
+	return &Resolution{Version: version, Dir: node.Dir(root, version), From: FromProject, File: rc}, nil
+}
+
+// Command returns the command that runs node, npm, npx or the executable of
+// a global package from the resolved installation. npm and npx run their
+// CLI scripts with node.exe directly, so no batch file sits between the
+// shim and node.
+func (r *Resolution) Command(name string, args ...string) (*exec.Cmd, error) {
+	name = strings.ToLower(name)
+	switch name {
+	case "node":
+	case "npm", "npx":
+		script := filepath.Join(r.Dir, "node_modules", "npm", "bin", name+"-cli.js")
+		if !file.Exists(script) {
+			return nil, fmt.Errorf("%s is not installed for node %s", name, r.Version)
+		}
+		args = append([]string{script}, args...)
+	default:
+		if filepath.Base(name) != name {
+			return nil, fmt.Errorf("there is no shim for %s", name)
+		}
+		bin := filepath.Join(r.Dir, name+".cmd")
+		if !file.Exists(bin) {
+			return nil, fmt.Errorf("%s is not installed for node %s. Run \"npm install -g\" to install the package that provides it", name, r.Version)
+		}
+		cmd := exec.Command(bin, args...)
+		cmd.Env = environment(node.Env(r.Dir, os.Getenv("PATH")))
+		return cmd, nil
+	}
+
+	cmd := exec.Command(filepath.Join(r.Dir, "node.exe"), args...)
+	cmd.Env = environment(node.Env(r.Dir, os.Getenv("PATH")))
+
+	return cmd, nil
+}
+
+// environment returns the environment of this process with vars replaced.
+// Windows variable names are case insensitive.
+func environment(vars map[string]string) []string {
+	result := make([]string, 0)
+	for _, entry := range os.Environ() {
+		name := strings.SplitN(entry, "=", 2)[0]
+		replaced := false
+		for key := range vars {
+			replaced = replaced || strings.EqualFold(key, name)
+		}
+		if !replaced {
+			result = append(result, entry)
+		}
+	}
+
+	for key, value := range vars {
+		result = append(result, key+"="+value)
+	}
+
+	return result
+}
+
+// IsInstalled reports whether dir contains the shims.
+func IsInstalled(dir string) bool {
+	return file.Exists(filepath.Join(dir, marker))
+}
+
+// Install writes the shims to dir, which is created when necessary, and
+// refreshes the launchers of global package executables (see Refresh). exe
+// is the nvm-shim.exe to copy.
+func Install(dir string, exe string, root string) error {
+	if !file.Exists(exe) {
+		return fmt.Errorf("%s is missing. Reinstall nvm to use shim activation.", exe)
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	if err := Update(dir, exe); err != nil {
+		return err
+	}
+
+	for name, content := range scripts {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), os.ModePerm); err != nil {
+			return err
+		}
+	}
+
+	return Refresh(dir, root)
+}
+
+// Update replaces the shim binaries (node.exe and nvm-shim.exe) in dir with
+// exe, i.e. after nvm was upgraded.
+func Update(dir string, exe string) error {
+	for _, name := range []string{"node.exe", Executable} {
+		if err := CopyExecutable(exe, filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CopyExecutable copies the executable src to dst. A running executable
+// (i.e. a shim of a running node process) cannot be overwritten, but it can
+// be renamed, so dst is moved aside to a hidden .old file when the copy
+// fails. The .old file is removed by the next copy once it is not running.
+func CopyExecutable(src string, dst string) error {
+	old := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".old")
+	os.Remove(old)
+
+	if err := utility.Copy(src, dst); err == nil || !file.Exists(dst) {
+		return err
+	}
+
+	if err := os.Rename(dst, old); err != nil {
+		return fmt.Errorf("%s is in use and cannot be replaced: %w", dst, err)
+	}
+
+	return utility.Copy(src, dst)
+}
+
+// Refresh writes a launcher to dir for the executable of every global
+// package installed in any version under root, and removes the launchers
+// of executables that no longer exist. An executable missing from the
+// version a launcher resolves to is reported when it runs.
+func Refresh(dir string, root string) error {
+	bins := make(map[string]bool)
+	dirs := make([]string, 0)
+	for _, v := range node.GetInstalled(root) {
+		dirs = append(dirs, filepath.Join(root, v))
+	}
+	for _, l := range node.GetLinked(root) {
+		dirs = append(dirs, filepath.Join(root, l.Name))
+	}
+	for _, d := range dirs {
+		entries, _ := os.ReadDir(d)
+		for _, entry := range entries {
+			name := strings.ToLower(entry.Name())
+			if entry.IsDir() || !strings.HasSuffix(name, ".cmd") {
+				continue
+			}
+			if _, reserved := scripts[name]; !reserved {
+				bins[name] = true
+			}
+		}
+	}
+
+	for _, name := range launchers(dir) {
+		if !bins[name] {
+			os.Remove(filepath.Join(dir, name))
+		}
+	}
+
+	names := make([]string, 0, len(bins))
+	for name := range bins {
+		content := "@echo off\r\n\"%~dp0" + Executable + "\" " + strings.TrimSuffix(name, ".cmd") + " %*\r\n"
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), os.ModePerm); err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return os.WriteFile(filepath.Join(dir, marker), []byte(strings.Join(names, "\r\n")), os.ModePerm)
+}
+
+// launchers returns the launchers of global package executables in dir.
+func launchers(dir string) []string {
+	data, err := os.ReadFile(filepath.Join(dir, marker))
+	if err != nil {
+		return []string{}
+	}
+
+	return strings.Fields(string(data))
+}
+
+// IsGlobal reports whether npm arguments operate on the global packages
+// (-g, --global or --location=global), after which the launchers are
+// refreshed.
+func IsGlobal(args []string) bool {
+	for _, arg := range args {
+		switch strings.ToLower(arg) {
+		case "-g", "--global", "--location=global":
+			return true
+		}
+	}
+
+	return false
+}
+
+// Remove deletes the shims, and dir when nothing else is left in it.
+func Remove(dir string) error {
+	if !IsInstalled(dir) {
+		return nil
+	}
+
+	names := append(launchers(dir), "node.exe", Executable, "npm.cmd", "npx.cmd", marker)
+	for _, name := range names {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	// Left behind by CopyExecutable, unless still running
+	for _, name := range []string{"node.exe", Executable} {
+		os.Remove(filepath.Join(dir, "."+name+".old"))
+	}
+
+	os.Remove(dir)
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package shim
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRefresh(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(t.TempDir(), "nodejs")
+	exe := filepath.Join(t.TempDir(), Executable)
+	os.WriteFile(exe, []byte("shim"), os.ModePerm)
+
+	for _, path := range []string{"v18.19.1/tsc.cmd", "v20.11.1/tsc.cmd", "v20.11.1/eslint.cmd", "v20.11.1/npm.cmd", "v20.11.1/tsc.ps1"} {
+		path = filepath.Join(root, path)
+		os.MkdirAll(filepath.Dir(path), os.ModePerm)
+		os.WriteFile(path, []byte("@echo off"), os.ModePerm)
+	}
+
+	if err := Install(dir, exe, root); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "tsc.cmd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "@echo off\r\n\"%~dp0nvm-shim.exe\" tsc %*\r\n"; string(content) != expected {
+		t.Errorf("tsc.cmd: got %q, expected %q", content, expected)
+	}
+	if content, _ := os.ReadFile(filepath.Join(dir, "npm.cmd")); string(content) != scripts["npm.cmd"] {
+		t.Error("the npm shim was replaced by a launcher")
+	}
+
+	// eslint was uninstalled
+	os.Remove(filepath.Join(root, "v20.11.1", "eslint.cmd"))
+	if err := Refresh(dir, root); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "eslint.cmd")); !os.IsNotExist(err) {
+		t.Error("the launcher of a removed executable was kept")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "tsc.cmd")); err != nil {
+		t.Error(err)
+	}
+
+	if err := Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("files were left in the shim directory")
+	}
+}
+
+func TestIsGlobal(t *testing.T) {
+	for args, expected := range map[string]bool{
+		"install -g typescript":         true,
+		"uninstall --global typescript": true,
+		"i --location=global eslint":    true,
+		"install typescript":            false,
+		"run build -- -gx":              false,
+	} {
+		if IsGlobal(strings.Fields(args)) != expected {
+			t.Errorf("IsGlobal(%q) != %v", args, expected)
+		}
+	}
+}
@@ -24,7 +24,7 @@ func Check(root string, nvmversion string) {
 
 	// Check for Node.js updates
 	if reg.LTS || reg.Current {
-		buf, err := get(web.GetFullNodeUrl("index.json"))
+		buf, err := get(web.NewClient("", true).GetFullNodeUrl("index.json"))
 		abortOnError(err)
 
 		var data = make([]map[string]interface{}, 0)
@@ -0,0 +1,297 @@
+package upgrade
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"nvm/file"
+	"nvm/shim"
+	"nvm/utility"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The Network of nvm, over HTTP.
+type httpNetwork struct{}
+
+func (httpNetwork) Get(ctx context.Context, url string) ([]byte, error) {
+	return fetch(ctx, url)
+}
+
+// The Filesystem of the running nvm. Upgrades are staged in the temporary
+// directory and applied to the directory of nvm.exe. The previous files are
+// kept in its hidden .update directory for a manual rollback.
+type installation struct {
+	// exe is the path of the running nvm.exe.
+	exe string
+	// shims is the shim directory in shim mode (see shim), or empty.
+	shims string
+}
+
+func (i *installation) dir() string {
+	return filepath.Dir(i.exe)
+}
+
+func (i *installation) updateDir() string {
+	return filepath.Join(i.dir(), ".update")
+}
+
+func (i *installation) Stage(archive []byte, assets map[string][]byte) (string, error) {
+	staged, err := os.MkdirTemp("", "nvm-upgrade-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+
+	if err := extract(archive, staged); err != nil {
+		os.RemoveAll(staged)
+		return "", fmt.Errorf("failed to extract update: %w", err)
+	}
+
+	for name, body := range assets {
+		if err := os.WriteFile(filepath.Join(staged, name), body, os.ModePerm); err != nil {
+			os.RemoveAll(staged)
+			return "", err
+		}
+	}
+
+	utility.DebugLogf("update staged in %s", staged)
+	return staged, nil
+}
+
+func (i *installation) Backup() error {
+	bkp, err := os.MkdirTemp("", "nvm-backup-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(bkp)
+
+	// The archive cannot be written into the directory being archived
+	if err := file.Zip(i.dir(), filepath.Join(bkp, "backup.zip")); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(i.updateDir(), os.ModePerm); err != nil {
+		return err
+	}
+
+	return copyFile(filepath.Join(bkp, "backup.zip"), filepath.Join(i.updateDir(), "nvm4w-backup.zip"))
+}
+
+func (i *installation) Apply(staged string) error {
+	entries, err := os.ReadDir(staged)
+	if err != nil {
+		return err
+	}
+
+	// The shims would keep running the previous release, or disappear with
+	// the next nvm use, if the release came without them
+	shimExe := filepath.Join(staged, shim.Executable)
+	if !file.Exists(shimExe) && (i.shims != "" || file.Exists(filepath.Join(i.dir(), shim.Executable))) {
+		return fmt.Errorf("the release does not include %s, which shim activation requires", shim.Executable)
+	}
+
+	if err := os.MkdirAll(i.updateDir(), os.ModePerm); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		src := filepath.Join(staged, entry.Name())
+		switch {
+		case strings.EqualFold(entry.Name(), "nvm.exe"), strings.EqualFold(entry.Name(), "update.exe"):
+			// Replaced (or run) by the updater once nvm exits
+			err = copyFile(src, filepath.Join(i.updateDir(), entry.Name()))
+		case strings.EqualFold(entry.Name(), shim.Executable):
+			// May be running
+			err = shim.CopyExecutable(src, filepath.Join(i.dir(), entry.Name()))
+		case entry.IsDir():
+			err = copyDirContents(src, filepath.Join(i.dir(), entry.Name()))
+		default:
+			err = copyFile(src, filepath.Join(i.dir(), entry.Name()))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// The shims are copies of nvm-shim.exe
+	if i.shims != "" && shim.IsInstalled(i.shims) {
+		if err := shim.Update(i.shims, shimExe); err != nil {
+			return err
+		}
+	}
+
+	return setHidden(i.updateDir())
+}
+
+func (i *installation) Replace() error {
+	currentPath := i.exe
+
+	// Create temporary directory for the updater script
+	tempDir := filepath.Dir(currentPath) // Use the same temp dir as the new executable
+	scriptPath := filepath.Join(tempDir, "updater.bat")
+
+	// Temporary batch file that deletes the directory and the scheduled task
+	tmp, err := os.MkdirTemp("", "nvm4w-remove-*")
+	if err != nil {
+		return fmt.Errorf("error creating temporary directory: %w", err)
+	}
+
+	// schedule removal of restoration folder for 7 days from now
+	tempBatchFile := filepath.Join(tmp, "remove_backup.bat")
+	now := time.Now()
+	futureDate := now.AddDate(0, 0, 7)
+	formattedDate := futureDate.Format("01/02/2006")
+	batchContent := fmt.Sprintf(`
+@echo off
+schtasks /delete /tn "RemoveNVM4WBackup" /f
+rmdir /s /q "%s"
+`, escapeBackslashes(filepath.Join(filepath.Dir(currentPath), ".update")))
+
+	// Write the batch file to a temporary location
+	err = os.WriteFile(tempBatchFile, []byte(batchContent), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("error creating temporary batch file: %w", err)
+	}
+
+	updaterScript := fmt.Sprintf(`@echo off
+setlocal enabledelayedexpansion
+
+echo ========= Update Script Started ========= >> error.log
+echo Started updater script with PID %%1 at %%TIME%% >> error.log
+echo Source: %%~2 >> error.log
+echo Target: %%~3 >> error.log
+
+:wait
+timeout /t 1 /nobreak >nul
+tasklist /fi "PID eq %%1" 2>nul | find "%%1" >nul
+if not errorlevel 1 (
+	echo Waiting for PID %%1 to exit at %%TIME%%... >> error.log
+	goto :wait
+)
+
+echo ========= Starting Copy Operation ========= >> error.log
+echo Checking if source (%%~2) exists... >> error.log
+if not exist "%%~2" (
+	echo ERROR: Source file does not exist: %%~2 >> error.log
+	exit /b 1
+)
+echo Source file exists >> error.log
+
+del "%%~3" >> error.log
+
+echo Checking if target location is writable... >> error.log
+echo Test > "%%~dp3test.txt" 2>>error.log
+if errorlevel 1 (
+	echo ERROR: Target location is not writable: %%~dp3 >> error.log
+	exit /b 1
+)
+del "%%~dp3test.txt"
+echo Target location is writable >> error.log
+
+echo Attempting copy at %%TIME%%... >> error.log
+echo Running: copy /y "%%~2" "%%~3" >> error.log
+copy /y "%%~2" "%%~3" >> error.log 2>&1
+if errorlevel 1 (
+	echo ERROR: Copy failed with error level %%errorlevel%% >> error.log
+	exit /b %%errorlevel%%
+)
+
+echo Verifying copy... >> error.log
+if not exist "%%~3" (
+	echo ERROR: Target file does not exist after copy: %%~3 >> error.log
+	exit /b 1
+)
+
+del "%%~2" >> error.log
+if exist "%%~2" (
+	echo ERROR: Source file still exists after deletion: %%~2 >> error.log
+	exit /b 1
+)
+
+:: Schedule the task to delete the directory
+echo schtasks /create /tn "RemoveNVM4WBackup" /tr "cmd.exe /c %s" /sc once /sd %s /st 12:00 /f >> error.log
+schtasks /create /tn "RemoveNVM4WBackup" /tr "cmd.exe /c %s" /sc once /sd %s /st 12:00 /f
+if not errorlevel 0 (
+	echo ERROR: Failed to create scheduled task: exit code: %%errorlevel%% >> error.log
+	exit /b %%errorlevel%%
+)
+
+echo Update complete >> error.log
+
+del error.log
+
+del "%%~f0"
+start "nvm://launch?action=upgrade_notify"
+exit /b 0
+`, escapeBackslashes(tempBatchFile), formattedDate, escapeBackslashes(tempBatchFile), formattedDate)
+
+	err = os.WriteFile(scriptPath, []byte(updaterScript), os.ModePerm) // Use standard Windows file permissions
+	if err != nil {
+		return fmt.Errorf("error creating updater script: %w", err)
+	}
+
+	// The updater waits for this process to exit
+	cmd := exec.Command(scriptPath, fmt.Sprintf("%d", os.Getpid()), filepath.Join(tempDir, ".update", "nvm.exe"), currentPath)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error starting updater script: %w", err)
+	}
+
+	return nil
+}
+
+func (i *installation) Cleanup(staged string) error {
+	return os.RemoveAll(staged)
+}
+
+// Extracts a zip archive into a directory.
+func extract(archive []byte, dest string) error {
+	r, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return err
+	}
+
+	for _, f := range r.File {
+		fpath := filepath.Join(dest, f.Name)
+		if !strings.HasPrefix(fpath, filepath.Clean(dest)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid file path in archive: %s", f.Name)
+		}
+
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(fpath, os.ModePerm); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
+			return err
+		}
+		if err := extractFile(f, fpath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func extractFile(f *zip.File, dest string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, rc)
+	return err
+}
@@ -0,0 +1,118 @@
+package upgrade
+
+import (
+	"archive/zip"
+	"bytes"
+	"nvm/shim"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func archive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		entry, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestInstallationApply(t *testing.T) {
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "nvm.exe")
+	if err := os.WriteFile(exe, []byte("old nvm"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	i := &installation{exe: exe}
+	staged, err := i.Stage(archive(t, map[string]string{
+		"nvm.exe":          "new nvm",
+		"elevate.cmd":      "elevate",
+		"licenses/LICENSE": "license",
+	}), map[string][]byte{"update.exe": []byte("updater")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i.Cleanup(staged)
+
+	if err := i.Apply(staged); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, expected := range map[string]string{
+		"nvm.exe":            "old nvm",
+		"elevate.cmd":        "elevate",
+		"licenses/LICENSE":   "license",
+		".update/nvm.exe":    "new nvm",
+		".update/update.exe": "updater",
+	} {
+		content, err := os.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+		} else if string(content) != expected {
+			t.Errorf("%s: got %q, expected %q", path, content, expected)
+		}
+	}
+}
+
+func TestInstallationApplyShims(t *testing.T) {
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "nvm.exe")
+	shims := filepath.Join(t.TempDir(), "nodejs")
+	os.WriteFile(exe, []byte("old nvm"), os.ModePerm)
+	os.WriteFile(filepath.Join(dir, shim.Executable), []byte("old shim"), os.ModePerm)
+	if err := shim.Install(shims, filepath.Join(dir, shim.Executable), t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	i := &installation{exe: exe, shims: shims}
+
+	// A release without the shim is rejected before anything changes
+	staged, err := i.Stage(archive(t, map[string]string{"nvm.exe": "new nvm"}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i.Cleanup(staged)
+	if err := i.Apply(staged); err == nil {
+		t.Error("a release without nvm-shim.exe was applied")
+	}
+
+	staged, err = i.Stage(archive(t, map[string]string{"nvm.exe": "new nvm", shim.Executable: "new shim"}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i.Cleanup(staged)
+	if err := i.Apply(staged); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{
+		filepath.Join(dir, shim.Executable),
+		filepath.Join(shims, shim.Executable),
+		filepath.Join(shims, "node.exe"),
+	} {
+		if content, err := os.ReadFile(path); err != nil || string(content) != "new shim" {
+			t.Errorf("%s was not updated: %q (%v)", path, content, err)
+		}
+	}
+}
+
+func TestExtractRejectsEscapingPaths(t *testing.T) {
+	dir := t.TempDir()
+	if err := extract(archive(t, map[string]string{"../escaped.txt": "x"}), filepath.Join(dir, "staged")); err == nil {
+		t.Error("expected an error")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escaped.txt")); err == nil {
+		t.Error("a file was extracted outside of the directory")
+	}
+}
@@ -0,0 +1,230 @@
+package upgrade
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"nvm/exit"
+	"path"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Network downloads the release metadata and the files of an upgrade.
+type Network interface {
+	Get(ctx context.Context, url string) ([]byte, error)
+}
+
+// Filesystem stages an upgrade and applies it to the nvm installation.
+type Filesystem interface {
+	// Stage extracts the release archive and writes the additional assets
+	// into a new staging directory, which it returns.
+	Stage(archive []byte, assets map[string][]byte) (string, error)
+	// Backup archives the installation, for a manual rollback.
+	Backup() error
+	// Apply copies the staged files into the installation, and updates
+	// the shims in shim mode. nvm.exe is running and cannot be
+	// overwritten, so it is set aside for Replace.
+	Apply(staged string) error
+	// Replace starts the script that replaces nvm.exe once nvm exits.
+	Replace() error
+	// Cleanup removes the staging directory.
+	Cleanup(staged string) error
+}
+
+// EventKind distinguishes progress messages from warnings.
+type EventKind int
+
+const (
+	Progress EventKind = iota
+	Warning
+)
+
+// Event reports the progress of an upgrade.
+type Event struct {
+	Kind EventKind
+	Text string
+}
+
+// Result describes an upgrade.
+type Result struct {
+	// From is the running version and To the latest release.
+	From string
+	To   string
+	// UpToDate is true when no newer release exists. Nothing was changed.
+	UpToDate bool
+}
+
+// Upgrader upgrades nvm to its latest release. The steps run in order and
+// report through Events; the outcome is only reported by Upgrade's return
+// value.
+type Upgrader struct {
+	// Version is the running version of nvm.
+	Version string
+	// URL is the release metadata (see UPDATE_URL).
+	URL     string
+	Network Network
+	Files   Filesystem
+	// Events receives progress and may be nil.
+	Events func(Event)
+}
+
+// Upgrade downloads, verifies and applies the latest release. Canceling the
+// context stops the upgrade until the installation starts to change; the
+// context error is returned. The result is nil when the release metadata
+// could not be obtained.
+func (u *Upgrader) Upgrade(ctx context.Context) (*Result, error) {
+	update, err := checkForUpdate(ctx, u.Network, u.URL)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, exit.Mark(exit.ErrNetwork, fmt.Errorf("failed to obtain update data: %w", err))
+	}
+
+	for _, warning := range update.Warnings {
+		u.warn(warning)
+	}
+
+	result := &Result{From: u.Version, To: update.Version}
+	_, available, err := update.Available(u.Version)
+	if err != nil {
+		return result, err
+	}
+	if !available {
+		result.UpToDate = true
+		u.progress("nvm is up to date")
+		return result, nil
+	}
+
+	for _, warning := range update.VersionWarnings {
+		u.warn(warning)
+	}
+	u.progress("upgrading from v%s to v%s", u.Version, update.Version)
+
+	if update.SourceURL == "" {
+		return result, exit.Errorf(exit.ErrNotFound, "release %s does not include nvm-noinstall.zip", update.Version)
+	}
+
+	u.progress("downloading...")
+	archive, checksum, assets, err := u.download(ctx, update)
+	if err != nil {
+		return result, err
+	}
+
+	u.progress("verifying checksum...")
+	if err := verify(archive, checksum); err != nil {
+		return result, err
+	}
+
+	u.progress("extracting update...")
+	staged, err := u.Files.Stage(archive, assets)
+	if err != nil {
+		return result, err
+	}
+	defer u.Files.Cleanup(staged)
+
+	// Last chance to cancel: the installation is not changed until now
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	u.progress("applying update...")
+	if err := u.Files.Backup(); err != nil {
+		return result, fmt.Errorf("failed to create backup: %w", err)
+	}
+	if err := u.Files.Apply(staged); err != nil {
+		return result, fmt.Errorf("failed to apply update: %w", err)
+	}
+
+	u.progress("restarting app...")
+	if err := u.Files.Replace(); err != nil {
+		return result, fmt.Errorf("failed to start the updater: %w", err)
+	}
+
+	return result, nil
+}
+
+// Downloads the release archive, its checksum and the additional assets
+// concurrently. The first failure cancels the other downloads.
+func (u *Upgrader) download(ctx context.Context, update *Update) (archive []byte, checksum []byte, assets map[string][]byte, err error) {
+	g, gctx := errgroup.WithContext(ctx)
+
+	g.Go(func() (err error) {
+		archive, err = u.get(gctx, update.SourceURL)
+		return err
+	})
+	g.Go(func() (err error) {
+		checksum, err = u.get(gctx, update.SourceURL+".checksum.txt")
+		return err
+	})
+
+	bodies := make([][]byte, len(update.Assets))
+	for i, asset := range update.Assets {
+		i, asset := i, asset
+		g.Go(func() (err error) {
+			bodies[i], err = u.get(gctx, assetURL(update.SourceURL, asset))
+			return err
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, nil, ctx.Err()
+		}
+		return nil, nil, nil, err
+	}
+
+	assets = make(map[string][]byte)
+	for i, asset := range update.Assets {
+		assets[path.Base(asset)] = bodies[i]
+	}
+
+	return archive, checksum, assets, nil
+}
+
+func (u *Upgrader) get(ctx context.Context, url string) ([]byte, error) {
+	body, err := u.Network.Get(ctx, url)
+	if err != nil {
+		return nil, exit.Mark(exit.ErrNetwork, fmt.Errorf("failed to download %s: %w", url, err))
+	}
+	return body, nil
+}
+
+func (u *Upgrader) emit(kind EventKind, format string, a ...interface{}) {
+	if u.Events != nil {
+		u.Events(Event{Kind: kind, Text: fmt.Sprintf(format, a...)})
+	}
+}
+
+func (u *Upgrader) progress(format string, a ...interface{}) {
+	u.emit(Progress, format, a...)
+}
+
+func (u *Upgrader) warn(text string) {
+	u.emit(Warning, "%s", text)
+}
+
+// Assets named without a URL are published with the release archive.
+func assetURL(source string, asset string) string {
+	if strings.HasPrefix(asset, "http") {
+		return asset
+	}
+	return source[:strings.LastIndex(source, "/")+1] + asset
+}
+
+// Compares the MD5 checksum of the archive with the first word of the
+// checksum file.
+func verify(archive []byte, checksum []byte) error {
+	fields := strings.Fields(string(checksum))
+	if len(fields) == 0 {
+		return exit.New(exit.ErrIntegrity, "cannot validate update file (empty checksum)")
+	}
+
+	if !strings.EqualFold(fmt.Sprintf("%x", md5.Sum(archive)), fields[0]) {
+		return exit.New(exit.ErrIntegrity, "cannot validate update file (checksum mismatch)")
+	}
+
+	return nil
+}
@@ -0,0 +1,239 @@
+package upgrade
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"nvm/exit"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+const (
+	releaseURL = "https://example.com/releases/latest"
+	archiveURL = "https://example.com/download/1.2.0/nvm-noinstall.zip"
+)
+
+// fakeNetwork serves fixed responses. Unknown URLs fail like a 404.
+type fakeNetwork struct {
+	mu        sync.Mutex
+	responses map[string][]byte
+	// handlers override responses, i.e. to block or fail.
+	handlers  map[string]func(ctx context.Context) ([]byte, error)
+	requested []string
+}
+
+func (n *fakeNetwork) Get(ctx context.Context, url string) ([]byte, error) {
+	n.mu.Lock()
+	n.requested = append(n.requested, url)
+	handler := n.handlers[url]
+	body, ok := n.responses[url]
+	n.mu.Unlock()
+
+	if handler != nil {
+		return handler(ctx)
+	}
+	if !ok {
+		return nil, fmt.Errorf("error: received status code 404")
+	}
+	return body, nil
+}
+
+// fakeFiles records the steps applied to the installation.
+type fakeFiles struct {
+	calls  []string
+	assets map[string][]byte
+	// stage runs during Stage, i.e. to cancel the upgrade.
+	stage func()
+	fail  map[string]error
+}
+
+func (f *fakeFiles) step(name string) error {
+	f.calls = append(f.calls, name)
+	return f.fail[name]
+}
+
+func (f *fakeFiles) Stage(archive []byte, assets map[string][]byte) (string, error) {
+	f.assets = assets
+	if f.stage != nil {
+		f.stage()
+	}
+	return "staged", f.step("stage")
+}
+
+func (f *fakeFiles) Backup() error               { return f.step("backup") }
+func (f *fakeFiles) Apply(staged string) error   { return f.step("apply") }
+func (f *fakeFiles) Replace() error              { return f.step("replace") }
+func (f *fakeFiles) Cleanup(staged string) error { return f.step("cleanup") }
+
+func release(t *testing.T, version string) *fakeNetwork {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	entry, err := w.Create("nvm.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry.Write([]byte("new nvm"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archive := buf.Bytes()
+
+	return &fakeNetwork{
+		responses: map[string][]byte{
+			releaseURL: []byte(fmt.Sprintf(`{"name": %q, "assets": [
+				{"name": "nvm-noinstall.zip", "browser_download_url": %q},
+				{"name": "update.exe", "browser_download_url": "https://example.com/download/1.2.0/update.exe"}
+			]}`, version, archiveURL)),
+			ALERTS_URL:                   []byte(`{"all": [{"message": "general notice"}], "1.2.0": [{"message": "1.2.0 notice"}]}`),
+			archiveURL:                   archive,
+			archiveURL + ".checksum.txt": []byte(fmt.Sprintf("%X  nvm-noinstall.zip\n", md5.Sum(archive))),
+			"https://example.com/download/1.2.0/update.exe": []byte("updater"),
+		},
+		handlers: make(map[string]func(ctx context.Context) ([]byte, error)),
+	}
+}
+
+func upgrader(network Network, files Filesystem, events *[]Event) *Upgrader {
+	return &Upgrader{
+		Version: "1.1.12",
+		URL:     releaseURL,
+		Network: network,
+		Files:   files,
+		Events: func(e Event) {
+			*events = append(*events, e)
+		},
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	network := release(t, "1.2.0")
+	files := &fakeFiles{}
+	events := make([]Event, 0)
+
+	result, err := upgrader(network, files, &events).Upgrade(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.UpToDate || result.From != "1.1.12" || result.To != "1.2.0" {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	if expected := []string{"stage", "backup", "apply", "replace", "cleanup"}; !reflect.DeepEqual(files.calls, expected) {
+		t.Errorf("steps: got %v, expected %v", files.calls, expected)
+	}
+	if string(files.assets["update.exe"]) != "updater" {
+		t.Errorf("update.exe was not staged: %v", files.assets)
+	}
+
+	expected := []Event{
+		{Warning, "general notice"},
+		{Warning, "1.2.0 notice"},
+		{Progress, "upgrading from v1.1.12 to v1.2.0"},
+		{Progress, "downloading..."},
+		{Progress, "verifying checksum..."},
+		{Progress, "extracting update..."},
+		{Progress, "applying update..."},
+		{Progress, "restarting app..."},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("events: got %v, expected %v", events, expected)
+	}
+}
+
+func TestUpgradeUpToDate(t *testing.T) {
+	network := release(t, "1.1.12")
+	files := &fakeFiles{}
+	events := make([]Event, 0)
+
+	result, err := upgrader(network, files, &events).Upgrade(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.UpToDate {
+		t.Errorf("expected no upgrade, got %+v", result)
+	}
+	if len(files.calls) > 0 {
+		t.Errorf("the installation was changed: %v", files.calls)
+	}
+	if len(network.requested) != 2 {
+		t.Errorf("expected only the release and the alerts to be requested, got %v", network.requested)
+	}
+}
+
+func TestUpgradeChecksumMismatch(t *testing.T) {
+	network := release(t, "1.2.0")
+	network.responses[archiveURL+".checksum.txt"] = []byte("d41d8cd98f00b204e9800998ecf8427e")
+	files := &fakeFiles{}
+	events := make([]Event, 0)
+
+	_, err := upgrader(network, files, &events).Upgrade(context.Background())
+	if !errors.Is(err, exit.ErrIntegrity) {
+		t.Fatalf("expected an integrity failure, got %v", err)
+	}
+	if len(files.calls) > 0 {
+		t.Errorf("the installation was changed: %v", files.calls)
+	}
+}
+
+func TestUpgradeDownloadFailure(t *testing.T) {
+	network := release(t, "1.2.0")
+	delete(network.responses, "https://example.com/download/1.2.0/update.exe")
+
+	// The archive download only ends when it is canceled by the failure
+	network.handlers[archiveURL] = func(ctx context.Context) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	files := &fakeFiles{}
+	events := make([]Event, 0)
+
+	_, err := upgrader(network, files, &events).Upgrade(context.Background())
+	if !errors.Is(err, exit.ErrNetwork) || errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the download failure, got %v", err)
+	}
+	if exit.Code(err) != exit.Network {
+		t.Errorf("expected exit code %d, got %d", exit.Network, exit.Code(err))
+	}
+	if len(files.calls) > 0 {
+		t.Errorf("the installation was changed: %v", files.calls)
+	}
+}
+
+func TestUpgradeCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	network := release(t, "1.2.0")
+	files := &fakeFiles{stage: cancel}
+	events := make([]Event, 0)
+
+	_, err := upgrader(network, files, &events).Upgrade(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the upgrade to be canceled, got %v", err)
+	}
+	if expected := []string{"stage", "cleanup"}; !reflect.DeepEqual(files.calls, expected) {
+		t.Errorf("steps: got %v, expected %v", files.calls, expected)
+	}
+}
+
+func TestUpgradeApplyFailure(t *testing.T) {
+	network := release(t, "1.2.0")
+	files := &fakeFiles{fail: map[string]error{"apply": errors.New("access denied")}}
+	events := make([]Event, 0)
+
+	_, err := upgrader(network, files, &events).Upgrade(context.Background())
+	if err == nil || err.Error() != "failed to apply update: access denied" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if expected := []string{"stage", "backup", "apply", "cleanup"}; !reflect.DeepEqual(files.calls, expected) {
+		t.Errorf("steps: got %v, expected %v", files.calls, expected)
+	}
+}
@@ -0,0 +1,149 @@
+package upgrade
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nvm/author"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/ncruces/zenity"
+)
+
+type Notification struct {
+	AppID    string   `json:"app_id"`
+	Title    string   `json:"title"`
+	Message  string   `json:"message"`
+	Icon     string   `json:"icon"`
+	Actions  []Action `json:"actions"`
+	Duration string   `json:"duration"`
+	Link     string   `json:"link"`
+}
+
+type Action struct {
+	Type  string `json:"type"`
+	Label string `json:"label"`
+	URI   string `json:"uri"`
+}
+
+func display(data Notification) {
+	data.AppID = "NVM for Windows"
+	content, _ := json.Marshal(data)
+	author.Bridge("notify", string(content))
+}
+
+// Run upgrades nvm from the running version to the latest release. Progress
+// is printed on the console, or shown in a progress dialog and notifications
+// when ui is true (i.e. when started by the nvm:// protocol handler).
+// Interrupting nvm or closing the dialog cancels the upgrade until it is
+// applied. The outcome is reported before the error is returned. shims is
+// the shim directory to update in shim mode, or empty.
+func Run(version string, shims string, ui bool) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	u := &Upgrader{
+		Version: version,
+		URL:     UPDATE_URL,
+		Network: httpNetwork{},
+		Files:   &installation{exe: exe, shims: shims},
+	}
+
+	if ui {
+		return runDialog(ctx, cancel, u, filepath.Dir(exe))
+	}
+	return runConsole(ctx, u)
+}
+
+func runConsole(ctx context.Context, u *Upgrader) error {
+	colorize := EnableVirtualTerminalProcessing() == nil
+	u.Events = func(e Event) {
+		if e.Kind == Warning {
+			Warn(e.Text, colorize)
+			return
+		}
+		fmt.Println(e.Text)
+	}
+
+	result, err := u.Upgrade(ctx)
+	switch {
+	case errors.Is(err, context.Canceled):
+		fmt.Println("Upgrade canceled by user")
+	case err != nil:
+		fmt.Println(err)
+	case !result.UpToDate:
+		fmt.Println("Upgrade complete")
+	}
+
+	return err
+}
+
+func runDialog(ctx context.Context, cancel context.CancelFunc, u *Upgrader, dir string) error {
+	dlg, err := zenity.Progress(
+		zenity.Title("Upgrading NVM for Windows"),
+		zenity.Icon(filepath.Join(dir, "download.ico")),
+		zenity.WindowIcon(filepath.Join(dir, "nvm.ico")),
+		zenity.AutoClose(),
+		zenity.NoCancel(),
+		zenity.Pulsate())
+	if err != nil {
+		fmt.Println("Failed to create progress dialog")
+		dlg = nil
+	} else {
+		defer dlg.Close()
+		go func() {
+			<-dlg.Done()
+			if err := dlg.Complete(); err == zenity.ErrCanceled {
+				cancel()
+			}
+		}()
+	}
+
+	u.Events = func(e Event) {
+		switch {
+		case e.Kind == Warning:
+			display(Notification{Message: e.Text, Icon: "nvm"})
+		case dlg != nil:
+			dlg.Text(e.Text)
+		}
+	}
+
+	result, err := u.Upgrade(ctx)
+	switch {
+	case errors.Is(err, context.Canceled):
+		display(Notification{
+			Title:   "Installation Canceled",
+			Message: "The upgrade of NVM for Windows was canceled by the user.",
+			Icon:    "error",
+			Actions: []Action{
+				{Type: "protocol", Label: "Install Again", URI: "nvm://launch?action=upgrade"},
+			},
+		})
+	case err != nil:
+		display(Notification{
+			Title:   "Installation Error",
+			Message: err.Error(),
+			Icon:    "error",
+		})
+	case result.UpToDate:
+		display(Notification{
+			Title:   "NVM for Windows is up to date",
+			Message: fmt.Sprintf("Version %s is the latest release.", result.To),
+			Icon:    "nvm",
+		})
+	}
+
+	// A successful upgrade is announced by the updater once nvm.exe is
+	// replaced (see upgrade_notify)
+	return err
+}
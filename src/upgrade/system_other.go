@@ -0,0 +1,13 @@
+//go:build !windows
+
+package upgrade
+
+// EnableVirtualTerminalProcessing is only required by the Windows console.
+func EnableVirtualTerminalProcessing() error {
+	return nil
+}
+
+// Files starting with a dot are hidden already.
+func setHidden(path string) error {
+	return nil
+}
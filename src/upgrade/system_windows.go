@@ -0,0 +1,50 @@
+package upgrade
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+func EnableVirtualTerminalProcessing() error {
+	// Get the handle to the standard output
+	handle := windows.Stdout
+
+	// Retrieve the current console mode
+	var mode uint32
+	if err := windows.GetConsoleMode(handle, &mode); err != nil {
+		return err
+	}
+
+	// Enable the virtual terminal processing mode
+	mode |= ENABLE_VIRTUAL_TERMINAL_PROCESSING
+	if err := windows.SetConsoleMode(handle, mode); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func setHidden(path string) error {
+	// Convert the path to a UTF-16 encoded string
+	lpFileName, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return fmt.Errorf("failed to encode path: %w", err)
+	}
+
+	// Call the Windows API function
+	ret, _, err := syscall.NewLazyDLL("kernel32.dll").
+		NewProc("SetFileAttributesW").
+		Call(
+			uintptr(unsafe.Pointer(lpFileName)),
+			uintptr(FILE_ATTRIBUTE_HIDDEN),
+		)
+
+	// Check the result
+	if ret == 0 {
+		return fmt.Errorf("failed to set hidden attribute: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,6 @@
+//go:build !windows
+
+package utility
+
+// Other terminals interpret ANSI escape codes without being asked to.
+func enableANSI() {}
@@ -0,0 +1,28 @@
+package utility
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// Enable virtual terminal processing on Windows (required to interpret ANSI escape codes)
+const enableVirtualTerminalProcessing = 0x0004
+
+func enableANSI() {
+	kernel32 := syscall.NewLazyDLL("kernel32.dll")
+	setConsoleMode := kernel32.NewProc("SetConsoleMode")
+	stdout := syscall.Stdout
+	// Get the current console mode
+	var mode uint32
+	err := syscall.GetConsoleMode(stdout, &mode)
+	if err != nil {
+		fmt.Println("Error getting console mode:", err)
+		return
+	}
+	// Enable virtual terminal processing
+	mode |= enableVirtualTerminalProcessing
+	_, _, err = setConsoleMode.Call(uintptr(stdout), uintptr(mode))
+	if err != nil && err.Error() != "The operation completed successfully." {
+		fmt.Println("Error enabling ANSI:", err)
+	}
+}
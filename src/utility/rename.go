@@ -44,6 +44,20 @@ func Rename(old, new string) error {
 	return nil
 }
 
+// Copy copies a file or directory (recursively), leaving the source intact.
+func Copy(old, new string) error {
+	info, err := os.Stat(old)
+	if err != nil {
+		return fmt.Errorf("failed to stat source: %w", err)
+	}
+
+	if info.IsDir() {
+		return copyDir(old, new)
+	}
+
+	return copyFile(old, new)
+}
+
 // copyFile copies a single file from source (old) to destination (new).
 func copyFile(old, new string) error {
 	srcFile, err := os.Open(old)
@@ -0,0 +1,181 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nvm/arch"
+	"nvm/exit"
+	"nvm/file"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Source describes a distribution channel of node.js builds. Paths are
+// relative to the base URL and may contain the {version} (without "v") and
+// {arch} (x86, x64, arm64) placeholders.
+type Source struct {
+	Name string `json:"-"`
+	URL  string `json:"url"`
+	// Index is the address of the version index (defaults to <url>index.json).
+	Index string `json:"index,omitempty"`
+	// Archive is the path of the zip distribution of a version.
+	Archive string `json:"archive,omitempty"`
+	// Checksums is the path of the SHA-256 checksum list of a version.
+	Checksums string `json:"checksums,omitempty"`
+	// Legacy sources only provide a standalone node.exe for versions
+	// before 16.9.0 (see getNodeUrl).
+	Legacy bool `json:"-"`
+}
+
+const (
+	defaultArchive   = "v{version}/node-v{version}-win-{arch}.zip"
+	defaultChecksums = "v{version}/SHASUMS256.txt"
+)
+
+// The built-in sources. Each client has its own copies, so the official
+// source can follow the node_mirror setting of the client.
+var builtin = map[string]*Source{
+	"official":   {URL: "https://nodejs.org/dist/", Legacy: true},
+	"unofficial": {URL: "https://unofficial-builds.nodejs.org/download/release/"},
+	"nightly":    {URL: "https://nodejs.org/download/nightly/"},
+	"rc":         {URL: "https://nodejs.org/download/rc/"},
+}
+
+// LoadSources reads custom sources from a JSON file that maps names to
+// sources, i.e. {"internal": {"url": "https://nodejs.example.com/dist/"}}.
+// A missing file is not an error.
+func (c *Client) LoadSources(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	custom := make(map[string]*Source)
+	if err := json.Unmarshal(data, &custom); err != nil {
+		return fmt.Errorf("invalid source configuration %s: %v", path, err)
+	}
+
+	for name, s := range custom {
+		name = strings.ToLower(name)
+		if _, exists := builtin[name]; exists {
+			return fmt.Errorf("invalid source configuration %s: \"%s\" is a built-in source", path, name)
+		}
+		if s.URL == "" {
+			return fmt.Errorf("invalid source configuration %s: the \"%s\" source has no url", path, name)
+		}
+		s.Name = name
+		s.URL = normalizeBase(s.URL)
+		c.sources[name] = s
+	}
+
+	return nil
+}
+
+// Sources lists the names of the known sources.
+func (c *Client) Sources() []string {
+	names := make([]string, 0)
+	for name := range c.sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FindSource returns a named source. A URL is accepted as an ad hoc source
+// that uses the nodejs.org/dist layout.
+func (c *Client) FindSource(name string) (*Source, error) {
+	if s, exists := c.sources[strings.ToLower(name)]; exists {
+		return s, nil
+	}
+
+	if strings.HasPrefix(strings.ToLower(name), "http://") || strings.HasPrefix(strings.ToLower(name), "https://") {
+		return &Source{Name: normalizeBase(name), URL: normalizeBase(name)}, nil
+	}
+
+	return nil, fmt.Errorf("unknown source \"%s\" (available: %s)", name, strings.Join(c.Sources(), ", "))
+}
+
+// WithSource returns a copy of the client that downloads and looks up
+// versions from another source.
+func (c *Client) WithSource(s *Source) *Client {
+	copied := *c
+	copied.source = s
+	return &copied
+}
+
+// Source returns the source the client downloads from.
+func (c *Client) Source() *Source {
+	return c.source
+}
+
+// Official reports whether the source is the official distribution (or
+// its configured mirror).
+func (s *Source) Official() bool {
+	return s.Name == "official"
+}
+
+// IndexURL is the address of the version index.
+func (s *Source) IndexURL() string {
+	if s.Index != "" {
+		return s.Index
+	}
+	return s.URL + "index.json"
+}
+
+// ArchiveURL is the address of the zip distribution of a version.
+func (s *Source) ArchiveURL(version string, a arch.Architecture) string {
+	return s.URL + expand(s.Archive, defaultArchive, version, a)
+}
+
+// ChecksumURL is the address of the checksum list of a version.
+func (s *Source) ChecksumURL(version string) string {
+	return s.URL + expand(s.Checksums, defaultChecksums, version, arch.Unknown)
+}
+
+// Verify compares the SHA-256 checksum of a downloaded artifact with the
+// checksum list of the client's source. The artifact is the URL it was
+// downloaded from. Sources (or mirrors) without a checksum list, or without
+// an entry for the artifact, are not verified. Failing to retrieve an
+// existing checksum list is an error.
+func (c *Client) Verify(path string, version string, artifact string) error {
+	checksums := c.source.ChecksumURL(version)
+	list, err := c.GetRemoteTextFile(checksums)
+	if errors.Is(err, exit.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Entries are relative to the directory of the checksum list
+	name := strings.TrimPrefix(artifact, checksums[:strings.LastIndex(checksums, "/")+1])
+	expected := file.LookupChecksum(list, name)
+	if expected == "" {
+		return nil
+	}
+
+	return file.VerifyChecksum(path, expected)
+}
+
+func expand(template string, fallback string, version string, a arch.Architecture) string {
+	if template == "" {
+		template = fallback
+	}
+	template = strings.ReplaceAll(template, "{version}", version)
+	return strings.ReplaceAll(template, "{arch}", a.Dist())
+}
+
+func normalizeBase(base string) string {
+	if len(base) < 4 || strings.ToLower(base[0:4]) != "http" {
+		base = "http://" + base
+	}
+	if !strings.HasSuffix(base, "/") {
+		base = base + "/"
+	}
+	return base
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/url"
 	"nvm/arch"
+	"nvm/exit"
 	"nvm/file"
 	"os"
 	"os/exec"
@@ -27,48 +28,120 @@ import (
 )
 
 var nvmversion = ""
-var client = &http.Client{}
-var nodeBaseAddress = "https://nodejs.org/dist/"
-var npmBaseAddress = "https://github.com/npm/cli/archive/"
 
-// var oldNpmBaseAddress = "https://github.com/npm/npm/archive/"
+// Client downloads node.js and npm distributions. Each client has its own
+// HTTP client, mirrors and source, so clients in the same process do not
+// affect each other.
+type Client struct {
+	http    *http.Client
+	proxy   string
+	npmBase string
+	sources map[string]*Source
+	source  *Source
+	offline bool
+}
 
-func SetProxy(p string, verifyssl bool) {
-	if p != "" && p != "none" {
-		proxyUrl, _ := url.Parse(p)
-		client = &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyUrl), TLSClientConfig: &tls.Config{InsecureSkipVerify: verifyssl}}}
-	} else {
-		client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: verifyssl}}}
+// NewClient returns a client for the official source that connects through
+// the proxy ("" or "none" for a direct connection). With verifyssl false,
+// the certificates of remote servers are not validated.
+func NewClient(proxy string, verifyssl bool) *Client {
+	c := &Client{
+		http:    newHTTPClient(proxy, verifyssl),
+		proxy:   proxy,
+		npmBase: "https://github.com/npm/cli/archive/",
+		sources: make(map[string]*Source),
+	}
+	for name, s := range builtin {
+		copied := *s
+		copied.Name = name
+		c.sources[name] = &copied
+	}
+	c.source = c.sources["official"]
+
+	return c
+}
+
+func newHTTPClient(proxy string, verifyssl bool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != "" && proxy != "none" {
+		proxyUrl, _ := url.Parse(proxy)
+		transport.Proxy = http.ProxyURL(proxyUrl)
+	}
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: !verifyssl}
+
+	return &http.Client{Transport: transport}
+}
+
+// ErrOffline is returned for requests made while network access is
+// disabled (see SetOffline).
+var ErrOffline = exit.New(exit.ErrNetwork, "network access is disabled (--offline)")
+
+// RequestError is returned when a remote file cannot be retrieved. A
+// missing file (HTTP 404) is a not found error, anything else is a network
+// failure.
+type RequestError struct {
+	URL string
+	// StatusCode is the HTTP status, or 0 when no response was received.
+	StatusCode int
+	Err        error
+}
+
+func (e *RequestError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("Error retrieving \"%s\": HTTP Status %v\n", e.URL, e.StatusCode)
 	}
+	return fmt.Sprintf("Could not retrieve %v: %v", e.URL, e.Err)
 }
 
-func SetMirrors(node_mirror string, npm_mirror string) {
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RequestError) Is(target error) bool {
+	if e.StatusCode == http.StatusNotFound {
+		return target == exit.ErrNotFound
+	}
+	return target == exit.ErrNetwork
+}
+
+// var oldNpmBaseAddress = "https://github.com/npm/npm/archive/"
+
+// SetOffline disables network access. Requests fail without connecting.
+func (c *Client) SetOffline(o bool) {
+	c.offline = o
+}
+
+// SetMirrors replaces the official node.js distribution and the npm
+// archive with mirrors. Empty or "none" mirrors are ignored.
+func (c *Client) SetMirrors(node_mirror string, npm_mirror string) {
 	if node_mirror != "" && node_mirror != "none" {
-		nodeBaseAddress = node_mirror
-		if strings.ToLower(nodeBaseAddress[0:4]) != "http" {
-			nodeBaseAddress = "http://" + nodeBaseAddress
-		}
-		if !strings.HasSuffix(nodeBaseAddress, "/") {
-			nodeBaseAddress = nodeBaseAddress + "/"
-		}
+		c.sources["official"].URL = normalizeBase(node_mirror)
 	}
 	if npm_mirror != "" && npm_mirror != "none" {
-		npmBaseAddress = npm_mirror
-		if strings.ToLower(npmBaseAddress[0:4]) != "http" {
-			npmBaseAddress = "http://" + npmBaseAddress
+		c.npmBase = npm_mirror
+		if strings.ToLower(c.npmBase[0:4]) != "http" {
+			c.npmBase = "http://" + c.npmBase
 		}
-		if !strings.HasSuffix(npmBaseAddress, "/") {
-			npmBaseAddress = npmBaseAddress + "/"
+		if !strings.HasSuffix(c.npmBase, "/") {
+			c.npmBase = c.npmBase + "/"
 		}
 	}
 }
 
-func GetFullNodeUrl(path string) string {
-	return nodeBaseAddress + path
+// Insecure returns a copy of the client that does not validate the
+// certificates of remote servers.
+func (c *Client) Insecure() *Client {
+	copied := *c
+	copied.http = newHTTPClient(c.proxy, false)
+	return &copied
+}
+
+func (c *Client) GetFullNodeUrl(path string) string {
+	return c.source.URL + path
 }
 
-func GetFullNpmUrl(path string) string {
-	return npmBaseAddress + path
+func (c *Client) GetFullNpmUrl(path string) string {
+	return c.npmBase + path
 }
 
 func IsLocalIPv6() (bool, error) {
@@ -99,7 +172,11 @@ func IsLocalIPv6() (bool, error) {
 }
 
 // Returns whether the address can be pinged and whether it is using IPv6 or not
-func Ping(url string) bool {
+func (c *Client) Ping(url string) bool {
+	if c.offline {
+		return false
+	}
+
 	req, err := http.NewRequest("HEAD", url, nil)
 	if err != nil {
 		fmt.Println(err)
@@ -108,7 +185,7 @@ func Ping(url string) bool {
 
 	req.Header.Set("User-Agent", "NVM for Windows")
 
-	response, err := client.Do(req)
+	response, err := c.http.Do(req)
 	if err != nil {
 		return false
 	}
@@ -120,7 +197,12 @@ func Ping(url string) bool {
 	return false
 }
 
-func Download(url string, target string, version string) bool {
+func (c *Client) Download(url string, target string, version string) bool {
+	if c.offline {
+		fmt.Println("Error while downloading", url, "-", ErrOffline)
+		return false
+	}
+
 	output, err := os.Create(target)
 	if err != nil {
 		fmt.Println("Error while creating", target, "-", err)
@@ -136,29 +218,29 @@ func Download(url string, target string, version string) bool {
 
 	req.Header.Set("User-Agent", fmt.Sprintf("NVM for Windows %s", nvmversion))
 
-	response, err := client.Do(req)
+	response, err := c.http.Do(req)
 	if err != nil {
 		fmt.Println("Error while downloading", url, "-", err)
 		return false
 	}
 	defer response.Body.Close()
-	c := make(chan os.Signal, 2)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+
+	// An interrupt stops the transfer and removes the partial download. The
+	// caller is responsible for anything else it created.
+	interrupt := make(chan os.Signal, 2)
+	done := make(chan bool)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer func() {
+		signal.Stop(interrupt)
+		close(done)
+	}()
 	go func() {
-		<-c
-		fmt.Println("Download interrupted. Rolling back...")
-		output.Close()
-		response.Body.Close()
-		var err error
-		if strings.Contains(target, "node") {
-			err = os.RemoveAll(os.Getenv("NVM_HOME") + "\\v" + version)
-		} else {
-			err = os.Remove(target)
+		select {
+		case <-interrupt:
+			fmt.Println("Download interrupted. Rolling back...")
+			response.Body.Close()
+		case <-done:
 		}
-		if err != nil {
-			fmt.Println("Error while rolling back", err)
-		}
-		os.Exit(1)
 	}()
 	var body []byte
 	if response.StatusCode != 200 {
@@ -170,6 +252,11 @@ func Download(url string, target string, version string) bool {
 		_, err = io.Copy(output, response.Body)
 		if err != nil {
 			fmt.Printf("Error while downloading %s: %v\n", url, err)
+			output.Close()
+			if rerr := os.Remove(target); rerr != nil {
+				fmt.Println("Error while rolling back", rerr)
+			}
+			return false
 		}
 	}
 
@@ -178,11 +265,11 @@ func Download(url string, target string, version string) bool {
 	switch response.StatusCode {
 	case 300:
 		if len(redirect) > 0 && redirect != url {
-			return Download(redirect, target, version)
+			return c.Download(redirect, target, version)
 		}
 
 		if strings.Contains(url, "/npm/cli/archive/v6.14.17.zip") {
-			return Download("https://github.com/npm/cli/archive/refs/tags/v6.14.17.zip", target, version)
+			return c.Download("https://github.com/npm/cli/archive/refs/tags/v6.14.17.zip", target, version)
 		}
 
 		fmt.Printf("\n\nREMOTE SERVER FAILURE\n\n---\nGET %v --> %v\n\n", url, response.StatusCode)
@@ -199,7 +286,7 @@ func Download(url string, target string, version string) bool {
 		fallthrough
 	case 307:
 		fmt.Println("Redirecting to " + redirect)
-		return Download(redirect, target, version)
+		return c.Download(redirect, target, version)
 	case 200:
 		// No processing necessary for successful response
 	default:
@@ -215,66 +302,47 @@ func Download(url string, target string, version string) bool {
 	return true
 }
 
-func GetNodeJS(root string, v string, a string, append bool) bool {
+func (c *Client) GetNodeJS(root string, v string, a arch.Architecture, append bool) error {
 	utility.DebugLogf("running GetNodeJS with root: %v, v%v, arch: %v, append: %v", root, v, a, append)
-	a = arch.Validate(a)
 
-	vpre := ""
 	vers := strings.Fields(strings.Replace(v, ".", " ", -1))
 	main, _ := strconv.ParseInt(vers[0], 0, 0)
+	vpre := a.DistDir(main)
 
-	if a == "32" {
-		if main > 0 {
-			vpre = "win-x86/"
-		} else {
-			vpre = ""
-		}
-	} else if a == "64" {
-		if main > 0 {
-			vpre = "win-x64/"
-		} else {
-			vpre = "x64/"
-		}
-	} else if a == "arm64" {
-		if main > 0 {
-			vpre = "win-arm64/"
-		} else {
-			vpre = "arm64/"
-		}
-	}
-
-	url := getNodeUrl(v, vpre, a, append)
+	url := c.getNodeUrl(v, vpre, a, append)
 
 	utility.DebugLogf("download url: %v", url)
 
 	if url == "" {
 		//No url should mean this version/arch isn't available
-		fmt.Println("Node.js v" + v + " " + a + "bit isn't available right now.")
+		return exit.Errorf(exit.ErrNotFound, "Node.js v%s %s isn't available right now.", v, a.Label())
 	} else {
-		fileName := root + "\\v" + v + "\\node" + a + ".exe"
+		fileName := root + "\\v" + v + "\\" + a.Executable()
 		if strings.HasSuffix(url, ".zip") {
 			fileName = root + "\\v" + v + "\\node.zip"
 		}
 
-		fmt.Println("Downloading node.js version " + v + " (" + a + "-bit)... ")
+		fmt.Println("Downloading node.js version " + v + " (" + a.Label() + ")... ")
 
-		if Download(url, fileName, v) {
+		if c.Download(url, fileName, v) {
 			utility.DebugLog("download succeeded")
+			if err := c.Verify(fileName, v, url); err != nil {
+				os.Remove(fileName)
+				return fmt.Errorf("Error verifying the download: %w", err)
+			}
+
 			// Extract the zip file
 			if strings.HasSuffix(url, ".zip") {
 				fmt.Println("Extracting node and npm...")
 				utility.DebugLogf("extracting %v to %v", fileName, root+"\\v"+v)
 				err := unzip(fileName, root+"\\v"+v)
 				if err != nil {
-					fmt.Println("Error extracting from Node archive: " + err.Error())
-
-					err = os.Remove(fileName)
-					if err != nil {
+					if rerr := os.Remove(fileName); rerr != nil {
 						fmt.Printf("Failed to remove %v after failed extraction. Please remove manually.", fileName)
 					}
 					utility.DebugLogf("removed %v", fileName)
 
-					return false
+					return exit.Errorf(exit.ErrIntegrity, "Error extracting from Node archive: %v", err)
 				}
 
 				err = os.Remove(fileName)
@@ -308,18 +376,16 @@ func GetNodeJS(root string, v string, a string, append bool) bool {
 				})
 			}
 			fmt.Println("Complete")
-			return true
+			return nil
 		} else {
 			utility.DebugLog("download failed")
-			return false
+			return exit.Errorf(exit.ErrNetwork, "failed to download %s", url)
 		}
 	}
-	return false
-
 }
 
-func GetNpm(root string, v string) bool {
-	url := GetFullNpmUrl("v" + v + ".zip")
+func (c *Client) GetNpm(root string, v string) error {
+	url := c.GetFullNpmUrl("v" + v + ".zip")
 
 	// temp directory to download the .zip file
 	tempDir := root + "\\temp"
@@ -331,38 +397,40 @@ func GetNpm(root string, v string) bool {
 		fmt.Println("Creating " + tempDir + "\n")
 		err := os.Mkdir(tempDir, os.ModePerm)
 		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+			return err
 		}
 	}
 	fileName := tempDir + "\\" + "npm-v" + v + ".zip"
 
 	fmt.Printf("Downloading npm version " + v + "... ")
-	if Download(url, fileName, v) {
+	if c.Download(url, fileName, v) {
 		utility.DebugLog("npm download succeeded")
 		fmt.Printf("Complete\n")
-		return true
+		return nil
 	} else {
 		utility.DebugLog("npm download failed")
-		return false
+		return exit.Errorf(exit.ErrNetwork, "failed to download npm v%s from %s", v, url)
 	}
 }
 
-func GetRemoteTextFile(url string) (string, error) {
-	response, httperr := client.Get(url)
+func (c *Client) GetRemoteTextFile(url string) (string, error) {
+	if c.offline {
+		return "", &RequestError{URL: url, Err: ErrOffline}
+	}
+
+	response, httperr := c.http.Get(url)
 	if httperr != nil {
-		return "", fmt.Errorf("Could not retrieve %v: %v", url, httperr)
+		return "", &RequestError{URL: url, Err: httperr}
 	}
+	defer response.Body.Close()
 
 	if response.StatusCode != 200 {
-		return "", fmt.Errorf("Error retrieving \"%s\": HTTP Status %v\n", url, response.StatusCode)
+		return "", &RequestError{URL: url, StatusCode: response.StatusCode}
 	}
 
-	defer response.Body.Close()
-
 	contents, readerr := ioutil.ReadAll(response.Body)
 	if readerr != nil {
-		return "", fmt.Errorf("error reading HTTP request body: %v", readerr)
+		return "", exit.Errorf(exit.ErrNetwork, "error reading HTTP request body: %v", readerr)
 	}
 
 	return string(contents), nil
@@ -406,35 +474,33 @@ func IsNodeArm64bitAvailable(v string) bool {
 	return true
 }
 
-func getNodeUrl(v string, vpre string, arch string, append bool) string {
-	a := "x86"
-	if arch == "arm64" {
-		a = "arm64"
-	}
-	if arch == "64" {
-		a = "x64"
-	}
-
+func (c *Client) getNodeUrl(v string, vpre string, a arch.Architecture, append bool) string {
 	//url := "http://nodejs.org/dist/v"+v+"/" + vpre + "/node.exe"
-	url := GetFullNodeUrl("v" + v + "/" + vpre + "node.exe")
+	url := c.GetFullNodeUrl("v" + v + "/" + vpre + "node.exe")
 
-	if !append {
+	// Only legacy sources (nodejs.org/dist) distribute a standalone node.exe
+	// instead of a zip for older versions.
+	if !c.source.Legacy && !append {
+		url = c.source.ArchiveURL(v, a)
+	} else if !append {
 		version, err := semver.Make(v)
 		if err != nil {
-			fmt.Println("Node.js v" + v + " " + a + "bit isn't available right now.")
-			fmt.Println(err.Error())
-			os.Exit(1)
+			utility.DebugLogf("invalid version v%s: %v", v, err)
+			return ""
 		}
 
 		corepack, _ := semver.Make("16.9.0")
 
 		if version.GTE(corepack) {
-			url = GetFullNodeUrl("v" + v + "/node-v" + v + "-win-" + a + ".zip")
+			url = c.source.ArchiveURL(v, a)
 		}
 	}
 
 	// Check online to see if a 64 bit version exists
-	_, err := client.Head(url)
+	if c.offline {
+		return ""
+	}
+	_, err := c.http.Head(url)
 	if err != nil {
 		return ""
 	}